@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// apiUnits documents the unit of every numeric field in the JSON API.
+var apiUnits = map[string]string{
+	"wind_lull":                     "m/s",
+	"wind_avg":                      "m/s",
+	"wind_gust":                     "m/s",
+	"wind_direction":                "degrees",
+	"station_pressure":              "mb",
+	"air_temperature":               "°C",
+	"relative_humidity":             "%",
+	"illuminance":                   "lux",
+	"uv":                            "index",
+	"solar_radiation":               "W/m²",
+	"rain_accumulated":              "mm",
+	"precip_type":                   "0=none, 1=rain, 2=hail, 3=mix",
+	"lightning_strike_avg_distance": "km",
+	"lightning_strike_count":        "count",
+	"battery":                       "V",
+	"report_interval":               "minutes",
+	"dew_point":                     "°C",
+	"feels_like":                    "°C",
+	"age_seconds":                   "s",
+	"rain_last_hour":                "mm",
+	"rain_last_24h":                 "mm",
+	"rain_since_midnight":           "mm",
+}
+
+// currentResponse is the /api/v1/current response body.
+type currentResponse struct {
+	StationID   string            `json:"station_id"`
+	StationName string            `json:"station_name"`
+	Source      string            `json:"source,omitempty"`
+	Connected   bool              `json:"connected"`
+	Reconnects  float64           `json:"reconnects"`
+	Observation *restObs          `json:"observation"`
+	Derived     *currentDerived   `json:"derived,omitempty"`
+	AgeSeconds  *float64          `json:"age_seconds"`
+	RainStart   *int64            `json:"rain_start_epoch,omitempty"`
+	Rain        *currentRain      `json:"rain,omitempty"`
+	Units       map[string]string `json:"units"`
+}
+
+// currentDerived holds values computed locally from the observation.
+type currentDerived struct {
+	DewPoint  *float64 `json:"dew_point"`
+	FeelsLike *float64 `json:"feels_like"`
+}
+
+// currentRain holds rolling rain totals from the rain accumulator.
+type currentRain struct {
+	LastHour      float64 `json:"rain_last_hour"`
+	Last24h       float64 `json:"rain_last_24h"`
+	SinceMidnight float64 `json:"rain_since_midnight"`
+}
+
+// currentHandler serves the latest observation, derived values and exporter
+// state as JSON for consumers that can't parse the Prometheus format.
+// It returns 503 (with connection state) until the first observation arrives.
+// Rain totals are included when rain is non-nil; midnight is in zone, the
+// same as for CWOP.
+func currentHandler(collector *Collector, rain *rainAccumulator, zone *stationZone) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		st := collector.State()
+		resp := currentResponse{
+			StationID:   st.StationID,
+			StationName: st.StationName,
+			Source:      st.Source,
+			Connected:   st.Connected,
+			Reconnects:  st.Reconnects,
+			Units:       apiUnits,
+		}
+		if st.RainStart > 0 {
+			rs := int64(st.RainStart)
+			resp.RainStart = &rs
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if !st.HasObs {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		obs := st.Observation
+		ro := observationToRESTObs(obs)
+		resp.Observation = &ro
+		resp.Derived = &currentDerived{
+			DewPoint:  ptr(DewPoint(obs.AirTemperature, obs.RelativeHumidity)),
+			FeelsLike: ptr(FeelsLike(obs.AirTemperature, obs.RelativeHumidity, obs.WindAvg)),
+		}
+		age := time.Since(time.Unix(obs.Timestamp, 0)).Seconds()
+		resp.AgeSeconds = &age
+		if rain != nil {
+			t := rain.Totals(time.Now(), zone.Location())
+			resp.Rain = &currentRain{LastHour: t.LastHour, Last24h: t.Last24h, SinceMidnight: t.SinceMidnight}
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
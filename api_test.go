@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getCurrent(t *testing.T, c *Collector) (int, map[string]any) {
+	t.Helper()
+	mux := newMux(c, nil, nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/current", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func TestCurrentAPI_NoObservation(t *testing.T) {
+	c := NewCollector("99999", "backyard")
+	c.SetConnected(true)
+
+	code, body := getCurrent(t, c)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", code)
+	}
+	if body["connected"] != true {
+		t.Errorf("connected = %v, want true", body["connected"])
+	}
+	if body["observation"] != nil {
+		t.Errorf("observation = %v, want null", body["observation"])
+	}
+}
+
+func TestCurrentAPI_Observation(t *testing.T) {
+	c := NewCollector("99999", "backyard")
+	obs := testObservation()
+	obs.Timestamp = time.Now().Add(-30 * time.Second).Unix()
+	obs.UV = math.NaN()
+	c.UpdateObservation(obs)
+	c.SetRainStart(1700000000)
+
+	code, body := getCurrent(t, c)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if body["station_id"] != "99999" || body["station_name"] != "backyard" {
+		t.Errorf("station = %v/%v", body["station_id"], body["station_name"])
+	}
+	if body["source"] != SourceWebSocket {
+		t.Errorf("source = %v, want %s", body["source"], SourceWebSocket)
+	}
+	if body["connected"] != false {
+		t.Errorf("connected = %v, want false", body["connected"])
+	}
+	if age, _ := body["age_seconds"].(float64); age < 29 || age > 60 {
+		t.Errorf("age_seconds = %v, want ~30", body["age_seconds"])
+	}
+	if body["rain_start_epoch"] != float64(1700000000) {
+		t.Errorf("rain_start_epoch = %v", body["rain_start_epoch"])
+	}
+
+	o := body["observation"].(map[string]any)
+	if o["air_temperature"] != 22.5 {
+		t.Errorf("air_temperature = %v, want 22.5", o["air_temperature"])
+	}
+	if v, ok := o["uv"]; !ok || v != nil {
+		t.Errorf("uv = %v (present %v), want null", v, ok)
+	}
+
+	d := body["derived"].(map[string]any)
+	if d["dew_point"] != DewPoint(22.5, 65) {
+		t.Errorf("dew_point = %v", d["dew_point"])
+	}
+	if d["feels_like"] != 22.5 {
+		t.Errorf("feels_like = %v, want 22.5", d["feels_like"])
+	}
+
+	units := body["units"].(map[string]any)
+	if units["air_temperature"] != "°C" || units["wind_avg"] != "m/s" {
+		t.Errorf("units = %v", units)
+	}
+}
+
+func TestCurrentAPI_RESTSource(t *testing.T) {
+	c := NewCollector("99999", "backyard")
+	c.UpdateObservationFrom(testObservation(), SourceREST)
+
+	_, body := getCurrent(t, c)
+	if body["source"] != SourceREST {
+		t.Errorf("source = %v, want %s", body["source"], SourceREST)
+	}
+}
+
+func TestCurrentAPI_RainTotals(t *testing.T) {
+	c := NewCollector("99999", "backyard")
+	obs := testObservation()
+	obs.Timestamp = time.Now().Unix()
+	c.UpdateObservation(obs)
+
+	rain := &rainAccumulator{}
+	rain.Add(time.Now().Add(-30*time.Minute).Unix(), 0.5)
+	rain.Add(time.Now().Add(-3*time.Hour).Unix(), 1.0)
+
+	mux := newMux(c, rain, nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/current", nil))
+
+	var body struct {
+		Rain *currentRain `json:"rain"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Rain == nil {
+		t.Fatal("rain totals missing")
+	}
+	if body.Rain.LastHour != 0.5 || body.Rain.Last24h != 1.5 {
+		t.Errorf("rain = %+v, want 0.5 last hour and 1.5 last 24h", *body.Rain)
+	}
+}
+
+func TestCurrentAPI_RainSinceStationMidnight(t *testing.T) {
+	// 14 hours ahead of UTC, so its midnight differs from any test host's.
+	kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCollector("99999", "backyard")
+	obs := testObservation()
+	obs.Timestamp = time.Now().Unix()
+	c.UpdateObservation(obs)
+	rain := &rainAccumulator{}
+	for m := 10; m < 24*60; m += 10 {
+		rain.Add(time.Now().Add(-time.Duration(m)*time.Minute).Unix(), 0.1)
+	}
+
+	before := rain.Totals(time.Now(), kiritimati).SinceMidnight
+	mux := newMux(c, rain, newStationZone(kiritimati, nil))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/current", nil))
+	after := rain.Totals(time.Now(), kiritimati).SinceMidnight
+
+	var body struct {
+		Rain *currentRain `json:"rain"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Rain == nil {
+		t.Fatal("rain totals missing")
+	}
+	if got := body.Rain.SinceMidnight; got != before && got != after {
+		t.Errorf("rain since midnight = %v, want %v from the station's midnight", got, before)
+	}
+}
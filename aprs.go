@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAPRSServer = "cwop.aprs.net:14580"
+
+// minCWOPInterval is the shortest upload interval CWOP accepts.
+// Stations that send more often than every 5 minutes are asked to slow down.
+const minCWOPInterval = 5 * time.Minute
+
+// aprsTimeout bounds the whole APRS-IS session (dial, login, send).
+const aprsTimeout = 30 * time.Second
+
+// Position is a station location used in APRS packets.
+type Position struct {
+	Latitude  float64
+	Longitude float64
+	Elevation float64 // meters above sea level
+}
+
+// RainTotals holds rain accumulations in millimeters for an APRS packet.
+// NaN means unknown.
+type RainTotals struct {
+	LastHour      float64
+	Last24h       float64
+	SinceMidnight float64
+}
+
+// FormatAPRSWeather formats an observation as an APRS positional weather report
+// (APRS spec 1.01, chapter 12) suitable for CWOP.
+// Unknown values are sent as dots, as the spec requires.
+func FormatAPRSWeather(callsign string, pos Position, obs Observation, rain RainTotals) string {
+	var b strings.Builder
+
+	ts := time.Unix(obs.Timestamp, 0).UTC()
+	fmt.Fprintf(&b, "%s>APRS,TCPIP*:@%sz", callsign, ts.Format("021504"))
+	b.WriteString(aprsLatitude(pos.Latitude))
+	b.WriteByte('/')
+	b.WriteString(aprsLongitude(pos.Longitude))
+	b.WriteByte('_')
+
+	b.WriteString(aprsField("", obs.WindDirection, 3, 1))
+	b.WriteString(aprsField("/", obs.WindAvg, 3, mpsToMph))
+	b.WriteString(aprsField("g", obs.WindGust, 3, mpsToMph))
+	b.WriteString(aprsTemperature(obs.AirTemperature))
+	b.WriteString(aprsField("r", rain.LastHour, 3, mmToHundredthsInch))
+	b.WriteString(aprsField("p", rain.Last24h, 3, mmToHundredthsInch))
+	b.WriteString(aprsField("P", rain.SinceMidnight, 3, mmToHundredthsInch))
+	b.WriteString(aprsHumidity(obs.RelativeHumidity))
+	b.WriteString(aprsField("b", AltimeterSetting(obs.StationPressure, pos.Elevation), 5, 10))
+	b.WriteString(aprsLuminosity(obs.SolarRadiation))
+	b.WriteString("tempest-exporter")
+
+	return b.String()
+}
+
+const (
+	mpsToMph           = 2.2369362920544
+	mmToHundredthsInch = 100 / 25.4
+)
+
+// aprsField renders a fixed-width, zero-padded integer field with a prefix.
+// The value is multiplied by scale before rounding.
+func aprsField(prefix string, v float64, width int, scale float64) string {
+	if math.IsNaN(v) || v < 0 {
+		return prefix + strings.Repeat(".", width)
+	}
+	n := int(math.Round(v * scale))
+	if limit := int(math.Pow10(width)) - 1; n > limit {
+		n = limit
+	}
+	return fmt.Sprintf("%s%0*d", prefix, width, n)
+}
+
+// aprsTemperature renders the tTTT field in Fahrenheit; negatives use a minus sign.
+func aprsTemperature(tempC float64) string {
+	if math.IsNaN(tempC) {
+		return "t..."
+	}
+	f := int(math.Round(tempC*1.8 + 32))
+	if f < 0 {
+		return fmt.Sprintf("t-%02d", -f)
+	}
+	return fmt.Sprintf("t%03d", f)
+}
+
+// aprsHumidity renders the hHH field, where 100% is encoded as 00.
+func aprsHumidity(pct float64) string {
+	if math.IsNaN(pct) || pct <= 0 {
+		return "h.."
+	}
+	h := int(math.Round(pct))
+	if h >= 100 {
+		h = 0
+	}
+	return fmt.Sprintf("h%02d", h)
+}
+
+// aprsLuminosity renders solar radiation as L (below 1000 W/m²) or l (1000 and above).
+func aprsLuminosity(wm2 float64) string {
+	if math.IsNaN(wm2) || wm2 < 0 {
+		return ""
+	}
+	n := int(math.Round(wm2))
+	if n >= 1000 {
+		return fmt.Sprintf("l%03d", min(n-1000, 999))
+	}
+	return fmt.Sprintf("L%03d", n)
+}
+
+// aprsLatitude renders latitude as DDMM.hhN.
+func aprsLatitude(lat float64) string {
+	hemi := 'N'
+	if lat < 0 {
+		hemi = 'S'
+		lat = -lat
+	}
+	deg, minutes := degMin(lat)
+	return fmt.Sprintf("%02d%05.2f%c", deg, minutes, hemi)
+}
+
+// aprsLongitude renders longitude as DDDMM.hhW.
+func aprsLongitude(lon float64) string {
+	hemi := 'E'
+	if lon < 0 {
+		hemi = 'W'
+		lon = -lon
+	}
+	deg, minutes := degMin(lon)
+	return fmt.Sprintf("%03d%05.2f%c", deg, minutes, hemi)
+}
+
+// degMin splits decimal degrees into whole degrees and minutes rounded to
+// hundredths, carrying into the degrees when the minutes round up to 60.
+func degMin(v float64) (int, float64) {
+	deg := int(v)
+	minutes := math.Round((v-float64(deg))*60*100) / 100
+	if minutes >= 60 {
+		deg++
+		minutes = 0
+	}
+	return deg, minutes
+}
+
+// AltimeterSetting reduces station pressure (mb) to an altimeter setting (mb)
+// using the NOAA formula. CWOP expects sea-level-referenced pressure.
+func AltimeterSetting(stationMb, elevationM float64) float64 {
+	if math.IsNaN(stationMb) || stationMb <= 0.3 {
+		return math.NaN()
+	}
+	const n = 0.190284
+	p := stationMb - 0.3
+	k := math.Pow(1013.25, n) * 0.0065 / 288
+	return p * math.Pow(1+k*elevationM/math.Pow(p, n), 1/n)
+}
+
+// rainSample is one report interval's rain accumulation.
+type rainSample struct {
+	Timestamp int64   `json:"timestamp"`
+	MM        float64 `json:"mm"`
+}
+
+// rainAccumulator keeps a rolling 24 hours of per-interval rain accumulation
+// so hourly, daily and since-midnight totals can be derived.
+type rainAccumulator struct {
+	mu      sync.Mutex
+	samples []rainSample
+}
+
+// Add records an observation's rain accumulation. A sample whose timestamp is
+// already recorded (e.g. REST fallback re-polling) is ignored; older samples
+// (e.g. backfilled after an outage) are inserted in order.
+func (r *rainAccumulator) Add(ts int64, mm float64) {
+	if math.IsNaN(mm) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, found := slices.BinarySearchFunc(r.samples, ts, func(s rainSample, ts int64) int {
+		return cmp.Compare(s.Timestamp, ts)
+	})
+	if found {
+		return
+	}
+	r.samples = slices.Insert(r.samples, i, rainSample{Timestamp: ts, MM: mm})
+
+	newest := r.samples[len(r.samples)-1].Timestamp
+	cutoff := newest - int64((24 * time.Hour).Seconds())
+	i = 0
+	for i < len(r.samples) && r.samples[i].Timestamp <= cutoff {
+		i++
+	}
+	r.samples = r.samples[i:]
+}
+
+// Observe records an observation's rain; it is registered with Collector.OnObservation.
+func (r *rainAccumulator) Observe(obs Observation) {
+	r.Add(obs.Timestamp, obs.RainAccumulated)
+}
+
+// Samples returns a copy of the retained samples, oldest first.
+func (r *rainAccumulator) Samples() []rainSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]rainSample(nil), r.samples...)
+}
+
+// Restore replaces the retained samples, e.g. from a state file.
+func (r *rainAccumulator) Restore(samples []rainSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append([]rainSample(nil), samples...)
+}
+
+// Totals returns rain accumulations relative to now in the given location.
+func (r *rainAccumulator) Totals(now time.Time, loc *time.Location) RainTotals {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hourAgo := now.Add(-time.Hour).Unix()
+	dayAgo := now.Add(-24 * time.Hour).Unix()
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).Unix()
+
+	var t RainTotals
+	for _, s := range r.samples {
+		if s.Timestamp > dayAgo {
+			t.Last24h += s.MM
+		}
+		if s.Timestamp > hourAgo {
+			t.LastHour += s.MM
+		}
+		if s.Timestamp >= midnight {
+			t.SinceMidnight += s.MM
+		}
+	}
+	return t
+}
+
+// APRSClient sends packets to an APRS-IS server.
+type APRSClient struct {
+	server   string
+	callsign string
+	passcode string
+	dialer   net.Dialer
+}
+
+// NewAPRSClient creates an APRS-IS client. CWOP-only stations use passcode "-1".
+func NewAPRSClient(server, callsign, passcode string) *APRSClient {
+	return &APRSClient{
+		server:   server,
+		callsign: callsign,
+		passcode: passcode,
+	}
+}
+
+// Send opens an APRS-IS session, logs in, sends a single packet and disconnects,
+// as CWOP recommends for weather stations.
+func (a *APRSClient) Send(ctx context.Context, packet string) error {
+	ctx, cancel := context.WithTimeout(ctx, aprsTimeout)
+	defer cancel()
+
+	conn, err := a.dialer.DialContext(ctx, "tcp", a.server)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", a.server, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+
+	// Server greets with a "# ..." banner before accepting a login.
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("read banner: %w", err)
+	}
+
+	login := fmt.Sprintf("user %s pass %s vers tempest-exporter %s\r\n", a.callsign, a.passcode, version)
+	if _, err := conn.Write([]byte(login)); err != nil {
+		return fmt.Errorf("send login: %w", err)
+	}
+
+	resp, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read login response: %w", err)
+	}
+	if !strings.HasPrefix(resp, "# logresp") {
+		// Some servers echo the login back; the passcode is not in the
+		// global log filter, so mask it here.
+		resp = strings.ReplaceAll(resp, "pass "+a.passcode, "pass "+redacted)
+		return fmt.Errorf("unexpected login response: %q", strings.TrimSpace(resp))
+	}
+
+	if _, err := conn.Write([]byte(packet + "\r\n")); err != nil {
+		return fmt.Errorf("send packet: %w", err)
+	}
+	return nil
+}
+
+// CWOPUploader periodically formats the latest observation as an APRS weather
+// packet and sends it to CWOP.
+type CWOPUploader struct {
+	aprs      *APRSClient
+	collector *Collector
+	callsign  string
+	rain      *rainAccumulator
+
+	// position is fixed from config; when it is nil, resolveStation is
+	// used. zone's midnight resets the daily rain total.
+	position       *Position
+	zone           *stationZone
+	resolveStation func(ctx context.Context) (*StationInfo, error)
+
+	lastSent int64
+}
+
+// NewCWOPUploader creates an uploader that reports rain totals from rain
+// since midnight in zone. resolve may be nil only if pos is provided.
+func NewCWOPUploader(aprs *APRSClient, collector *Collector, rain *rainAccumulator, pos *Position, zone *stationZone, resolve func(ctx context.Context) (*StationInfo, error)) *CWOPUploader {
+	return &CWOPUploader{
+		aprs:           aprs,
+		collector:      collector,
+		callsign:       aprs.callsign,
+		rain:           rain,
+		position:       pos,
+		zone:           zone,
+		resolveStation: resolve,
+	}
+}
+
+// Run uploads on every interval tick until the context is cancelled.
+func (u *CWOPUploader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.upload(ctx, interval); err != nil {
+				slog.Error("CWOP upload failed", "error", err)
+			}
+		}
+	}
+}
+
+// upload sends the latest observation if it is new and no older than maxAge.
+func (u *CWOPUploader) upload(ctx context.Context, maxAge time.Duration) error {
+	obs, ok := u.collector.Observation()
+	if !ok || obs.Timestamp == u.lastSent {
+		return nil
+	}
+	if age := time.Since(time.Unix(obs.Timestamp, 0)); age > maxAge {
+		slog.Warn("skipping CWOP upload of stale observation", "age", age.Round(time.Second))
+		return nil
+	}
+
+	if u.position == nil {
+		if err := u.resolve(ctx); err != nil {
+			return err
+		}
+	}
+	// Uploading with the wrong midnight would report a wrong daily total.
+	if err := u.zone.Resolve(ctx); err != nil {
+		return err
+	}
+
+	packet := FormatAPRSWeather(u.callsign, *u.position, obs, u.rain.Totals(time.Now(), u.zone.Location()))
+	if err := u.aprs.Send(ctx, packet); err != nil {
+		return err
+	}
+	u.lastSent = obs.Timestamp
+	slog.Info("CWOP packet sent", "packet", packet)
+	return nil
+}
+
+// resolve fills in the position from the station's metadata, and the zone
+// too if it isn't known yet, so both cost one lookup.
+func (u *CWOPUploader) resolve(ctx context.Context) error {
+	st, err := u.resolveStation(ctx)
+	if err != nil {
+		return fmt.Errorf("resolving station position: %w", err)
+	}
+	u.position = &Position{Latitude: st.Latitude, Longitude: st.Longitude, Elevation: st.Elevation}
+	slog.Info("CWOP station position resolved", "latitude", st.Latitude, "longitude", st.Longitude, "elevation", st.Elevation)
+	u.zone.setFrom(st)
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatAPRSWeather(t *testing.T) {
+	obs := testObservation()
+	obs.Timestamp = time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC).Unix()
+	pos := Position{Latitude: 40.7608, Longitude: -111.8910, Elevation: 0}
+	rain := RainTotals{LastHour: 2.54, Last24h: 25.4, SinceMidnight: 12.7}
+
+	got := FormatAPRSWeather("DW1234", pos, obs, rain)
+	want := "DW1234>APRS,TCPIP*:@142213z4045.65N/11153.46W_180/003g005t073r010p100P050h65b10130L300tempest-exporter"
+	if got != want {
+		t.Errorf("packet =\n  %s\nwant\n  %s", got, want)
+	}
+}
+
+func TestFormatAPRSWeather_UnknownValues(t *testing.T) {
+	obs := Observation{
+		Timestamp:        1700000000,
+		WindDirection:    math.NaN(),
+		WindAvg:          math.NaN(),
+		WindGust:         math.NaN(),
+		AirTemperature:   math.NaN(),
+		RelativeHumidity: math.NaN(),
+		StationPressure:  math.NaN(),
+		SolarRadiation:   math.NaN(),
+	}
+	rain := RainTotals{LastHour: math.NaN(), Last24h: math.NaN(), SinceMidnight: math.NaN()}
+
+	got := FormatAPRSWeather("DW1234", Position{}, obs, rain)
+	if !strings.Contains(got, "_.../...g...t...r...p...P...h..b.....tempest-exporter") {
+		t.Errorf("unknown values not rendered as dots: %s", got)
+	}
+}
+
+func TestAPRSTemperature(t *testing.T) {
+	tests := []struct {
+		c    float64
+		want string
+	}{
+		{22.5, "t073"},
+		{0, "t032"},
+		{-20, "t-04"},
+		{-40, "t-40"},
+		{math.NaN(), "t..."},
+	}
+	for _, tt := range tests {
+		if got := aprsTemperature(tt.c); got != tt.want {
+			t.Errorf("aprsTemperature(%v) = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestAPRSHumidity(t *testing.T) {
+	tests := []struct {
+		pct  float64
+		want string
+	}{
+		{65, "h65"},
+		{100, "h00"},
+		{5, "h05"},
+		{0, "h.."},
+		{math.NaN(), "h.."},
+	}
+	for _, tt := range tests {
+		if got := aprsHumidity(tt.pct); got != tt.want {
+			t.Errorf("aprsHumidity(%v) = %q, want %q", tt.pct, got, tt.want)
+		}
+	}
+}
+
+func TestAPRSLuminosity(t *testing.T) {
+	if got := aprsLuminosity(300); got != "L300" {
+		t.Errorf("aprsLuminosity(300) = %q, want L300", got)
+	}
+	if got := aprsLuminosity(1150); got != "l150" {
+		t.Errorf("aprsLuminosity(1150) = %q, want l150", got)
+	}
+	if got := aprsLuminosity(math.NaN()); got != "" {
+		t.Errorf("aprsLuminosity(NaN) = %q, want empty", got)
+	}
+}
+
+func TestAPRSPosition(t *testing.T) {
+	if got := aprsLatitude(-33.8688); got != "3352.13S" {
+		t.Errorf("aprsLatitude = %q, want 3352.13S", got)
+	}
+	if got := aprsLongitude(151.2093); got != "15112.56E" {
+		t.Errorf("aprsLongitude = %q, want 15112.56E", got)
+	}
+	// 10.99999° rounds to 11°00.00', not 10°60.00'
+	if got := aprsLatitude(10.99999); got != "1100.00N" {
+		t.Errorf("aprsLatitude rounding = %q, want 1100.00N", got)
+	}
+}
+
+func TestAltimeterSetting(t *testing.T) {
+	// At sea level the altimeter setting is station pressure minus the 0.3 mb offset.
+	if got := AltimeterSetting(1013.25, 0); math.Abs(got-1012.95) > 0.01 {
+		t.Errorf("AltimeterSetting(1013.25, 0) = %v, want ~1012.95", got)
+	}
+	// Salt Lake City (~1300m): ~870 mb station pressure is ~1020 mb altimeter.
+	if got := AltimeterSetting(870, 1300); got < 1015 || got > 1025 {
+		t.Errorf("AltimeterSetting(870, 1300) = %v, want ~1020", got)
+	}
+	if !math.IsNaN(AltimeterSetting(math.NaN(), 0)) {
+		t.Error("AltimeterSetting(NaN) should be NaN")
+	}
+}
+
+func TestRainAccumulator(t *testing.T) {
+	loc := time.UTC
+	now := time.Date(2024, 6, 1, 1, 30, 0, 0, loc)
+
+	var r rainAccumulator
+	r.Add(now.Add(-25*time.Hour).Unix(), 100) // outside 24h window
+	r.Add(now.Add(-3*time.Hour).Unix(), 1.0)  // previous day, within 24h
+	r.Add(now.Add(-61*time.Minute).Unix(), 0.5)
+	r.Add(now.Add(-30*time.Minute).Unix(), 0.25)
+	r.Add(now.Add(-30*time.Minute).Unix(), 0.25) // duplicate timestamp ignored
+	r.Add(now.Add(-time.Minute).Unix(), math.NaN())
+
+	got := r.Totals(now, loc)
+	if got.LastHour != 0.25 {
+		t.Errorf("LastHour = %v, want 0.25", got.LastHour)
+	}
+	if got.Last24h != 1.75 {
+		t.Errorf("Last24h = %v, want 1.75", got.Last24h)
+	}
+	if got.SinceMidnight != 0.75 {
+		t.Errorf("SinceMidnight = %v, want 0.75", got.SinceMidnight)
+	}
+}
+
+// fakeAPRSServer is a local TCP stand-in for an APRS-IS server.
+// It returns the listen address and a channel that receives the lines sent by each client.
+func fakeAPRSServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	sessions := make(chan []string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = conn.Write([]byte("# aprsc 2.1.14\r\n"))
+				r := bufio.NewReader(conn)
+				var lines []string
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						sessions <- lines
+						return
+					}
+					lines = append(lines, strings.TrimRight(line, "\r\n"))
+					if len(lines) == 1 {
+						_, _ = conn.Write([]byte("# logresp DW1234 unverified, server CWOP-1\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+func TestAPRSClient_Send(t *testing.T) {
+	addr, sessions := fakeAPRSServer(t)
+
+	a := NewAPRSClient(addr, "DW1234", "-1")
+	if err := a.Send(context.Background(), "DW1234>APRS,TCPIP*:test"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	lines := <-sessions
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), lines)
+	}
+	if !strings.HasPrefix(lines[0], "user DW1234 pass -1 vers tempest-exporter ") {
+		t.Errorf("login = %q", lines[0])
+	}
+	if lines[1] != "DW1234>APRS,TCPIP*:test" {
+		t.Errorf("packet = %q", lines[1])
+	}
+}
+
+func TestAPRSClient_Send_MasksPasscode(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("# aprsc 2.1.14\r\n"))
+		login, _ := bufio.NewReader(conn).ReadString('\n')
+		_, _ = conn.Write([]byte("# invalid login: " + login))
+	}()
+
+	a := NewAPRSClient(ln.Addr().String(), "DW1234", "12345")
+	err = a.Send(context.Background(), "x")
+	if err == nil || strings.Contains(err.Error(), "12345") || !strings.Contains(err.Error(), "pass [REDACTED]") {
+		t.Errorf("error = %v, want the echoed passcode masked", err)
+	}
+}
+
+func TestAPRSClient_Send_Unreachable(t *testing.T) {
+	a := NewAPRSClient("127.0.0.1:1", "DW1234", "-1")
+	if err := a.Send(context.Background(), "x"); err == nil {
+		t.Fatal("expected error for unreachable server")
+	}
+}
+
+func TestCWOPUploader_Upload(t *testing.T) {
+	addr, sessions := fakeAPRSServer(t)
+
+	c := NewCollector("12345", "backyard")
+	resolved := 0
+	resolve := func(context.Context) (*StationInfo, error) {
+		resolved++
+		return &StationInfo{Latitude: 40.76, Longitude: -111.89, Elevation: 1300, Timezone: "America/Denver"}, nil
+	}
+	rain := &rainAccumulator{}
+	c.OnObservation(rain.Observe)
+	u := NewCWOPUploader(NewAPRSClient(addr, "DW1234", "-1"), c, rain, nil, newStationZone(nil, resolve), resolve)
+
+	// No observation yet: nothing sent.
+	if err := u.upload(context.Background(), time.Hour); err != nil {
+		t.Fatalf("upload without observation: %v", err)
+	}
+
+	obs := testObservation()
+	obs.Timestamp = time.Now().Unix()
+	obs.RainAccumulated = 1.0
+	c.UpdateObservation(obs)
+
+	if err := u.upload(context.Background(), time.Hour); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	lines := <-sessions
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "DW1234>APRS,TCPIP*:@") {
+		t.Fatalf("unexpected session: %q", lines)
+	}
+	if !strings.Contains(lines[1], "r004") {
+		t.Errorf("packet should include last-hour rain from observer: %s", lines[1])
+	}
+
+	// Same observation again: not resent, position resolved only once.
+	if err := u.upload(context.Background(), time.Hour); err != nil {
+		t.Fatalf("repeat upload: %v", err)
+	}
+	if resolved != 1 {
+		t.Errorf("station resolved %d times, want 1 for both position and zone", resolved)
+	}
+	if loc := u.zone.Location(); loc.String() != "America/Denver" {
+		t.Errorf("location = %s, want the station's time zone", loc)
+	}
+	select {
+	case s := <-sessions:
+		t.Errorf("unexpected second session: %q", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCWOPUploader_SkipsStale(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	pos := &Position{}
+	u := NewCWOPUploader(NewAPRSClient("127.0.0.1:1", "DW1234", "-1"), c, &rainAccumulator{}, pos, newStationZone(time.UTC, nil), nil)
+	c.UpdateObservation(testObservation()) // 2023 timestamp
+
+	if err := u.upload(context.Background(), 10*time.Minute); err != nil {
+		t.Errorf("stale observation should be skipped without error, got %v", err)
+	}
+}
+
+func TestCWOPUploader_ResolveKeepsConfig(t *testing.T) {
+	denver, err := time.LoadLocation("America/Denver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(context.Context) (*StationInfo, error) {
+		return &StationInfo{Latitude: 1, Longitude: 2, Elevation: 3, Timezone: "Mars/Olympus"}, nil
+	}
+	zone := newStationZone(nil, resolve)
+	if err := zone.Resolve(context.Background()); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if zone.Location() != time.Local {
+		t.Errorf("unknown station time zone: location = %s, want the local zone", zone.Location())
+	}
+
+	u := NewCWOPUploader(NewAPRSClient("127.0.0.1:1", "DW1234", "-1"), NewCollector("12345", "backyard"), &rainAccumulator{}, nil, newStationZone(denver, nil), resolve)
+	if err := u.resolve(context.Background()); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if u.zone.Location() != denver || u.position.Elevation != 3 {
+		t.Errorf("location = %s, position = %+v; want the configured zone and resolved position", u.zone.Location(), *u.position)
+	}
+}
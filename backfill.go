@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+// defaultBackfillThreshold is the gap that triggers a backfill: obs_st
+// normally arrives every minute, so two minutes means at least one was missed.
+const defaultBackfillThreshold = 2 * time.Minute
+
+// backfillPage is the largest range requested from the device history
+// endpoint at once; longer ranges are returned at reduced resolution.
+const backfillPage = 24 * time.Hour
+
+const (
+	// backfillAttempts is how many times a page is requested before the
+	// rest of the gap is given up.
+	backfillAttempts = 5
+	// backfillRetryMin and backfillRetryMax bound the jittered delay
+	// between attempts. Rate limiting is handled by the request budget.
+	backfillRetryMin = 10 * time.Second
+	backfillRetryMax = 5 * time.Minute
+)
+
+// gap is a range of missed observations, exclusive of both ends.
+type gap struct {
+	after, before int64
+}
+
+// Backfiller detects gaps between consecutive observations (for example after
+// a WebSocket outage or restart) and replays the missed minutes from the REST
+// device history into its sinks.
+type Backfiller struct {
+	rest      *RESTClient
+	collector *Collector
+	// threshold is the smallest gap between observations that triggers a backfill.
+	threshold time.Duration
+	// maxAge limits how far back a single gap is backfilled.
+	maxAge time.Duration
+
+	sinks []func(Observation)
+	gaps  chan gap
+
+	// sleep waits for d or until ctx is done; replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu       sync.Mutex
+	deviceID string
+	last     int64 // timestamp of the newest observation seen
+}
+
+// NewBackfiller creates a backfiller and subscribes it to the collector's
+// observations. Gaps longer than threshold are backfilled, up to maxAge back.
+func NewBackfiller(rest *RESTClient, collector *Collector, deviceID string, threshold, maxAge time.Duration) *Backfiller {
+	b := &Backfiller{
+		rest:      rest,
+		collector: collector,
+		deviceID:  deviceID,
+		threshold: threshold,
+		maxAge:    maxAge,
+		gaps:      make(chan gap, 8),
+		sleep:     sleepContext,
+	}
+	if obs, ok := collector.Observation(); ok {
+		b.last = obs.Timestamp
+	}
+	collector.OnObservation(b.observe)
+	return b
+}
+
+// SetDevice changes the device whose history is fetched. The next
+// observation starts a new sequence rather than closing a gap.
+func (b *Backfiller) SetDevice(deviceID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if deviceID != b.deviceID {
+		b.deviceID = deviceID
+		b.last = 0
+	}
+}
+
+// AddSink registers fn to receive each backfilled observation. Sinks must
+// accept observations older than ones they have already seen. AddSink must be
+// called before Run.
+func (b *Backfiller) AddSink(fn func(Observation)) {
+	b.sinks = append(b.sinks, fn)
+}
+
+// observe queues a backfill when an observation arrives more than threshold
+// after the previous one.
+func (b *Backfiller) observe(obs Observation) {
+	b.mu.Lock()
+	prev := b.last
+	if obs.Timestamp <= prev {
+		b.mu.Unlock()
+		return
+	}
+	b.last = obs.Timestamp
+	b.mu.Unlock()
+
+	if prev == 0 || time.Duration(obs.Timestamp-prev)*time.Second <= b.threshold {
+		return
+	}
+
+	select {
+	case b.gaps <- gap{after: prev, before: obs.Timestamp}:
+	default:
+		slog.Warn("backfill queue full, dropping gap",
+			"from", time.Unix(prev, 0).UTC(), "to", time.Unix(obs.Timestamp, 0).UTC())
+	}
+}
+
+// Run processes queued gaps until the context is cancelled.
+func (b *Backfiller) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case g := <-b.gaps:
+			n, err := b.fill(ctx, g, time.Now())
+			if err != nil {
+				slog.Error("backfill failed", "error", err, "replayed", n)
+				continue
+			}
+			slog.Info("backfilled observation gap",
+				"from", time.Unix(g.after, 0).UTC(),
+				"to", time.Unix(g.before, 0).UTC(),
+				"replayed", n,
+			)
+		}
+	}
+}
+
+// fill fetches the gap page by page and replays each missed observation into
+// the sinks, returning how many were replayed. A failed page is retried
+// with backoff; if it keeps failing, the rest of the gap is given up, but
+// what was replayed is still counted.
+func (b *Backfiller) fill(ctx context.Context, g gap, now time.Time) (int, error) {
+	start := g.after + 1
+	if oldest := now.Add(-b.maxAge).Unix(); start < oldest {
+		start = oldest
+	}
+	end := g.before - 1
+
+	b.mu.Lock()
+	deviceID := b.deviceID
+	b.mu.Unlock()
+
+	replayed := 0
+	bo := weatherflow.NewBackoff(backfillRetryMin, backfillRetryMax)
+	page := int64(backfillPage.Seconds())
+	for from := start; from <= end; from += page {
+		to := min(from+page-1, end)
+		observations, err := b.fetchPage(ctx, bo, deviceID, from, to)
+		if err != nil {
+			b.collector.AddBackfilled(replayed)
+			return replayed, fmt.Errorf("giving up on %s to %s: %w",
+				time.Unix(from, 0).UTC(), time.Unix(end, 0).UTC(), err)
+		}
+		for _, obs := range observations {
+			if obs.Timestamp <= g.after || obs.Timestamp >= g.before {
+				continue
+			}
+			for _, sink := range b.sinks {
+				sink(obs)
+			}
+			replayed++
+		}
+	}
+	b.collector.AddBackfilled(replayed)
+	return replayed, nil
+}
+
+// fetchPage fetches one page of device history, retrying up to
+// backfillAttempts times unless the error can't be fixed by retrying.
+func (b *Backfiller) fetchPage(ctx context.Context, bo *weatherflow.Backoff, deviceID string, from, to int64) ([]Observation, error) {
+	for attempt := 1; ; attempt++ {
+		observations, err := b.rest.FetchDeviceObservations(ctx, deviceID, from, to)
+		if err == nil {
+			bo.Reset()
+			return observations, nil
+		}
+		var se *weatherflow.StatusError
+		if attempt == backfillAttempts || ctx.Err() != nil || (errors.As(err, &se) && !se.Temporary()) {
+			return nil, err
+		}
+		delay := bo.Next()
+		slog.Warn("backfill request failed, retrying",
+			"error", err,
+			"attempt", attempt,
+			"retry_in", delay.Round(time.Second),
+		)
+		if err := b.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// deviceHistoryServer serves one observation per minute for any requested
+// range and records the ranges asked for.
+func deviceHistoryServer(t *testing.T) (*httptest.Server, *[][2]int64, *sync.Mutex) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		ranges [][2]int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("time_start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("time_end"), 10, 64)
+		mu.Lock()
+		ranges = append(ranges, [2]int64{start, end})
+		mu.Unlock()
+
+		var rows [][]any
+		for ts := start - start%60; ts <= end; ts += 60 {
+			row := observationToArray(Observation{Timestamp: ts, RainAccumulated: 0.5})
+			vals := make([]any, len(row))
+			for i, v := range row {
+				if v != nil {
+					vals[i] = *v
+				}
+			}
+			rows = append(rows, vals)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"obs": rows})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ranges, &mu
+}
+
+func newTestBackfiller(t *testing.T, c *Collector, maxAge time.Duration) (*Backfiller, *[][2]int64, *sync.Mutex) {
+	t.Helper()
+	srv, ranges, mu := deviceHistoryServer(t)
+	rc := NewRESTClient("test-token", "12345", c)
+	rc.baseURL = srv.URL
+	return NewBackfiller(rc, c, "54321", defaultBackfillThreshold, maxAge), ranges, mu
+}
+
+func TestBackfiller_DetectsGap(t *testing.T) {
+	c := NewCollector("12345", "test")
+	b, _, _ := newTestBackfiller(t, c, 24*time.Hour)
+
+	c.UpdateObservation(Observation{Timestamp: 1700000000})
+	c.UpdateObservation(Observation{Timestamp: 1700000060}) // normal cadence
+	if len(b.gaps) != 0 {
+		t.Fatalf("queued %d gaps for consecutive observations", len(b.gaps))
+	}
+
+	c.UpdateObservation(Observation{Timestamp: 1700000600})
+	c.UpdateObservation(Observation{Timestamp: 1700000300}) // older, ignored
+	if len(b.gaps) != 1 {
+		t.Fatalf("queued %d gaps, want 1", len(b.gaps))
+	}
+	if g := <-b.gaps; g.after != 1700000060 || g.before != 1700000600 {
+		t.Errorf("gap = %+v, want 1700000060-1700000600", g)
+	}
+}
+
+func TestBackfiller_StartsFromRestoredObservation(t *testing.T) {
+	c := NewCollector("12345", "test")
+	c.Restore(CollectorState{Observation: Observation{Timestamp: 1700000000}, HasObs: true})
+	b, _, _ := newTestBackfiller(t, c, 24*time.Hour)
+
+	c.UpdateObservation(Observation{Timestamp: 1700003600})
+	if len(b.gaps) != 1 {
+		t.Fatalf("queued %d gaps, want 1 for the restart outage", len(b.gaps))
+	}
+}
+
+func TestBackfiller_SetDevice(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"obs":[]}`))
+	}))
+	defer srv.Close()
+
+	c := NewCollector("12345", "test")
+	rc := NewRESTClient("test-token", "12345", c)
+	rc.baseURL = srv.URL
+	b := NewBackfiller(rc, c, "54321", defaultBackfillThreshold, 24*time.Hour)
+	c.UpdateObservation(Observation{Timestamp: 1700000000})
+
+	// The first observation from the new device is not a gap.
+	b.SetDevice("99999")
+	c.UpdateObservation(Observation{Timestamp: 1700003600})
+	if len(b.gaps) != 0 {
+		t.Fatalf("queued %d gaps across a device change", len(b.gaps))
+	}
+
+	if _, err := b.fill(context.Background(), gap{after: 1700003600, before: 1700003780}, time.Unix(1700004000, 0)); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 1 || paths[0] != "/observations/device/99999" {
+		t.Errorf("requested %v, want the new device's history", paths)
+	}
+}
+
+func TestBackfiller_FillReplaysIntoSinks(t *testing.T) {
+	c := NewCollector("12345", "test")
+	b, _, _ := newTestBackfiller(t, c, 24*time.Hour)
+
+	rain := &rainAccumulator{}
+	var got []int64
+	b.AddSink(rain.Observe)
+	b.AddSink(func(obs Observation) { got = append(got, obs.Timestamp) })
+
+	g := gap{after: 1700000040, before: 1700000400}
+	n, err := b.fill(context.Background(), g, time.Unix(1700000400, 0))
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	// Minutes 1700000100 .. 1700000340, strictly inside the gap.
+	if n != 5 || len(got) != 5 || got[0] != 1700000100 || got[4] != 1700000340 {
+		t.Errorf("replayed %d: %v", n, got)
+	}
+	if samples := rain.Samples(); len(samples) != 5 {
+		t.Errorf("rain accumulator has %d samples, want 5", len(samples))
+	}
+	if st := c.State(); st.HasObs {
+		t.Error("backfill should not change the current observation")
+	}
+}
+
+func TestBackfiller_FillPagesAndClamps(t *testing.T) {
+	c := NewCollector("12345", "test")
+	b, ranges, mu := newTestBackfiller(t, c, 36*time.Hour)
+
+	now := time.Unix(1700000000, 0)
+	g := gap{after: now.Add(-72 * time.Hour).Unix(), before: now.Unix()}
+	if _, err := b.fill(context.Background(), g, now); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*ranges) != 2 {
+		t.Fatalf("made %d requests, want 2 pages for 36h", len(*ranges))
+	}
+	if first := (*ranges)[0]; first[0] != now.Add(-36*time.Hour).Unix() {
+		t.Errorf("first page starts at %d, want clamped to maxAge", first[0])
+	}
+	if last := (*ranges)[1]; last[1] != now.Unix()-1 {
+		t.Errorf("last page ends at %d, want %d", last[1], now.Unix()-1)
+	}
+}
+
+func TestBackfiller_RunCountsReplayed(t *testing.T) {
+	c := NewCollector("12345", "test")
+	b, _, _ := newTestBackfiller(t, c, 24*time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+
+	now := time.Now().Unix()
+	now -= now % 60
+	c.UpdateObservation(Observation{Timestamp: now - 300})
+	c.UpdateObservation(Observation{Timestamp: now})
+
+	// The four missed minutes between the two observations are replayed.
+	expected := `
+# HELP tempest_backfilled_observations_total Total observations replayed from REST device history after gaps
+# TYPE tempest_backfilled_observations_total counter
+tempest_backfilled_observations_total{station_id="12345",station_name="test"} 4
+`
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := testutil.CollectAndCompare(c, strings.NewReader(expected), "tempest_backfilled_observations_total")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backfill metric: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+// flakyHistoryServer serves one observation at the start of each requested
+// range, answering the requests numbered in fail (from 1) with status.
+func flakyHistoryServer(t *testing.T, status int, fail func(n int) bool) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail(int(requests.Add(1))) {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		start, _ := strconv.ParseInt(r.URL.Query().Get("time_start"), 10, 64)
+		row := observationToArray(Observation{Timestamp: start})
+		vals := make([]any, len(row))
+		for i, v := range row {
+			if v != nil {
+				vals[i] = *v
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"obs": [][]any{vals}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestBackfiller_FillRetriesFailedPage(t *testing.T) {
+	c := NewCollector("12345", "test")
+	srv, requests := flakyHistoryServer(t, http.StatusServiceUnavailable, func(n int) bool { return n == 2 || n == 3 })
+	rc := NewRESTClient("test-token", "12345", c)
+	rc.baseURL = srv.URL
+	b := NewBackfiller(rc, c, "54321", defaultBackfillThreshold, 48*time.Hour)
+	var slept []time.Duration
+	b.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	now := time.Unix(1700000000, 0)
+	g := gap{after: now.Add(-36 * time.Hour).Unix(), before: now.Unix()}
+	n, err := b.fill(context.Background(), g, now)
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if n != 2 || requests.Load() != 4 || len(slept) != 2 {
+		t.Errorf("replayed %d in %d requests after %d retries; want both pages in 4 requests after 2", n, requests.Load(), len(slept))
+	}
+}
+
+func TestBackfiller_FillCountsReplayedBeforeGivingUp(t *testing.T) {
+	for _, tt := range []struct {
+		status   int
+		requests int64
+	}{
+		{http.StatusInternalServerError, 1 + backfillAttempts},
+		// Retrying can't fix a client error.
+		{http.StatusNotFound, 2},
+	} {
+		c := NewCollector("12345", "test")
+		srv, requests := flakyHistoryServer(t, tt.status, func(n int) bool { return n > 1 })
+		rc := NewRESTClient("test-token", "12345", c)
+		rc.baseURL = srv.URL
+		b := NewBackfiller(rc, c, "54321", defaultBackfillThreshold, 48*time.Hour)
+		b.sleep = func(context.Context, time.Duration) error { return nil }
+
+		now := time.Unix(1700000000, 0)
+		g := gap{after: now.Add(-36 * time.Hour).Unix(), before: now.Unix()}
+		n, err := b.fill(context.Background(), g, now)
+		if err == nil || n != 1 {
+			t.Errorf("status %d: fill = %d, %v; want the first page and an error", tt.status, n, err)
+		}
+		if got := requests.Load(); got != tt.requests {
+			t.Errorf("status %d: %d requests, want %d", tt.status, got, tt.requests)
+		}
+		expected := `
+# HELP tempest_backfilled_observations_total Total observations replayed from REST device history after gaps
+# TYPE tempest_backfilled_observations_total counter
+tempest_backfilled_observations_total{station_id="12345",station_name="test"} 1
+`
+		if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "tempest_backfilled_observations_total"); err != nil {
+			t.Errorf("status %d: %v", tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+const (
+	// defaultImportInterval spaces history requests so an import uses at
+	// most 60 of the account's 100 REST requests per minute, leaving room
+	// for a running exporter and other integrations.
+	defaultImportInterval = time.Second
+	// importRetryBackoff is the first wait after a server error when the
+	// server gives no Retry-After; it doubles per retry. Rate-limited
+	// requests wait in the REST client's shared budget instead.
+	importRetryBackoff = 30 * time.Second
+	maxImportRetryWait = 5 * time.Minute
+)
+
+// historyImporter pages through a device's REST observation history with
+// rate-limit awareness.
+type historyImporter struct {
+	rest       *RESTClient
+	deviceID   string
+	interval   time.Duration
+	maxRetries int
+	// sleep waits for d or until ctx is done; replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newHistoryImporter(rest *RESTClient, deviceID string, interval time.Duration) *historyImporter {
+	return &historyImporter{
+		rest:       rest,
+		deviceID:   deviceID,
+		interval:   interval,
+		maxRetries: 5,
+		sleep:      sleepContext,
+	}
+}
+
+// Run fetches observations between from and to (Unix seconds, inclusive) one
+// day at a time, oldest first, and passes each to fn exactly once. It returns
+// the number of observations passed.
+func (h *historyImporter) Run(ctx context.Context, from, to int64, fn func(Observation) error) (int, error) {
+	page := int64(backfillPage.Seconds())
+	last := from - 1
+	total := 0
+	for start := from; start <= to; start += page {
+		if start > from {
+			if err := h.sleep(ctx, h.interval); err != nil {
+				return total, err
+			}
+		}
+		end := min(start+page-1, to)
+		observations, err := h.fetch(ctx, start, end)
+		if err != nil {
+			return total, fmt.Errorf("fetching %s: %w", time.Unix(start, 0).UTC().Format(time.DateOnly), err)
+		}
+		for _, obs := range observations {
+			if obs.Timestamp <= last || obs.Timestamp > to {
+				continue
+			}
+			if err := fn(obs); err != nil {
+				return total, err
+			}
+			last = obs.Timestamp
+			total++
+		}
+		slog.Info("imported history page",
+			"day", time.Unix(start, 0).UTC().Format(time.DateOnly),
+			"observations", len(observations),
+			"total", total,
+		)
+	}
+	return total, nil
+}
+
+// fetch requests one page, retrying when rate limited or when the server
+// fails. A 429 has already paused the REST client's budget, which holds the
+// retry back for Retry-After.
+func (h *historyImporter) fetch(ctx context.Context, start, end int64) ([]Observation, error) {
+	backoff := importRetryBackoff
+	for attempt := 0; ; attempt++ {
+		observations, err := h.rest.FetchDeviceObservations(ctx, h.deviceID, start, end)
+		var se *weatherflow.StatusError
+		if err == nil || !errors.As(err, &se) || !se.Temporary() || attempt >= h.maxRetries {
+			return observations, err
+		}
+		if se.StatusCode == http.StatusTooManyRequests {
+			slog.Warn("history request rate limited, retrying", "attempt", attempt+1)
+			continue
+		}
+
+		wait := se.RetryAfter
+		if wait == 0 {
+			wait = backoff
+			backoff = min(backoff*2, maxImportRetryWait)
+		}
+		slog.Warn("history request failed, retrying",
+			"status", se.StatusCode, "wait", wait, "attempt", attempt+1)
+		if err := h.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// runBackfillCommand implements the backfill subcommand, which imports the
+// station's history into an OpenMetrics file for TSDB backfilling. It returns
+// the process exit code.
+func runBackfillCommand(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tempest-exporter backfill -from TIME [-to TIME] [-output FILE] [-config FILE]\n\n"+
+			"Imports observation history from the WeatherFlow REST API as OpenMetrics.\n"+
+			"TIME is Unix seconds or RFC 3339. The station is configured as for the\n"+
+			"exporter, e.g. with TEMPEST_TOKEN, TEMPEST_DEVICE_ID and TEMPEST_STATION_ID.\n\n")
+		fs.PrintDefaults()
+	}
+	fromFlag := fs.String("from", "", "start of the import (required)")
+	toFlag := fs.String("to", "", "end of the import (default now)")
+	output := fs.String("output", "tempest.om", "OpenMetrics file to write, or - for stdout")
+	interval := fs.Duration("interval", defaultImportInterval, "minimum time between REST requests")
+	loadConfig := configFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		return 1
+	}
+	deviceID, stationID, stationName := cfg.Tempest.DeviceID, cfg.Tempest.StationID, cfg.Tempest.StationName
+
+	if *fromFlag == "" {
+		fs.Usage()
+		return 2
+	}
+	now := time.Now()
+	from, err := parseTimeParam(*fromFlag, now)
+	if err != nil {
+		slog.Error("invalid -from", "value", *fromFlag, "error", err)
+		return 2
+	}
+	to, err := parseTimeParam(*toFlag, now)
+	if err != nil {
+		slog.Error("invalid -to", "value", *toFlag, "error", err)
+		return 2
+	}
+	if !from.Before(to) {
+		slog.Error("-from must be before -to")
+		return 2
+	}
+	if *interval < 0 {
+		slog.Error("-interval must not be negative")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rest := NewRESTClient(cfg.Tempest.Token, stationID, nil)
+	rest.baseURL = strings.TrimSuffix(cfg.Tempest.RESTURL, "/")
+	rest.budget = newRequestBudget(cfg.REST.RequestsPerMinute, cfg.REST.Burst)
+	if err := importHistory(ctx, newHistoryImporter(rest, deviceID, *interval), from, to, *output, stationID, stationName); err != nil {
+		slog.Error("backfill failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// importHistory runs the importer and writes the OpenMetrics file. The output
+// is written only once all pages have been fetched, so an interrupted import
+// leaves no partial file behind.
+func importHistory(ctx context.Context, h *historyImporter, from, to time.Time, output, stationID, stationName string) error {
+	spoolDir := os.TempDir()
+	if output != "-" {
+		spoolDir = filepath.Dir(output)
+	}
+	w, err := newOpenMetricsWriter(spoolDir, stationID, stationName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = w.Close() }()
+
+	slog.Info("importing history", "from", from.UTC(), "to", to.UTC(), "device_id", h.deviceID)
+	n, err := h.Run(ctx, from.Unix(), to.Unix(), w.WriteObservation)
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		_, err = w.WriteTo(os.Stdout)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".tempest-om-*")
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := w.WriteTo(tmp); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing output file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		return fmt.Errorf("replacing output file: %w", err)
+	}
+	slog.Info("wrote OpenMetrics file", "path", output, "observations", n)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func noSleep(ctx context.Context, d time.Duration) error { return ctx.Err() }
+
+func TestHistoryImporter_PagesAndDedupes(t *testing.T) {
+	srv, ranges, mu := deviceHistoryServer(t)
+	rc := NewRESTClient("test-token", "12345", nil)
+	rc.baseURL = srv.URL
+	h := newHistoryImporter(rc, "54321", 0)
+	var slept []time.Duration
+	h.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	h.interval = time.Second
+
+	from := int64(1700000000)
+	to := from + 2*86400 + 120
+	var got []int64
+	n, err := h.Run(context.Background(), from, to, func(obs Observation) error {
+		got = append(got, obs.Timestamp)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	mu.Lock()
+	pages := len(*ranges)
+	mu.Unlock()
+	if pages != 3 {
+		t.Errorf("made %d requests, want 3", pages)
+	}
+	if len(slept) != 2 || slept[0] != time.Second {
+		t.Errorf("slept %v, want interval between requests", slept)
+	}
+	if n != len(got) {
+		t.Errorf("returned %d, passed %d", n, len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Fatalf("observations not strictly increasing at %d: %d after %d", i, got[i], got[i-1])
+		}
+	}
+	if got[0] < from || got[len(got)-1] > to {
+		t.Errorf("observations %d..%d outside %d..%d", got[0], got[len(got)-1], from, to)
+	}
+}
+
+func TestHistoryImporter_RetriesRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,1]]}`))
+	}))
+	defer srv.Close()
+
+	rc := NewRESTClient("test-token", "12345", nil)
+	rc.baseURL = srv.URL
+	// The shared budget waits out Retry-After, not the importer.
+	var slept []time.Duration
+	rc.budget.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		rc.budget.mu.Lock()
+		rc.budget.pausedUntil = time.Time{}
+		rc.budget.tokens = 1
+		rc.budget.mu.Unlock()
+		return nil
+	}
+	h := newHistoryImporter(rc, "54321", 0)
+	h.sleep = func(ctx context.Context, d time.Duration) error {
+		t.Errorf("importer slept %v; rate limits are the budget's job", d)
+		return nil
+	}
+
+	n, err := h.Run(context.Background(), 1700000000, 1700000060, func(Observation) error { return nil })
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n != 1 || calls.Load() != 2 {
+		t.Errorf("imported %d in %d calls, want 1 in 2", n, calls.Load())
+	}
+	if len(slept) != 1 || slept[0] < 6*time.Second || slept[0] > 7*time.Second {
+		t.Errorf("budget slept %v, want Retry-After of 7s", slept)
+	}
+}
+
+func TestHistoryImporter_FailsOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	rc := NewRESTClient("test-token", "12345", nil)
+	rc.baseURL = srv.URL
+	h := newHistoryImporter(rc, "54321", 0)
+	h.sleep = noSleep
+
+	if _, err := h.Run(context.Background(), 1700000000, 1700000060, func(Observation) error { return nil }); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("made %d calls, want no retry on 401", calls.Load())
+	}
+}
+
+func TestImportHistory_WritesFile(t *testing.T) {
+	srv, _, _ := deviceHistoryServer(t)
+	rc := NewRESTClient("test-token", "12345", nil)
+	rc.baseURL = srv.URL
+	h := newHistoryImporter(rc, "54321", 0)
+	h.sleep = noSleep
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "tempest.om")
+	from := time.Unix(1700000000, 0)
+	if err := importHistory(context.Background(), h, from, from.Add(5*time.Minute), out, "12345", "backyard"); err != nil {
+		t.Fatalf("importHistory: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `tempest_precipitation_millimeters{station_id="12345",station_name="backyard"} 0.5 1700000040`) {
+		t.Errorf("missing rain sample:\n%s", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("dir has %d entries, want only the output file", len(entries))
+	}
+}
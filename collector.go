@@ -2,8 +2,11 @@ package main
 
 import (
 	"math"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -54,15 +57,96 @@ var (
 
 	// Health metrics
 	descUp = prometheus.NewDesc(
-		"tempest_up", "Whether the WebSocket connection is active (1=connected, 0=disconnected)", labels, nil)
+		"tempest_up", "Whether observations are arriving over the WebSocket (1=receiving, 0=disconnected or stale)", labels, nil)
 	descReconnects = prometheus.NewDesc(
 		"tempest_websocket_reconnects_total", "Total number of WebSocket reconnection attempts", labels, nil)
 	descLastObservation = prometheus.NewDesc(
 		"tempest_last_observation_timestamp_seconds", "Unix timestamp of last received observation", labels, nil)
 	descScrapeErrors = prometheus.NewDesc(
 		"tempest_scrape_errors_total", "Total errors serving /metrics", labels, nil)
+	descBackfilled = prometheus.NewDesc(
+		"tempest_backfilled_observations_total", "Total observations replayed from REST device history after gaps", labels, nil)
+	descWebSocketState = prometheus.NewDesc(
+		"tempest_websocket_state", "WebSocket client state (1 for the current state): connected, disconnected, auth_failed or config_error",
+		[]string{"station_id", "station_name", "state"}, nil)
+	descWebSocketErrors = prometheus.NewDesc(
+		"tempest_websocket_errors_total", "Total WebSocket connection failures by class: network, rate_limit, auth or config",
+		[]string{"station_id", "station_name", "class"}, nil)
+	descWebSocketDisconnects = prometheus.NewDesc(
+		"tempest_websocket_disconnects_total", "Total WebSocket connections ended by reason: dial_failed, auth, config, rate_limit, read_timeout, stale, closed or reconfigure",
+		[]string{"station_id", "station_name", "reason"}, nil)
+	descWebSocketCircuitOpen = prometheus.NewDesc(
+		"tempest_websocket_circuit_open", "Whether the WebSocket circuit breaker is open and REST polling has taken over (1=open)", labels, nil)
+	descConnectionDuration = prometheus.NewDesc(
+		"tempest_websocket_connection_duration_seconds", "How long WebSocket connections stayed open", labels, nil)
+	descFirstObservation = prometheus.NewDesc(
+		"tempest_websocket_first_observation_seconds", "Time from opening a WebSocket connection to its first obs_st", labels, nil)
+
+	// Ingest metrics
+	descMessages = prometheus.NewDesc(
+		"tempest_websocket_messages_total", "Total WebSocket messages received by type; unrecognised types count as unknown",
+		[]string{"station_id", "station_name", "type"}, nil)
+	descParseErrors = prometheus.NewDesc(
+		"tempest_websocket_parse_errors_total", "Total WebSocket messages that could not be parsed, by stage: envelope, message or fields",
+		[]string{"station_id", "station_name", "stage"}, nil)
+	descReceivedBytes = prometheus.NewDesc(
+		"tempest_websocket_received_bytes_total", "Total bytes of WebSocket messages received", labels, nil)
+	descDeliveryLatency = prometheus.NewDesc(
+		"tempest_observation_delivery_latency_seconds", "Time from an observation's timestamp to its arrival over the WebSocket", labels, nil)
+
+	// REST budget metrics
+	descRESTBudgetRemaining = prometheus.NewDesc(
+		"tempest_rest_budget_remaining", "REST requests that may be sent now without waiting for the shared rate limit budget", labels, nil)
+	descRESTThrottled = prometheus.NewDesc(
+		"tempest_rest_throttled_requests_total", "Total REST requests held back, by reason: budget (waited for the local budget) or rate_limited (answered with 429)",
+		[]string{"station_id", "station_name", "reason"}, nil)
+
+	// Forecast metrics
+	descForecastUpdated = prometheus.NewDesc(
+		"tempest_forecast_updated_timestamp_seconds", "Unix timestamp of the last successful forecast poll", labels, nil)
+	descForecastTodayHigh = prometheus.NewDesc(
+		"tempest_forecast_today_air_temperature_high_celsius", "Forecast high air temperature for the current local day in Celsius", labels, nil)
+	descForecastTodayLow = prometheus.NewDesc(
+		"tempest_forecast_today_air_temperature_low_celsius", "Forecast low air temperature for the current local day in Celsius", labels, nil)
+	descForecastTodayPrecipProbability = prometheus.NewDesc(
+		"tempest_forecast_today_precipitation_probability_percent", "Forecast chance of precipitation for the current local day", labels, nil)
+	descForecastTodayConditions = prometheus.NewDesc(
+		"tempest_forecast_today_conditions_info", "Forecast conditions for the current local day (always 1)",
+		[]string{"station_id", "station_name", "conditions", "icon"}, nil)
+	descForecastAirTemperature = prometheus.NewDesc(
+		"tempest_forecast_air_temperature_celsius", "Forecast air temperature in Celsius, by hours ahead", forecastLabels, nil)
+	descForecastPrecipProbability = prometheus.NewDesc(
+		"tempest_forecast_precipitation_probability_percent", "Forecast chance of precipitation, by hours ahead", forecastLabels, nil)
+	descForecastPrecip = prometheus.NewDesc(
+		"tempest_forecast_precipitation_millimeters", "Forecast precipitation in mm, by hours ahead", forecastLabels, nil)
+	descForecastWindAvg = prometheus.NewDesc(
+		"tempest_forecast_wind_speed_meters_per_second", "Forecast average wind speed (m/s), by hours ahead", forecastLabels, nil)
+	descForecastWindGust = prometheus.NewDesc(
+		"tempest_forecast_wind_gust_meters_per_second", "Forecast wind gust speed (m/s), by hours ahead", forecastLabels, nil)
+	descForecastWindDirection = prometheus.NewDesc(
+		"tempest_forecast_wind_direction_degrees", "Forecast wind direction in degrees, by hours ahead", forecastLabels, nil)
+	descForecastConditions = prometheus.NewDesc(
+		"tempest_forecast_conditions_info", "Forecast conditions, by hours ahead (always 1)",
+		[]string{"station_id", "station_name", "hours_ahead", "conditions", "icon"}, nil)
+)
+
+// forecastLabels label hourly forecast metrics.
+var forecastLabels = []string{"station_id", "station_name", "hours_ahead"}
+
+// restThrottleReasons lists the values of the reason label of
+// tempest_rest_throttled_requests_total.
+var restThrottleReasons = []string{"budget", "rate_limited"}
+
+// Histogram buckets in seconds.
+var (
+	connectionDurationBuckets = []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 12 * 3600, 24 * 3600, 7 * 24 * 3600}
+	firstObservationBuckets   = []float64{1, 5, 15, 30, 60, 90, 120, 300, 600}
+	deliveryLatencyBuckets    = []float64{0.5, 1, 2, 5, 10, 15, 30, 60, 120, 300, 600}
 )
 
+// webSocketStates lists the values of the tempest_websocket_state label.
+var webSocketStates = []string{"connected", "disconnected", "auth_failed", "config_error"}
+
 // allObsDescs lists all observation metric descriptors for Describe().
 var allDescs = []*prometheus.Desc{
 	descWindLull, descWindAvg, descWindGust, descWindDirection,
@@ -72,28 +156,113 @@ var allDescs = []*prometheus.Desc{
 	descLightningStrikeCount, descBattery,
 	descDewPoint, descFeelsLike, descRainStartEpoch,
 	descUp, descReconnects, descLastObservation, descScrapeErrors,
+	descBackfilled, descWebSocketState, descWebSocketErrors,
+	descWebSocketDisconnects, descWebSocketCircuitOpen,
+	descConnectionDuration, descFirstObservation,
+	descMessages, descParseErrors, descReceivedBytes, descDeliveryLatency,
+	descRESTBudgetRemaining, descRESTThrottled,
+	descForecastUpdated, descForecastTodayHigh, descForecastTodayLow,
+	descForecastTodayPrecipProbability, descForecastTodayConditions,
+	descForecastAirTemperature, descForecastPrecipProbability, descForecastPrecip,
+	descForecastWindAvg, descForecastWindGust, descForecastWindDirection,
+	descForecastConditions,
+}
+
+// histogram accumulates observations for a const histogram metric.
+type histogram struct {
+	buckets []float64
+	// counts are cumulative: counts[i] is the number of values <= buckets[i].
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) histogram {
+	return histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// metric returns the histogram as a Prometheus metric.
+func (h *histogram) metric(desc *prometheus.Desc, lv ...string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(h.buckets))
+	for i, b := range h.buckets {
+		buckets[b] = h.counts[i]
+	}
+	return prometheus.MustNewConstHistogram(desc, h.count, h.sum, buckets, lv...)
 }
 
 // Collector is a custom Prometheus collector for Tempest weather data.
 type Collector struct {
 	mu sync.RWMutex
 
-	obs       Observation
-	hasObs    bool
-	connected bool
+	obs          Observation
+	hasObs       bool
+	source       string
+	connected    bool
 	reconnects   float64
 	scrapeErrors float64
+	backfilled   float64
 	rainStart    float64
 
+	// wsFailure is the class of the auth or config error that stopped the
+	// WebSocket client from retrying quickly, and wsFailureMsg its message;
+	// both are cleared on the next successful connection.
+	wsFailure    string
+	wsFailureMsg string
+	wsErrors     map[string]float64
+	// wsDisconnects counts ended connections by reason.
+	wsDisconnects map[string]float64
+	// circuitOpen is set while the WebSocket circuit breaker is open, so
+	// the REST fallback takes over without waiting; cleared on the next
+	// successful connection.
+	circuitOpen bool
+
+	// connDuration and firstObs time WebSocket connections.
+	connDuration histogram
+	firstObs     histogram
+
+	// messages counts received messages by type, parseErrors failed ones by
+	// stage.
+	messages        map[string]float64
+	parseErrors     map[string]float64
+	receivedBytes   float64
+	deliveryLatency histogram
+
+	// restBudget, once set, is the REST client's shared request budget;
+	// restThrottled counts held-back requests by reason.
+	restBudget    *requestBudget
+	restThrottled map[string]float64
+
+	// forecast, once polled, is exported up to forecastHours ahead;
+	// forecastUpdated is when it was fetched.
+	forecast        *weatherflow.Forecast
+	forecastHours   int
+	forecastUpdated time.Time
+
 	stationID   string
 	stationName string
+
+	// observers are notified of every stored observation, outside the lock.
+	observers []func(Observation)
 }
 
 // NewCollector creates a new Tempest metrics collector.
 func NewCollector(stationID, stationName string) *Collector {
 	return &Collector{
-		stationID:   stationID,
-		stationName: stationName,
+		stationID:       stationID,
+		stationName:     stationName,
+		connDuration:    newHistogram(connectionDurationBuckets),
+		firstObs:        newHistogram(firstObservationBuckets),
+		deliveryLatency: newHistogram(deliveryLatencyBuckets),
 	}
 }
 
@@ -112,9 +281,40 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	connected := c.connected
 	reconnects := c.reconnects
 	scrapeErrors := c.scrapeErrors
+	backfilled := c.backfilled
 	rainStart := c.rainStart
 	stationID := c.stationID
 	stationName := c.stationName
+	wsFailure := c.wsFailure
+	wsErrors := make(map[string]float64, len(c.wsErrors))
+	for class, n := range c.wsErrors {
+		wsErrors[class] = n
+	}
+	wsDisconnects := make(map[string]float64, len(c.wsDisconnects))
+	for reason, n := range c.wsDisconnects {
+		wsDisconnects[reason] = n
+	}
+	circuitOpen := c.circuitOpen
+	connDuration := c.connDuration.metric(descConnectionDuration, stationID, stationName)
+	firstObs := c.firstObs.metric(descFirstObservation, stationID, stationName)
+	messages := make(map[string]float64, len(c.messages))
+	for typ, n := range c.messages {
+		messages[typ] = n
+	}
+	parseErrors := make(map[string]float64, len(c.parseErrors))
+	for stage, n := range c.parseErrors {
+		parseErrors[stage] = n
+	}
+	receivedBytes := c.receivedBytes
+	deliveryLatency := c.deliveryLatency.metric(descDeliveryLatency, stationID, stationName)
+	restBudget := c.restBudget
+	restThrottled := make(map[string]float64, len(c.restThrottled))
+	for reason, n := range c.restThrottled {
+		restThrottled[reason] = n
+	}
+	forecast := c.forecast
+	forecastHours := c.forecastHours
+	forecastUpdated := c.forecastUpdated
 	c.mu.RUnlock()
 
 	lv := []string{stationID, stationName}
@@ -127,6 +327,62 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(descUp, prometheus.GaugeValue, connVal, lv...)
 	ch <- prometheus.MustNewConstMetric(descReconnects, prometheus.CounterValue, reconnects, lv...)
 	ch <- prometheus.MustNewConstMetric(descScrapeErrors, prometheus.CounterValue, scrapeErrors, lv...)
+	ch <- prometheus.MustNewConstMetric(descBackfilled, prometheus.CounterValue, backfilled, lv...)
+
+	state := "disconnected"
+	switch {
+	case connected:
+		state = "connected"
+	case wsFailure == "auth":
+		state = "auth_failed"
+	case wsFailure == "config":
+		state = "config_error"
+	}
+	for _, s := range webSocketStates {
+		val := 0.0
+		if s == state {
+			val = 1
+		}
+		ch <- prometheus.MustNewConstMetric(descWebSocketState, prometheus.GaugeValue, val, stationID, stationName, s)
+	}
+	for _, class := range errorClasses {
+		ch <- prometheus.MustNewConstMetric(descWebSocketErrors, prometheus.CounterValue,
+			wsErrors[class.String()], stationID, stationName, class.String())
+	}
+	for _, reason := range disconnectReasons {
+		ch <- prometheus.MustNewConstMetric(descWebSocketDisconnects, prometheus.CounterValue,
+			wsDisconnects[reason], stationID, stationName, reason)
+	}
+	circuitVal := 0.0
+	if circuitOpen {
+		circuitVal = 1
+	}
+	ch <- prometheus.MustNewConstMetric(descWebSocketCircuitOpen, prometheus.GaugeValue, circuitVal, lv...)
+	ch <- connDuration
+	ch <- firstObs
+
+	// Ingest metrics
+	for _, typ := range messageTypes {
+		ch <- prometheus.MustNewConstMetric(descMessages, prometheus.CounterValue, messages[typ], stationID, stationName, typ)
+	}
+	ch <- prometheus.MustNewConstMetric(descMessages, prometheus.CounterValue, messages["unknown"], stationID, stationName, "unknown")
+	for _, stage := range parseStages {
+		ch <- prometheus.MustNewConstMetric(descParseErrors, prometheus.CounterValue, parseErrors[stage], stationID, stationName, stage)
+	}
+	ch <- prometheus.MustNewConstMetric(descReceivedBytes, prometheus.CounterValue, receivedBytes, lv...)
+	ch <- deliveryLatency
+
+	if restBudget != nil {
+		ch <- prometheus.MustNewConstMetric(descRESTBudgetRemaining, prometheus.GaugeValue, restBudget.Remaining(), lv...)
+		for _, reason := range restThrottleReasons {
+			ch <- prometheus.MustNewConstMetric(descRESTThrottled, prometheus.CounterValue, restThrottled[reason], stationID, stationName, reason)
+		}
+	}
+
+	if forecast != nil {
+		ch <- prometheus.MustNewConstMetric(descForecastUpdated, prometheus.GaugeValue, float64(forecastUpdated.Unix()), lv...)
+		forecastMetrics(ch, forecast, forecastHours, time.Now(), stationID, stationName)
+	}
 
 	if hasObs {
 		ch <- prometheus.MustNewConstMetric(descLastObservation, prometheus.GaugeValue, float64(obs.Timestamp), lv...)
@@ -170,18 +426,214 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-// UpdateObservation stores a new observation.
+// Observation sources reported by the JSON API.
+const (
+	SourceWebSocket = "websocket"
+	SourceREST      = "rest"
+)
+
+// UpdateObservation stores a new observation received over the WebSocket.
 func (c *Collector) UpdateObservation(obs Observation) {
+	c.UpdateObservationFrom(obs, SourceWebSocket)
+}
+
+// UpdateObservationFrom stores a new observation, records which source
+// delivered it, and notifies observers.
+func (c *Collector) UpdateObservationFrom(obs Observation, source string) {
 	c.mu.Lock()
 	c.obs = obs
 	c.hasObs = true
+	c.source = source
+	observers := c.observers
 	c.mu.Unlock()
+
+	for _, fn := range observers {
+		fn(obs)
+	}
 }
 
-// SetConnected updates the connection state.
+// OnObservation registers fn to be called with every observation passed to
+// UpdateObservation. Observers must not block.
+func (c *Collector) OnObservation(fn func(Observation)) {
+	c.mu.Lock()
+	c.observers = append(c.observers, fn)
+	c.mu.Unlock()
+}
+
+// HandleEvent stores observations and rain starts from the WebSocket client,
+// which it subscribes to.
+func (c *Collector) HandleEvent(ev weatherflow.Event) {
+	switch ev := ev.(type) {
+	case Observation:
+		c.UpdateObservation(ev)
+	case PrecipStart:
+		c.SetRainStart(float64(ev.Timestamp))
+	}
+}
+
+// Observation returns the latest observation and whether one has been received.
+func (c *Collector) Observation() (Observation, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.obs, c.hasObs
+}
+
+// SetStation changes the station labels. When the station ID changes, the
+// previous station's observation and rain start are dropped.
+func (c *Collector) SetStation(stationID, stationName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stationID != c.stationID {
+		c.obs = Observation{}
+		c.hasObs = false
+		c.source = ""
+		c.rainStart = 0
+	}
+	c.stationID, c.stationName = stationID, stationName
+}
+
+// SetConnected updates the connection state. Connecting clears a WebSocket
+// failure and closes the circuit breaker.
 func (c *Collector) SetConnected(connected bool) {
 	c.mu.Lock()
 	c.connected = connected
+	if connected {
+		c.wsFailure, c.wsFailureMsg = "", ""
+		c.circuitOpen = false
+	}
+	c.mu.Unlock()
+}
+
+// SetCircuitOpen records whether the WebSocket circuit breaker is open.
+func (c *Collector) SetCircuitOpen(open bool) {
+	c.mu.Lock()
+	c.circuitOpen = open
+	c.mu.Unlock()
+}
+
+// CircuitOpen reports whether the WebSocket circuit breaker is open.
+func (c *Collector) CircuitOpen() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.circuitOpen
+}
+
+// IncrDisconnects counts a WebSocket connection that ended for reason.
+func (c *Collector) IncrDisconnects(reason string) {
+	c.mu.Lock()
+	if c.wsDisconnects == nil {
+		c.wsDisconnects = make(map[string]float64)
+	}
+	c.wsDisconnects[reason]++
+	c.mu.Unlock()
+}
+
+// ObserveConnectionDuration records how long a WebSocket connection was open.
+func (c *Collector) ObserveConnectionDuration(d time.Duration) {
+	c.mu.Lock()
+	c.connDuration.observe(d.Seconds())
+	c.mu.Unlock()
+}
+
+// ObserveFirstObservation records how long a connection took to deliver
+// its first observation.
+func (c *Collector) ObserveFirstObservation(d time.Duration) {
+	c.mu.Lock()
+	c.firstObs.observe(d.Seconds())
+	c.mu.Unlock()
+}
+
+// SetWebSocketFailure records that the WebSocket client stopped retrying
+// quickly because of an error of the given class ("auth" or "config").
+func (c *Collector) SetWebSocketFailure(class, msg string) {
+	c.mu.Lock()
+	c.wsFailure, c.wsFailureMsg = class, msg
+	c.mu.Unlock()
+}
+
+// WebSocketFailure returns the class and message of the current WebSocket
+// failure, or empty strings if there is none.
+func (c *Collector) WebSocketFailure() (class, msg string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.wsFailure, c.wsFailureMsg
+}
+
+// IncrWebSocketErrors counts a WebSocket connection failure of the given class.
+func (c *Collector) IncrWebSocketErrors(class string) {
+	c.mu.Lock()
+	if c.wsErrors == nil {
+		c.wsErrors = make(map[string]float64)
+	}
+	c.wsErrors[class]++
+	c.mu.Unlock()
+}
+
+// IncrMessages counts a received message of the given type. Types not in
+// messageTypes are counted as unknown.
+func (c *Collector) IncrMessages(msgType string) {
+	if !slices.Contains(messageTypes, msgType) {
+		msgType = "unknown"
+	}
+	c.mu.Lock()
+	if c.messages == nil {
+		c.messages = make(map[string]float64)
+	}
+	c.messages[msgType]++
+	c.mu.Unlock()
+}
+
+// IncrParseErrors counts a message that could not be parsed at stage.
+func (c *Collector) IncrParseErrors(stage string) {
+	c.mu.Lock()
+	if c.parseErrors == nil {
+		c.parseErrors = make(map[string]float64)
+	}
+	c.parseErrors[stage]++
+	c.mu.Unlock()
+}
+
+// AddReceivedBytes adds n to the count of bytes received.
+func (c *Collector) AddReceivedBytes(n int) {
+	c.mu.Lock()
+	c.receivedBytes += float64(n)
+	c.mu.Unlock()
+}
+
+// ObserveDeliveryLatency records how long after its timestamp an observation
+// arrived. Negative values, from clock skew, count as zero.
+func (c *Collector) ObserveDeliveryLatency(d time.Duration) {
+	c.mu.Lock()
+	c.deliveryLatency.observe(max(d.Seconds(), 0))
+	c.mu.Unlock()
+}
+
+// SetRESTBudget exports the remaining requests of the REST client's budget
+// along with the throttled request counter.
+func (c *Collector) SetRESTBudget(b *requestBudget) {
+	c.mu.Lock()
+	c.restBudget = b
+	c.mu.Unlock()
+}
+
+// IncrRESTThrottled counts a REST request held back for reason: "budget"
+// or "rate_limited".
+func (c *Collector) IncrRESTThrottled(reason string) {
+	c.mu.Lock()
+	if c.restThrottled == nil {
+		c.restThrottled = make(map[string]float64)
+	}
+	c.restThrottled[reason]++
+	c.mu.Unlock()
+}
+
+// SetForecast replaces the exported forecast with f, of which hours of the
+// hourly forecast are exported. The forecast is never modified.
+func (c *Collector) SetForecast(f *weatherflow.Forecast, hours int) {
+	c.mu.Lock()
+	c.forecast = f
+	c.forecastHours = hours
+	c.forecastUpdated = time.Now()
 	c.mu.Unlock()
 }
 
@@ -206,6 +658,59 @@ func (c *Collector) IncrScrapeErrors() {
 	c.mu.Unlock()
 }
 
+// CollectorState is a point-in-time copy of the collector's state.
+type CollectorState struct {
+	StationID    string
+	StationName  string
+	Observation  Observation
+	HasObs       bool
+	Source       string
+	Connected    bool
+	Reconnects   float64
+	ScrapeErrors float64
+	RainStart    float64
+}
+
+// State returns a consistent snapshot of the collector's state.
+func (c *Collector) State() CollectorState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return CollectorState{
+		StationID:    c.stationID,
+		StationName:  c.stationName,
+		Observation:  c.obs,
+		HasObs:       c.hasObs,
+		Source:       c.source,
+		Connected:    c.connected,
+		Reconnects:   c.reconnects,
+		ScrapeErrors: c.scrapeErrors,
+		RainStart:    c.rainStart,
+	}
+}
+
+// Restore loads counters, the rain start epoch and (if s.HasObs) the last
+// observation from a saved state. Observers are not notified and the
+// connection state is left unchanged.
+func (c *Collector) Restore(s CollectorState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnects = s.Reconnects
+	c.scrapeErrors = s.ScrapeErrors
+	c.rainStart = s.RainStart
+	if s.HasObs {
+		c.obs = s.Observation
+		c.hasObs = true
+		c.source = s.Source
+	}
+}
+
+// AddBackfilled adds n to the count of observations replayed by backfill.
+func (c *Collector) AddBackfilled(n int) {
+	c.mu.Lock()
+	c.backfilled += float64(n)
+	c.mu.Unlock()
+}
+
 // HasObservation returns whether at least one observation has been received.
 func (c *Collector) HasObservation() bool {
 	c.mu.RLock()
@@ -3,6 +3,7 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -66,6 +67,7 @@ func TestCollector_AllMetricsPresent(t *testing.T) {
 		"tempest_websocket_reconnects_total":           false,
 		"tempest_last_observation_timestamp_seconds":   false,
 		"tempest_scrape_errors_total":                  false,
+		"tempest_backfilled_observations_total":        false,
 	}
 
 	for _, mf := range mfs {
@@ -110,7 +112,7 @@ func TestCollector_UpMetric(t *testing.T) {
 
 	// Default: disconnected
 	expected := `
-		# HELP tempest_up Whether the WebSocket connection is active (1=connected, 0=disconnected)
+		# HELP tempest_up Whether observations are arriving over the WebSocket (1=receiving, 0=disconnected or stale)
 		# TYPE tempest_up gauge
 		tempest_up{station_id="12345",station_name="backyard"} 0
 	`
@@ -121,7 +123,7 @@ func TestCollector_UpMetric(t *testing.T) {
 	// Connected
 	c.SetConnected(true)
 	expected = `
-		# HELP tempest_up Whether the WebSocket connection is active (1=connected, 0=disconnected)
+		# HELP tempest_up Whether observations are arriving over the WebSocket (1=receiving, 0=disconnected or stale)
 		# TYPE tempest_up gauge
 		tempest_up{station_id="12345",station_name="backyard"} 1
 	`
@@ -194,7 +196,12 @@ func TestCollector_NoMetricsBeforeObservation(t *testing.T) {
 	for _, mf := range mfs {
 		name := mf.GetName()
 		switch name {
-		case "tempest_up", "tempest_websocket_reconnects_total", "tempest_scrape_errors_total":
+		case "tempest_up", "tempest_websocket_reconnects_total", "tempest_scrape_errors_total",
+			"tempest_backfilled_observations_total", "tempest_websocket_state", "tempest_websocket_errors_total",
+			"tempest_websocket_disconnects_total", "tempest_websocket_circuit_open",
+			"tempest_websocket_connection_duration_seconds", "tempest_websocket_first_observation_seconds",
+			"tempest_websocket_messages_total", "tempest_websocket_parse_errors_total",
+			"tempest_websocket_received_bytes_total", "tempest_observation_delivery_latency_seconds":
 			// expected health metrics always emitted
 		default:
 			t.Errorf("unexpected metric before observation: %s", name)
@@ -214,21 +221,42 @@ func TestCollector_Labels(t *testing.T) {
 		name := mf.GetName()
 		// All metrics should now have station labels
 		for _, m := range mf.GetMetric() {
-			labels := m.GetLabel()
-			if len(labels) != 2 {
-				t.Errorf("%s: expected 2 labels, got %d", name, len(labels))
-				continue
+			got := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				got[l.GetName()] = l.GetValue()
 			}
-			if labels[0].GetName() != "station_id" || labels[0].GetValue() != "12345" {
-				t.Errorf("%s: bad station_id label: %v", name, labels[0])
+			if got["station_id"] != "12345" {
+				t.Errorf("%s: bad station_id label: %v", name, got)
 			}
-			if labels[1].GetName() != "station_name" || labels[1].GetValue() != "backyard" {
-				t.Errorf("%s: bad station_name label: %v", name, labels[1])
+			if got["station_name"] != "backyard" {
+				t.Errorf("%s: bad station_name label: %v", name, got)
 			}
 		}
 	}
 }
 
+func TestCollector_SetStation(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	c.UpdateObservation(testObservation())
+	c.SetRainStart(1700000000)
+
+	c.SetStation("12345", "garden")
+	if !c.HasObservation() {
+		t.Error("renaming the station dropped the observation")
+	}
+	if st := c.State(); st.StationName != "garden" || st.RainStart != 1700000000 {
+		t.Errorf("state = %+v, want new name and kept rain start", st)
+	}
+
+	c.SetStation("67890", "roof")
+	if c.HasObservation() {
+		t.Error("observation from the previous station kept")
+	}
+	if st := c.State(); st.StationID != "67890" || st.StationName != "roof" || st.RainStart != 0 {
+		t.Errorf("state = %+v", st)
+	}
+}
+
 func TestCollector_IncrReconnects(t *testing.T) {
 	c := NewCollector("12345", "backyard")
 
@@ -317,3 +345,165 @@ func TestCollector_ScrapeErrorsMetric(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCollector_WebSocketState(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	c.IncrWebSocketErrors("auth")
+	c.IncrWebSocketErrors("network")
+	c.IncrWebSocketErrors("network")
+	c.SetWebSocketFailure("auth", "rejected")
+
+	expected := `
+# HELP tempest_websocket_state WebSocket client state (1 for the current state): connected, disconnected, auth_failed or config_error
+# TYPE tempest_websocket_state gauge
+tempest_websocket_state{state="auth_failed",station_id="12345",station_name="backyard"} 1
+tempest_websocket_state{state="config_error",station_id="12345",station_name="backyard"} 0
+tempest_websocket_state{state="connected",station_id="12345",station_name="backyard"} 0
+tempest_websocket_state{state="disconnected",station_id="12345",station_name="backyard"} 0
+# HELP tempest_websocket_errors_total Total WebSocket connection failures by class: network, rate_limit, auth or config
+# TYPE tempest_websocket_errors_total counter
+tempest_websocket_errors_total{class="auth",station_id="12345",station_name="backyard"} 1
+tempest_websocket_errors_total{class="config",station_id="12345",station_name="backyard"} 0
+tempest_websocket_errors_total{class="network",station_id="12345",station_name="backyard"} 2
+tempest_websocket_errors_total{class="rate_limit",station_id="12345",station_name="backyard"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"tempest_websocket_state", "tempest_websocket_errors_total"); err != nil {
+		t.Error(err)
+	}
+
+	c.SetConnected(true)
+	if class, _ := c.WebSocketFailure(); class != "" {
+		t.Errorf("failure %q not cleared by connecting", class)
+	}
+}
+
+func TestCollector_ConnectionMetrics(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	c.IncrDisconnects("stale")
+	c.IncrDisconnects("closed")
+	c.IncrDisconnects("closed")
+	c.ObserveConnectionDuration(30 * time.Second)
+	c.ObserveConnectionDuration(2 * time.Hour)
+	c.ObserveFirstObservation(4 * time.Second)
+	c.SetCircuitOpen(true)
+
+	expected := `
+# HELP tempest_websocket_disconnects_total Total WebSocket connections ended by reason: dial_failed, auth, config, rate_limit, read_timeout, stale, closed or reconfigure
+# TYPE tempest_websocket_disconnects_total counter
+tempest_websocket_disconnects_total{reason="auth",station_id="12345",station_name="backyard"} 0
+tempest_websocket_disconnects_total{reason="closed",station_id="12345",station_name="backyard"} 2
+tempest_websocket_disconnects_total{reason="config",station_id="12345",station_name="backyard"} 0
+tempest_websocket_disconnects_total{reason="dial_failed",station_id="12345",station_name="backyard"} 0
+tempest_websocket_disconnects_total{reason="rate_limit",station_id="12345",station_name="backyard"} 0
+tempest_websocket_disconnects_total{reason="read_timeout",station_id="12345",station_name="backyard"} 0
+tempest_websocket_disconnects_total{reason="reconfigure",station_id="12345",station_name="backyard"} 0
+tempest_websocket_disconnects_total{reason="stale",station_id="12345",station_name="backyard"} 1
+# HELP tempest_websocket_circuit_open Whether the WebSocket circuit breaker is open and REST polling has taken over (1=open)
+# TYPE tempest_websocket_circuit_open gauge
+tempest_websocket_circuit_open{station_id="12345",station_name="backyard"} 1
+# HELP tempest_websocket_first_observation_seconds Time from opening a WebSocket connection to its first obs_st
+# TYPE tempest_websocket_first_observation_seconds histogram
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="1"} 0
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="5"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="15"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="30"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="60"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="90"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="120"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="300"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="600"} 1
+tempest_websocket_first_observation_seconds_bucket{station_id="12345",station_name="backyard",le="+Inf"} 1
+tempest_websocket_first_observation_seconds_sum{station_id="12345",station_name="backyard"} 4
+tempest_websocket_first_observation_seconds_count{station_id="12345",station_name="backyard"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"tempest_websocket_disconnects_total", "tempest_websocket_circuit_open",
+		"tempest_websocket_first_observation_seconds"); err != nil {
+		t.Error(err)
+	}
+
+	h := c.connDuration
+	if h.count != 2 || h.sum != 30+7200 {
+		t.Errorf("connection durations: count %d sum %g, want 2 and 7230", h.count, h.sum)
+	}
+	// 30s falls in le=60 and above; 2h in le=14400 and above.
+	for i, b := range h.buckets {
+		var want uint64
+		if b >= 60 {
+			want++
+		}
+		if b >= 4*3600 {
+			want++
+		}
+		if h.counts[i] != want {
+			t.Errorf("bucket le=%g: %d, want %d", b, h.counts[i], want)
+		}
+	}
+
+	c.SetConnected(true)
+	if c.CircuitOpen() {
+		t.Error("circuit breaker not closed by connecting")
+	}
+}
+
+func TestCollector_HandleEvent(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	c.HandleEvent(Strike{Timestamp: 1700000000, Distance: 5})
+	if c.HasObservation() {
+		t.Fatal("strike stored as an observation")
+	}
+
+	c.HandleEvent(testObservation())
+	if obs, ok := c.Observation(); !ok || obs.AirTemperature != testObservation().AirTemperature {
+		t.Errorf("observation = %+v, %v; want the handled observation", obs, ok)
+	}
+	c.HandleEvent(PrecipStart{Timestamp: 1700000060})
+	if st := c.State(); st.RainStart != 1700000060 {
+		t.Errorf("rain start = %v, want 1700000060", st.RainStart)
+	}
+}
+
+func TestCollector_IngestMetrics(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	c.IncrMessages("obs_st")
+	c.IncrMessages("hub_status")
+	c.IncrMessages("obs_air")
+	c.IncrParseErrors(stageFields)
+	c.AddReceivedBytes(100)
+	c.AddReceivedBytes(23)
+	c.ObserveDeliveryLatency(-2 * time.Second)
+
+	expected := `
+# HELP tempest_websocket_messages_total Total WebSocket messages received by type; unrecognised types count as unknown
+# TYPE tempest_websocket_messages_total counter
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="ack"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="connection_opened"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="device_status"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="evt_device_offline"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="evt_device_online"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="evt_precip"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="evt_strike"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="obs_st"} 1
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="rapid_wind"} 0
+tempest_websocket_messages_total{station_id="12345",station_name="backyard",type="unknown"} 2
+# HELP tempest_websocket_parse_errors_total Total WebSocket messages that could not be parsed, by stage: envelope, message or fields
+# TYPE tempest_websocket_parse_errors_total counter
+tempest_websocket_parse_errors_total{stage="envelope",station_id="12345",station_name="backyard"} 0
+tempest_websocket_parse_errors_total{stage="fields",station_id="12345",station_name="backyard"} 1
+tempest_websocket_parse_errors_total{stage="message",station_id="12345",station_name="backyard"} 0
+# HELP tempest_websocket_received_bytes_total Total bytes of WebSocket messages received
+# TYPE tempest_websocket_received_bytes_total counter
+tempest_websocket_received_bytes_total{station_id="12345",station_name="backyard"} 123
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"tempest_websocket_messages_total", "tempest_websocket_parse_errors_total",
+		"tempest_websocket_received_bytes_total"); err != nil {
+		t.Error(err)
+	}
+
+	// Clock skew can make latency negative; it counts as zero.
+	if h := c.deliveryLatency; h.count != 1 || h.sum != 0 || h.counts[0] != 1 {
+		t.Errorf("delivery latency: count %d sum %g first bucket %d, want 1, 0, 1", h.count, h.sum, h.counts[0])
+	}
+}
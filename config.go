@@ -0,0 +1,818 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the exporter. It is built in layers, each
+// overriding the last: defaults, the config file, environment variables and
+// command-line flags. See config.example.yaml for a documented file.
+type Config struct {
+	Tempest   TempestConfig   `yaml:"tempest" toml:"tempest"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	WebSocket WebSocketConfig `yaml:"websocket" toml:"websocket"`
+	Fallback  FallbackConfig  `yaml:"fallback" toml:"fallback"`
+	REST      RESTConfig      `yaml:"rest" toml:"rest"`
+	State     StateConfig     `yaml:"state" toml:"state"`
+	History   HistoryConfig   `yaml:"history" toml:"history"`
+	Backfill  BackfillConfig  `yaml:"backfill" toml:"backfill"`
+	Proxy     ProxyConfig     `yaml:"proxy" toml:"proxy"`
+	RESTCache RESTCacheConfig `yaml:"rest_cache" toml:"rest_cache"`
+	Record    RecordConfig    `yaml:"record" toml:"record"`
+	Replay    ReplayConfig    `yaml:"replay" toml:"replay"`
+	CWOP      CWOPConfig      `yaml:"cwop" toml:"cwop"`
+	Forecast  ForecastConfig  `yaml:"forecast" toml:"forecast"`
+	Reload    ReloadConfig    `yaml:"reload" toml:"reload"`
+	OAuth     OAuthConfig     `yaml:"oauth" toml:"oauth"`
+
+	// source is the file the configuration was loaded from, if any.
+	source string
+}
+
+// TempestConfig identifies the station and the WeatherFlow endpoints.
+type TempestConfig struct {
+	Token string `yaml:"token" toml:"token"`
+	// TokenFile, when set, replaces Token with the file's contents.
+	TokenFile   string `yaml:"token_file" toml:"token_file"`
+	DeviceID    string `yaml:"device_id" toml:"device_id"`
+	StationID   string `yaml:"station_id" toml:"station_id"`
+	StationName string `yaml:"station_name" toml:"station_name"`
+	WSURL       string `yaml:"ws_url" toml:"ws_url"`
+	RESTURL     string `yaml:"rest_url" toml:"rest_url"`
+	RapidWind   bool   `yaml:"rapid_wind" toml:"rapid_wind"`
+}
+
+// ServerConfig controls the HTTP server.
+type ServerConfig struct {
+	ListenAddr        string        `yaml:"listen_addr" toml:"listen_addr"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// LogConfig controls logging.
+type LogConfig struct {
+	Format string `yaml:"format" toml:"format"`
+}
+
+// WebSocketConfig controls the upstream WebSocket connection.
+type WebSocketConfig struct {
+	ReadTimeout time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	// MinBackoff and MaxBackoff bound the jittered reconnect delay, which
+	// starts over after a connection stays up for BackoffReset.
+	MinBackoff   time.Duration `yaml:"min_backoff" toml:"min_backoff"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	BackoffReset time.Duration `yaml:"backoff_reset" toml:"backoff_reset"`
+	// BreakerFailures connections in a row without an observation open the
+	// circuit breaker, which hands over to REST polling and pauses
+	// reconnecting for BreakerCooldown; 0 disables it.
+	BreakerFailures int           `yaml:"breaker_failures" toml:"breaker_failures"`
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown"`
+	// TokenInURL sends the token as the token query parameter, the only
+	// form WeatherFlow documents for the WebSocket; false sends an
+	// Authorization header instead.
+	TokenInURL bool `yaml:"token_in_url" toml:"token_in_url"`
+	// FatalRetryInterval is the delay between attempts after the token or
+	// settings were rejected; 0 retries only after a reload.
+	FatalRetryInterval time.Duration `yaml:"fatal_retry_interval" toml:"fatal_retry_interval"`
+	// AckTimeout is how long to wait for the listen_start ack before
+	// subscribing again, and then before reconnecting.
+	AckTimeout time.Duration `yaml:"ack_timeout" toml:"ack_timeout"`
+	// StaleIntervals is how many device report intervals may pass without an
+	// observation before resubscribing; after twice as many the client
+	// reconnects.
+	StaleIntervals int `yaml:"stale_intervals" toml:"stale_intervals"`
+}
+
+// FallbackConfig controls REST polling while the WebSocket is down.
+type FallbackConfig struct {
+	Threshold    time.Duration `yaml:"threshold" toml:"threshold"`
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+}
+
+// RESTConfig sets the request budget shared by every REST API caller.
+type RESTConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute" toml:"requests_per_minute"`
+	Burst             int `yaml:"burst" toml:"burst"`
+}
+
+// StateConfig controls the state file.
+type StateConfig struct {
+	Path     string        `yaml:"path" toml:"path"`
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+	MaxAge   time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// HistoryConfig controls the on-disk history store.
+type HistoryConfig struct {
+	Path      string        `yaml:"path" toml:"path"`
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+// BackfillConfig controls gap backfill from the REST device history.
+type BackfillConfig struct {
+	Enabled   bool          `yaml:"enabled" toml:"enabled"`
+	Threshold time.Duration `yaml:"threshold" toml:"threshold"`
+	MaxAge    time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// ProxyConfig controls the local WebSocket proxy.
+type ProxyConfig struct {
+	Enabled    bool `yaml:"enabled" toml:"enabled"`
+	MaxClients int  `yaml:"max_clients" toml:"max_clients"`
+}
+
+// RESTCacheConfig controls the local REST endpoints.
+type RESTCacheConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+}
+
+// RecordConfig controls recording of upstream messages.
+type RecordConfig struct {
+	Path     string `yaml:"path" toml:"path"`
+	MaxMB    int    `yaml:"max_mb" toml:"max_mb"`
+	MaxFiles int    `yaml:"max_files" toml:"max_files"`
+}
+
+// ReplayConfig replays recordings instead of connecting upstream.
+type ReplayConfig struct {
+	Paths []string `yaml:"paths" toml:"paths"`
+	Speed float64  `yaml:"speed" toml:"speed"`
+}
+
+// CWOPConfig controls CWOP uploads. The position is either fully set or nil,
+// in which case it is looked up from the REST /stations endpoint.
+type CWOPConfig struct {
+	Callsign string `yaml:"callsign" toml:"callsign"`
+	Passcode string `yaml:"passcode" toml:"passcode"`
+	// PasscodeFile, when set, replaces Passcode with the file's contents.
+	PasscodeFile string        `yaml:"passcode_file" toml:"passcode_file"`
+	Server       string        `yaml:"server" toml:"server"`
+	Interval     time.Duration `yaml:"interval" toml:"interval"`
+	Latitude     *float64      `yaml:"latitude" toml:"latitude"`
+	Longitude    *float64      `yaml:"longitude" toml:"longitude"`
+	Elevation    *float64      `yaml:"elevation" toml:"elevation"`
+	// Timezone is the IANA name of the zone whose midnight resets the
+	// daily rain total, for CWOP and the JSON API alike; empty uses the
+	// station's zone from /stations.
+	Timezone string `yaml:"timezone" toml:"timezone"`
+}
+
+// ForecastConfig controls the better_forecast poller.
+type ForecastConfig struct {
+	Enabled  bool          `yaml:"enabled" toml:"enabled"`
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+	// Hours is how many hours ahead of the hourly forecast are exported.
+	Hours int `yaml:"hours" toml:"hours"`
+}
+
+// ReloadConfig controls reloading on SIGHUP or file change.
+type ReloadConfig struct {
+	// WatchInterval is how often the config and token files are checked for
+	// changes; 0 reloads only on SIGHUP.
+	WatchInterval time.Duration `yaml:"watch_interval" toml:"watch_interval"`
+}
+
+// OAuthConfig configures WeatherFlow's OAuth authorization-code flow, an
+// alternative to a personal access token. Setting TokenPath enables it.
+type OAuthConfig struct {
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret"`
+	// ClientSecretFile, when set, replaces ClientSecret with the file's contents.
+	ClientSecretFile string `yaml:"client_secret_file" toml:"client_secret_file"`
+	// RedirectURL is registered with the client; "oauth login" listens on it.
+	RedirectURL string `yaml:"redirect_url" toml:"redirect_url"`
+	AuthURL     string `yaml:"auth_url" toml:"auth_url"`
+	TokenURL    string `yaml:"token_url" toml:"token_url"`
+	// TokenPath stores the access and refresh tokens written by "oauth
+	// login" and renewed by the exporter.
+	TokenPath string `yaml:"token_path" toml:"token_path"`
+}
+
+// defaultConfig returns the built-in defaults.
+func defaultConfig() *Config {
+	return &Config{
+		Tempest: TempestConfig{
+			StationName: "tempest",
+			WSURL:       defaultWSURL,
+			RESTURL:     defaultBaseURL,
+		},
+		Server: ServerConfig{
+			ListenAddr:        ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+		},
+		Log: LogConfig{Format: "json"},
+		WebSocket: WebSocketConfig{
+			ReadTimeout:        defaultReadTimeout,
+			MinBackoff:         defaultMinBackoff,
+			MaxBackoff:         defaultMaxBackoff,
+			BackoffReset:       defaultBackoffReset,
+			BreakerFailures:    defaultBreakerFailures,
+			BreakerCooldown:    defaultBreakerCooldown,
+			FatalRetryInterval: defaultFatalRetryInterval,
+			AckTimeout:         defaultAckTimeout,
+			StaleIntervals:     defaultStaleIntervals,
+			TokenInURL:         true,
+		},
+		Fallback: FallbackConfig{Threshold: 5 * time.Minute, PollInterval: 60 * time.Second},
+		REST:     RESTConfig{RequestsPerMinute: defaultRESTRequestsPerMinute, Burst: defaultRESTBurst},
+		State:    StateConfig{Interval: time.Minute, MaxAge: 10 * time.Minute},
+		History:  HistoryConfig{Retention: 30 * 24 * time.Hour},
+		Backfill: BackfillConfig{Threshold: defaultBackfillThreshold, MaxAge: 24 * time.Hour},
+		Proxy:    ProxyConfig{MaxClients: 16},
+		Record:   RecordConfig{MaxMB: 100, MaxFiles: 5},
+		Replay:   ReplayConfig{Speed: 1},
+		CWOP:     CWOPConfig{Passcode: "-1", Server: defaultAPRSServer, Interval: 10 * time.Minute},
+		Forecast: ForecastConfig{Interval: defaultForecastInterval, Hours: defaultForecastHours},
+		Reload:   ReloadConfig{WatchInterval: 30 * time.Second},
+		OAuth: OAuthConfig{
+			RedirectURL: defaultOAuthRedirectURL,
+			AuthURL:     defaultOAuthAuthURL,
+			TokenURL:    defaultOAuthTokenURL,
+		},
+	}
+}
+
+// setting maps a config file key, which is also its flag name, to an
+// environment variable.
+type setting struct {
+	key   string
+	env   string
+	usage string
+}
+
+// settings lists every setting that can be given as a flag or environment
+// variable, in the order they are documented.
+var settings = []setting{
+	{"tempest.token", "TEMPEST_TOKEN", "WeatherFlow API token"},
+	{"tempest.token_file", "TEMPEST_TOKEN_FILE", "file containing the API token, re-read on reload"},
+	{"tempest.device_id", "TEMPEST_DEVICE_ID", "device ID for the WebSocket subscription"},
+	{"tempest.station_id", "TEMPEST_STATION_ID", "station ID for REST requests"},
+	{"tempest.station_name", "TEMPEST_STATION_NAME", "station_name metric label"},
+	{"tempest.ws_url", "TEMPEST_WS_URL", "WebSocket endpoint"},
+	{"tempest.rest_url", "TEMPEST_REST_URL", "REST API base URL"},
+	{"tempest.rapid_wind", "TEMPEST_RAPID_WIND", "subscribe to 3-second rapid wind samples"},
+	{"server.listen_addr", "LISTEN_ADDR", "HTTP listen address"},
+	{"server.read_header_timeout", "", "HTTP read header timeout"},
+	{"server.read_timeout", "", "HTTP read timeout"},
+	{"server.write_timeout", "", "HTTP write timeout"},
+	{"server.idle_timeout", "", "HTTP keep-alive idle timeout"},
+	{"server.shutdown_timeout", "", "time allowed for graceful shutdown"},
+	{"log.format", "LOG_FORMAT", "log format: json or text"},
+	{"websocket.read_timeout", "", "reconnect if no WebSocket message arrives for this long"},
+	{"websocket.min_backoff", "", "ceiling of the first jittered WebSocket reconnect delay"},
+	{"websocket.max_backoff", "", "maximum WebSocket reconnect delay"},
+	{"websocket.backoff_reset", "", "connection uptime after which the reconnect delay starts over"},
+	{"websocket.breaker_failures", "", "connections in a row without an observation before REST takes over; 0 disables"},
+	{"websocket.breaker_cooldown", "", "pause before reconnecting once the circuit breaker is open"},
+	{"websocket.fatal_retry_interval", "", "delay between attempts after the token or settings were rejected; 0 waits for a reload"},
+	{"websocket.ack_timeout", "", "resubscribe, then reconnect, if listen_start isn't acknowledged within this"},
+	{"websocket.stale_intervals", "", "report intervals without an observation before resubscribing; twice as many reconnect"},
+	{"websocket.token_in_url", "", "send the WebSocket token as the documented token query parameter; false sends an Authorization header"},
+	{"fallback.threshold", "", "start REST polling after the WebSocket is down this long"},
+	{"fallback.poll_interval", "", "REST polling interval while the WebSocket is down"},
+	{"rest.requests_per_minute", "", "REST requests per minute shared by every caller"},
+	{"rest.burst", "", "REST requests that may be sent back to back"},
+	{"state.path", "STATE_PATH", "state file; enables persistence across restarts"},
+	{"state.interval", "STATE_INTERVAL", "how often the state file is written"},
+	{"state.max_age", "STATE_MAX_AGE", "oldest saved observation restored as current"},
+	{"history.path", "HISTORY_PATH", "history database; enables the store"},
+	{"history.retention", "HISTORY_RETENTION", "how long history is kept"},
+	{"backfill.enabled", "BACKFILL_ENABLED", "backfill missed minutes from the REST device history"},
+	{"backfill.threshold", "", "shortest gap between observations that is backfilled"},
+	{"backfill.max_age", "BACKFILL_MAX_AGE", "how far back a single gap is backfilled"},
+	{"proxy.enabled", "WS_PROXY_ENABLED", "serve the local WebSocket proxy"},
+	{"proxy.max_clients", "WS_PROXY_MAX_CLIENTS", "maximum concurrent proxy clients"},
+	{"rest_cache.enabled", "REST_CACHE_ENABLED", "serve the local REST endpoints"},
+	{"record.path", "RECORD_PATH", "recording file; enables recording"},
+	{"record.max_mb", "RECORD_MAX_MB", "size in MB at which the recording is rotated"},
+	{"record.max_files", "RECORD_MAX_FILES", "rotated recordings to keep"},
+	{"replay.paths", "REPLAY_PATH", "comma-separated recordings to replay instead of connecting upstream"},
+	{"replay.speed", "REPLAY_SPEED", "replay speed multiplier; 0 is as fast as possible"},
+	{"cwop.callsign", "CWOP_CALLSIGN", "CWOP station ID or callsign; enables uploads"},
+	{"cwop.passcode", "CWOP_PASSCODE", "APRS-IS passcode"},
+	{"cwop.passcode_file", "CWOP_PASSCODE_FILE", "file containing the APRS-IS passcode"},
+	{"cwop.server", "CWOP_SERVER", "APRS-IS server"},
+	{"cwop.interval", "CWOP_INTERVAL", "CWOP upload interval"},
+	{"cwop.latitude", "CWOP_LATITUDE", "station latitude in decimal degrees"},
+	{"cwop.longitude", "CWOP_LONGITUDE", "station longitude in decimal degrees"},
+	{"cwop.elevation", "CWOP_ELEVATION", "station elevation in meters"},
+	{"cwop.timezone", "CWOP_TIMEZONE", "IANA time zone for the rain since midnight total (CWOP and the JSON API)"},
+	{"forecast.enabled", "FORECAST_ENABLED", "export the better_forecast forecast as metrics"},
+	{"forecast.interval", "FORECAST_INTERVAL", "how often the forecast is fetched"},
+	{"forecast.hours", "FORECAST_HOURS", "hours of the hourly forecast exported"},
+	{"reload.watch_interval", "", "how often to check the config and secret files for changes; 0 disables"},
+	{"oauth.client_id", "OAUTH_CLIENT_ID", "OAuth client ID"},
+	{"oauth.client_secret", "OAUTH_CLIENT_SECRET", "OAuth client secret"},
+	{"oauth.client_secret_file", "OAUTH_CLIENT_SECRET_FILE", "file containing the OAuth client secret"},
+	{"oauth.redirect_url", "OAUTH_REDIRECT_URL", "OAuth redirect URL registered for the client"},
+	{"oauth.auth_url", "", "OAuth authorization endpoint"},
+	{"oauth.token_url", "", "OAuth token endpoint"},
+	{"oauth.token_path", "OAUTH_TOKEN_PATH", "OAuth token store; enables OAuth instead of tempest.token"},
+}
+
+// values returns a flag.Value bound to each setting's field, keyed by setting.
+func (c *Config) values() map[string]flag.Value {
+	return map[string]flag.Value{
+		"tempest.token":                  (*stringValue)(&c.Tempest.Token),
+		"tempest.token_file":             (*stringValue)(&c.Tempest.TokenFile),
+		"tempest.device_id":              (*stringValue)(&c.Tempest.DeviceID),
+		"tempest.station_id":             (*stringValue)(&c.Tempest.StationID),
+		"tempest.station_name":           (*stringValue)(&c.Tempest.StationName),
+		"tempest.ws_url":                 (*stringValue)(&c.Tempest.WSURL),
+		"tempest.rest_url":               (*stringValue)(&c.Tempest.RESTURL),
+		"tempest.rapid_wind":             (*boolValue)(&c.Tempest.RapidWind),
+		"server.listen_addr":             (*stringValue)(&c.Server.ListenAddr),
+		"server.read_header_timeout":     (*durationValue)(&c.Server.ReadHeaderTimeout),
+		"server.read_timeout":            (*durationValue)(&c.Server.ReadTimeout),
+		"server.write_timeout":           (*durationValue)(&c.Server.WriteTimeout),
+		"server.idle_timeout":            (*durationValue)(&c.Server.IdleTimeout),
+		"server.shutdown_timeout":        (*durationValue)(&c.Server.ShutdownTimeout),
+		"log.format":                     (*stringValue)(&c.Log.Format),
+		"websocket.read_timeout":         (*durationValue)(&c.WebSocket.ReadTimeout),
+		"websocket.min_backoff":          (*durationValue)(&c.WebSocket.MinBackoff),
+		"websocket.max_backoff":          (*durationValue)(&c.WebSocket.MaxBackoff),
+		"websocket.backoff_reset":        (*durationValue)(&c.WebSocket.BackoffReset),
+		"websocket.breaker_failures":     (*intValue)(&c.WebSocket.BreakerFailures),
+		"websocket.breaker_cooldown":     (*durationValue)(&c.WebSocket.BreakerCooldown),
+		"websocket.token_in_url":         (*boolValue)(&c.WebSocket.TokenInURL),
+		"websocket.ack_timeout":          (*durationValue)(&c.WebSocket.AckTimeout),
+		"websocket.stale_intervals":      (*intValue)(&c.WebSocket.StaleIntervals),
+		"websocket.fatal_retry_interval": (*durationValue)(&c.WebSocket.FatalRetryInterval),
+		"fallback.threshold":             (*durationValue)(&c.Fallback.Threshold),
+		"fallback.poll_interval":         (*durationValue)(&c.Fallback.PollInterval),
+		"rest.requests_per_minute":       (*intValue)(&c.REST.RequestsPerMinute),
+		"rest.burst":                     (*intValue)(&c.REST.Burst),
+		"state.path":                     (*stringValue)(&c.State.Path),
+		"state.interval":                 (*durationValue)(&c.State.Interval),
+		"state.max_age":                  (*durationValue)(&c.State.MaxAge),
+		"history.path":                   (*stringValue)(&c.History.Path),
+		"history.retention":              (*durationValue)(&c.History.Retention),
+		"backfill.enabled":               (*boolValue)(&c.Backfill.Enabled),
+		"backfill.threshold":             (*durationValue)(&c.Backfill.Threshold),
+		"backfill.max_age":               (*durationValue)(&c.Backfill.MaxAge),
+		"proxy.enabled":                  (*boolValue)(&c.Proxy.Enabled),
+		"proxy.max_clients":              (*intValue)(&c.Proxy.MaxClients),
+		"rest_cache.enabled":             (*boolValue)(&c.RESTCache.Enabled),
+		"record.path":                    (*stringValue)(&c.Record.Path),
+		"record.max_mb":                  (*intValue)(&c.Record.MaxMB),
+		"record.max_files":               (*intValue)(&c.Record.MaxFiles),
+		"replay.paths":                   (*listValue)(&c.Replay.Paths),
+		"replay.speed":                   (*floatValue)(&c.Replay.Speed),
+		"cwop.callsign":                  (*stringValue)(&c.CWOP.Callsign),
+		"cwop.passcode":                  (*stringValue)(&c.CWOP.Passcode),
+		"cwop.passcode_file":             (*stringValue)(&c.CWOP.PasscodeFile),
+		"cwop.server":                    (*stringValue)(&c.CWOP.Server),
+		"cwop.interval":                  (*durationValue)(&c.CWOP.Interval),
+		"cwop.latitude":                  optionalFloatValue{&c.CWOP.Latitude},
+		"cwop.longitude":                 optionalFloatValue{&c.CWOP.Longitude},
+		"cwop.elevation":                 optionalFloatValue{&c.CWOP.Elevation},
+		"cwop.timezone":                  (*stringValue)(&c.CWOP.Timezone),
+		"forecast.enabled":               (*boolValue)(&c.Forecast.Enabled),
+		"forecast.interval":              (*durationValue)(&c.Forecast.Interval),
+		"forecast.hours":                 (*intValue)(&c.Forecast.Hours),
+		"reload.watch_interval":          (*durationValue)(&c.Reload.WatchInterval),
+		"oauth.client_id":                (*stringValue)(&c.OAuth.ClientID),
+		"oauth.client_secret":            (*stringValue)(&c.OAuth.ClientSecret),
+		"oauth.client_secret_file":       (*stringValue)(&c.OAuth.ClientSecretFile),
+		"oauth.redirect_url":             (*stringValue)(&c.OAuth.RedirectURL),
+		"oauth.auth_url":                 (*stringValue)(&c.OAuth.AuthURL),
+		"oauth.token_url":                (*stringValue)(&c.OAuth.TokenURL),
+		"oauth.token_path":               (*stringValue)(&c.OAuth.TokenPath),
+	}
+}
+
+// RegisterFlags adds a flag for every setting to fs, named after its key and
+// defaulting to the value in c.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	values := c.values()
+	for _, s := range settings {
+		usage := s.usage
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		fs.Var(values[s.key], s.key, usage)
+	}
+}
+
+// secretFile pairs a *_file setting with the secret its contents replace.
+type secretFile struct {
+	key    string
+	path   *string
+	secret *string
+}
+
+// secretFiles returns c's secret file settings.
+func (c *Config) secretFiles() []secretFile {
+	return []secretFile{
+		{"tempest.token_file", &c.Tempest.TokenFile, &c.Tempest.Token},
+		{"cwop.passcode_file", &c.CWOP.PasscodeFile, &c.CWOP.Passcode},
+		{"oauth.client_secret_file", &c.OAuth.ClientSecretFile, &c.OAuth.ClientSecret},
+	}
+}
+
+// secrets returns the credentials in c, for masking in logs. The CWOP
+// passcode is left out: it is a short number that would mask matching
+// digits in every log line, so the APRS client masks it where it is used.
+func (c *Config) secrets() []string {
+	return []string{c.Tempest.Token, c.OAuth.ClientSecret}
+}
+
+// LoadConfig builds the configuration from the defaults, the file at path
+// (skipped if empty), environment variables from lookupEnv and finally
+// flags, a map of setting key to value. Secret files replace the secrets
+// they hold, and with OAuth the token comes from the token store. It does
+// not validate the result.
+func LoadConfig(path string, lookupEnv func(string) (string, bool), flags map[string]string) (*Config, error) {
+	c := defaultConfig()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+		c.source = path
+	}
+
+	values := c.values()
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		if v, ok := lookupEnv(s.env); ok && v != "" {
+			if err := values[s.key].Set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.key]; ok {
+			if err := values[s.key].Set(v); err != nil {
+				return nil, fmt.Errorf("-%s: %w", s.key, err)
+			}
+		}
+	}
+
+	if c.OAuth.TokenPath != "" && (c.Tempest.Token != "" || c.Tempest.TokenFile != "") {
+		return nil, errors.New("oauth.token_path: set either it or tempest.token and tempest.token_file, not both")
+	}
+	for _, f := range c.secretFiles() {
+		if *f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(*f.path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.key, err)
+		}
+		*f.secret = strings.TrimSpace(string(data))
+		if *f.secret == "" {
+			return nil, fmt.Errorf("%s: %s is empty", f.key, *f.path)
+		}
+	}
+	if path := c.OAuth.TokenPath; path != "" {
+		// A missing store is reported by Validate, so "oauth login" can
+		// load the configuration before the first token exists.
+		tok, err := loadOAuthToken(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("oauth.token_path: %w", err)
+		}
+		if err == nil {
+			c.Tempest.Token = tok.AccessToken
+		}
+	}
+	return c, nil
+}
+
+// loadFile decodes a YAML or TOML file, chosen by extension, over c. Unknown
+// keys are an error so typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return fmt.Errorf("%s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("%s: config file must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// Validate checks every setting and reports all problems at once. The token
+// is required unless replaying.
+func (c *Config) Validate() error {
+	return c.validate(true)
+}
+
+// validate is Validate with the station ID optional, for commands that only
+// use the WebSocket.
+func (c *Config) validate(requireStation bool) error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, key, "must be a positive duration, got %s", d)
+	}
+
+	t := c.Tempest
+	if c.OAuth.TokenPath != "" {
+		check(t.Token != "" || len(c.Replay.Paths) > 0, "oauth.token_path",
+			"no token stored at %s; run \"tempest-exporter oauth login\"", c.OAuth.TokenPath)
+	} else {
+		check(t.Token != "" || len(c.Replay.Paths) > 0, "tempest.token", "is required")
+	}
+	check(t.DeviceID != "", "tempest.device_id", "is required")
+	if t.DeviceID != "" {
+		_, err := strconv.Atoi(t.DeviceID)
+		check(err == nil, "tempest.device_id", "must be a number, got %q", t.DeviceID)
+	}
+	check(t.StationID != "" || !requireStation, "tempest.station_id", "is required")
+	check(validStationName.MatchString(t.StationName), "tempest.station_name",
+		"must contain only alphanumeric, underscore, hyphen, or dot characters, got %q", t.StationName)
+	check(validURL(t.WSURL, "ws", "wss"), "tempest.ws_url", "must be a ws:// or wss:// URL, got %q", t.WSURL)
+	check(validURL(t.RESTURL, "http", "https"), "tempest.rest_url", "must be an http:// or https:// URL, got %q", t.RESTURL)
+
+	_, _, err := net.SplitHostPort(c.Server.ListenAddr)
+	check(err == nil, "server.listen_addr", "must be host:port, got %q", c.Server.ListenAddr)
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+
+	format := strings.ToLower(c.Log.Format)
+	check(format == "json" || format == "text", "log.format", "must be json or text, got %q", c.Log.Format)
+
+	positive("websocket.read_timeout", c.WebSocket.ReadTimeout)
+	positive("websocket.min_backoff", c.WebSocket.MinBackoff)
+	positive("websocket.max_backoff", c.WebSocket.MaxBackoff)
+	check(c.WebSocket.MinBackoff <= c.WebSocket.MaxBackoff, "websocket.min_backoff",
+		"must not exceed websocket.max_backoff (%s), got %s", c.WebSocket.MaxBackoff, c.WebSocket.MinBackoff)
+	positive("websocket.backoff_reset", c.WebSocket.BackoffReset)
+	check(c.WebSocket.BreakerFailures >= 0, "websocket.breaker_failures", "must not be negative, got %d", c.WebSocket.BreakerFailures)
+	positive("websocket.breaker_cooldown", c.WebSocket.BreakerCooldown)
+	positive("websocket.ack_timeout", c.WebSocket.AckTimeout)
+	check(c.WebSocket.StaleIntervals >= 1, "websocket.stale_intervals", "must be at least 1, got %d", c.WebSocket.StaleIntervals)
+	positive("fallback.threshold", c.Fallback.Threshold)
+	positive("fallback.poll_interval", c.Fallback.PollInterval)
+	check(c.REST.RequestsPerMinute >= 1, "rest.requests_per_minute", "must be at least 1, got %d", c.REST.RequestsPerMinute)
+	check(c.REST.Burst >= 1, "rest.burst", "must be at least 1, got %d", c.REST.Burst)
+	positive("state.interval", c.State.Interval)
+	positive("state.max_age", c.State.MaxAge)
+	positive("history.retention", c.History.Retention)
+	positive("backfill.threshold", c.Backfill.Threshold)
+	positive("backfill.max_age", c.Backfill.MaxAge)
+
+	check(c.Proxy.MaxClients >= 1, "proxy.max_clients", "must be at least 1, got %d", c.Proxy.MaxClients)
+	check(c.Record.MaxMB >= 1, "record.max_mb", "must be at least 1, got %d", c.Record.MaxMB)
+	check(c.Record.MaxFiles >= 0, "record.max_files", "must not be negative, got %d", c.Record.MaxFiles)
+	check(c.Replay.Speed >= 0, "replay.speed", "must not be negative, got %g", c.Replay.Speed)
+	check(c.WebSocket.FatalRetryInterval >= 0, "websocket.fatal_retry_interval", "must not be negative, got %s", c.WebSocket.FatalRetryInterval)
+	check(c.Reload.WatchInterval >= 0, "reload.watch_interval", "must not be negative, got %s", c.Reload.WatchInterval)
+
+	if c.CWOP.Callsign != "" {
+		_, _, err := net.SplitHostPort(c.CWOP.Server)
+		check(err == nil, "cwop.server", "must be host:port, got %q", c.CWOP.Server)
+		check(c.CWOP.Interval >= minCWOPInterval, "cwop.interval", "must be at least %s, got %s", minCWOPInterval, c.CWOP.Interval)
+		// Without the elevation, station pressure would be sent as
+		// sea-level pressure, so the position is all or nothing.
+		lat, lon, elev := c.CWOP.Latitude, c.CWOP.Longitude, c.CWOP.Elevation
+		check((lat == nil) == (lon == nil) && (lat == nil) == (elev == nil), "cwop.latitude",
+			"cwop.longitude and cwop.elevation must be set together")
+		if lat != nil && lon != nil {
+			if err := checkPosition(*lat, *lon); err != nil {
+				errs = append(errs, fmt.Errorf("cwop: %w", err))
+			}
+		}
+		if c.CWOP.Timezone != "" {
+			_, err := time.LoadLocation(c.CWOP.Timezone)
+			check(err == nil, "cwop.timezone", "unknown time zone %q", c.CWOP.Timezone)
+		}
+	}
+	if c.Forecast.Enabled {
+		check(c.Forecast.Interval >= minForecastInterval, "forecast.interval", "must be at least %s, got %s", minForecastInterval, c.Forecast.Interval)
+		check(c.Forecast.Hours >= 1 && c.Forecast.Hours <= maxForecastHours, "forecast.hours",
+			"must be between 1 and %d, got %d", maxForecastHours, c.Forecast.Hours)
+	}
+	if c.OAuth.TokenPath != "" {
+		errs = append(errs, c.OAuth.validate())
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the settings the OAuth flow needs.
+func (o OAuthConfig) validate() error {
+	var errs []error
+	if o.ClientID == "" {
+		errs = append(errs, errors.New("oauth.client_id: is required"))
+	}
+	if o.ClientSecret == "" {
+		errs = append(errs, errors.New("oauth.client_secret: is required"))
+	}
+	if o.TokenPath == "" {
+		errs = append(errs, errors.New("oauth.token_path: is required"))
+	}
+	for _, u := range []struct{ key, value string }{
+		{"oauth.redirect_url", o.RedirectURL},
+		{"oauth.auth_url", o.AuthURL},
+		{"oauth.token_url", o.TokenURL},
+	} {
+		if !validURL(u.value, "http", "https") {
+			errs = append(errs, fmt.Errorf("%s: must be an http:// or https:// URL, got %q", u.key, u.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validURL(s string, schemes ...string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// configFlags registers -config and a flag per setting on fs. Once fs has
+// been parsed, the returned function loads the layered configuration; the
+// file comes from -config or CONFIG_PATH. The loaded secrets are masked in
+// logs from then on.
+func configFlags(fs *flag.FlagSet) func() (*Config, error) {
+	path := fs.String("config", "", "YAML or TOML config file (env CONFIG_PATH)")
+	defaultConfig().RegisterFlags(fs)
+	return func() (*Config, error) {
+		flags := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+		p := *path
+		if p == "" {
+			p = os.Getenv("CONFIG_PATH")
+		}
+		cfg, err := LoadConfig(p, os.LookupEnv, flags)
+		if err == nil {
+			logSecrets.Add(cfg.secrets()...)
+		}
+		return cfg, err
+	}
+}
+
+// runConfigCommand implements "config check": it loads and validates the
+// configuration without starting the exporter. It returns the exit code.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: tempest-exporter config check [-config FILE] [flags]")
+		return 2
+	}
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tempest-exporter config check [-config FILE] [flags]\n\n"+
+			"Validates the configuration from FILE, environment variables and flags\n"+
+			"as the exporter would load it, and reports every problem found.\n\n")
+		fs.PrintDefaults()
+	}
+	load := configFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	cfg, err := load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config is invalid:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(os.Stderr, "  "+line)
+		}
+		return 1
+	}
+	fmt.Println("config is valid")
+	return 0
+}
+
+// flag.Value implementations bound to Config fields.
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+// listValue is a comma-separated list.
+type listValue []string
+
+func (v *listValue) Set(s string) error { *v = strings.Split(s, ","); return nil }
+func (v *listValue) String() string     { return strings.Join(*v, ",") }
+
+// optionalFloatValue is a number that may be unset.
+type optionalFloatValue struct{ p **float64 }
+
+func (v optionalFloatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	*v.p = &f
+	return nil
+}
+
+func (v optionalFloatValue) String() string {
+	if v.p == nil || *v.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**v.p, 'g', -1, 64)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func noEnv(string) (string, bool) { return "", false }
+
+func mapEnv(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+// validConfig returns defaults with the required settings filled in.
+func validConfig() *Config {
+	c := defaultConfig()
+	c.Tempest.Token = "token"
+	c.Tempest.DeviceID = "12345"
+	c.Tempest.StationID = "67890"
+	return c
+}
+
+func TestLoadConfig_ExampleMatchesDefaults(t *testing.T) {
+	got, err := LoadConfig("config.example.yaml", noEnv, nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(got.Replay.Paths) == 0 {
+		got.Replay.Paths = nil
+	}
+	got.source = ""
+	if want := defaultConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("config.example.yaml differs from the defaults:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestLoadConfig_Layering(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+tempest:
+  device_id: "12345"
+  station_name: from_file
+server:
+  listen_addr: ":9000"
+fallback:
+  threshold: 10m
+cwop:
+  latitude: 40.5
+`)
+	env := mapEnv(map[string]string{
+		"TEMPEST_STATION_NAME": "from_env",
+		"LISTEN_ADDR":          ":9001",
+		"TEMPEST_RAPID_WIND":   "true",
+		"REPLAY_PATH":          "a.jsonl,b.jsonl",
+		"CWOP_LONGITUDE":       "-111.5",
+	})
+	c, err := LoadConfig(path, env, map[string]string{"server.listen_addr": ":9002"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if c.Tempest.DeviceID != "12345" {
+		t.Errorf("device_id = %q, want file value", c.Tempest.DeviceID)
+	}
+	if c.Tempest.StationName != "from_env" {
+		t.Errorf("station_name = %q, want env to override the file", c.Tempest.StationName)
+	}
+	if c.Server.ListenAddr != ":9002" {
+		t.Errorf("listen_addr = %q, want the flag to override env and file", c.Server.ListenAddr)
+	}
+	if c.Fallback.Threshold != 10*time.Minute || c.Fallback.PollInterval != time.Minute {
+		t.Errorf("fallback = %+v, want file threshold and default poll interval", c.Fallback)
+	}
+	if !c.Tempest.RapidWind || !reflect.DeepEqual(c.Replay.Paths, []string{"a.jsonl", "b.jsonl"}) {
+		t.Errorf("rapid_wind = %v, replay.paths = %v", c.Tempest.RapidWind, c.Replay.Paths)
+	}
+	if c.CWOP.Latitude == nil || *c.CWOP.Latitude != 40.5 || c.CWOP.Longitude == nil || *c.CWOP.Longitude != -111.5 {
+		t.Errorf("cwop position = %v, %v", c.CWOP.Latitude, c.CWOP.Longitude)
+	}
+	if c.CWOP.Elevation != nil {
+		t.Errorf("cwop.elevation = %v, want unset", *c.CWOP.Elevation)
+	}
+}
+
+func TestLoadConfig_TOML(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[tempest]
+device_id = "12345"
+rapid_wind = true
+
+[websocket]
+read_timeout = "2m"
+
+[replay]
+paths = ["a.jsonl"]
+speed = 0
+`)
+	c, err := LoadConfig(path, noEnv, nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if c.Tempest.DeviceID != "12345" || !c.Tempest.RapidWind || c.WebSocket.ReadTimeout != 2*time.Minute {
+		t.Errorf("config = %+v", c)
+	}
+	if c.Replay.Speed != 0 || len(c.Replay.Paths) != 1 {
+		t.Errorf("replay = %+v", c.Replay)
+	}
+	if c.Server.ListenAddr != ":8080" {
+		t.Errorf("listen_addr = %q, want the default", c.Server.ListenAddr)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		env                 map[string]string
+		want                string
+	}{
+		{"unknown YAML key", "c.yaml", "server:\n  listen_adr: \":1\"\n", nil, "listen_adr"},
+		{"unknown TOML key", "c.toml", "[server]\nlisten_adr = \":1\"\n", nil, "server.listen_adr"},
+		{"bad YAML duration", "c.yaml", "state:\n  interval: soon\n", nil, "soon"},
+		{"unsupported extension", "c.json", "{}", nil, ".toml"},
+		{"bad env", "", "", map[string]string{"STATE_INTERVAL": "soon"}, "STATE_INTERVAL"},
+		{"bad env bool", "", "", map[string]string{"BACKFILL_ENABLED": "yes please"}, "BACKFILL_ENABLED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfigFile(t, tt.file, tt.content)
+			}
+			_, err := LoadConfig(path, mapEnv(tt.env), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want mention of %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), noEnv, nil); err == nil {
+		t.Error("missing file: expected error")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	if err := defaultConfig().Validate(); err == nil {
+		t.Error("defaults without credentials should be invalid")
+	}
+
+	replay := validConfig()
+	replay.Tempest.Token = ""
+	replay.Replay.Paths = []string{"a.jsonl"}
+	if err := replay.Validate(); err != nil {
+		t.Errorf("replay without token: %v", err)
+	}
+
+	noStation := validConfig()
+	noStation.Tempest.StationID = ""
+	if err := noStation.validate(false); err != nil {
+		t.Errorf("validate(false) without station: %v", err)
+	}
+
+	lat := 95.0
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+		want   string
+	}{
+		{"device id", func(c *Config) { c.Tempest.DeviceID = "abc" }, "tempest.device_id"},
+		{"station name", func(c *Config) { c.Tempest.StationName = "bad name" }, "tempest.station_name"},
+		{"ws url", func(c *Config) { c.Tempest.WSURL = "http://example.com" }, "tempest.ws_url"},
+		{"rest url", func(c *Config) { c.Tempest.RESTURL = "example.com" }, "tempest.rest_url"},
+		{"listen addr", func(c *Config) { c.Server.ListenAddr = "8080" }, "server.listen_addr"},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"read timeout", func(c *Config) { c.WebSocket.ReadTimeout = 0 }, "websocket.read_timeout"},
+		{"poll interval", func(c *Config) { c.Fallback.PollInterval = -time.Second }, "fallback.poll_interval"},
+		{"max clients", func(c *Config) { c.Proxy.MaxClients = 0 }, "proxy.max_clients"},
+		{"record size", func(c *Config) { c.Record.MaxMB = 0 }, "record.max_mb"},
+		{"replay speed", func(c *Config) { c.Replay.Speed = -1 }, "replay.speed"},
+		{"cwop interval", func(c *Config) { c.CWOP.Callsign = "DW1234"; c.CWOP.Interval = time.Minute }, "cwop.interval"},
+		{"cwop position pair", func(c *Config) { c.CWOP.Callsign = "DW1234"; c.CWOP.Latitude = &lat }, "cwop.latitude"},
+		{"forecast interval", func(c *Config) { c.Forecast.Enabled = true; c.Forecast.Interval = time.Minute }, "forecast.interval"},
+		{"forecast hours", func(c *Config) { c.Forecast.Enabled = true; c.Forecast.Hours = 0 }, "forecast.hours"},
+		{"cwop timezone", func(c *Config) { c.CWOP.Callsign = "DW1234"; c.CWOP.Timezone = "Mars/Olympus" }, "cwop.timezone"},
+		{"cwop elevation", func(c *Config) {
+			c.CWOP.Callsign = "DW1234"
+			lon := 0.0
+			c.CWOP.Latitude, c.CWOP.Longitude = &lat, &lon
+		}, "cwop.elevation"},
+		{"cwop latitude", func(c *Config) {
+			c.CWOP.Callsign = "DW1234"
+			lon, elev := 0.0, 0.0
+			c.CWOP.Latitude, c.CWOP.Longitude, c.CWOP.Elevation = &lat, &lon, &elev
+		}, "invalid latitude"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.mutate(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want mention of %q", err, tt.want)
+			}
+		})
+	}
+
+	// All problems are reported together.
+	c := validConfig()
+	c.Server.ListenAddr = "bad"
+	c.Proxy.MaxClients = 0
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.listen_addr") || !strings.Contains(err.Error(), "proxy.max_clients") {
+		t.Errorf("error = %v, want both problems", err)
+	}
+}
+
+func TestConfig_SettingsCoverEveryValue(t *testing.T) {
+	values := defaultConfig().values()
+	if len(values) != len(settings) {
+		t.Errorf("%d values but %d settings", len(values), len(settings))
+	}
+	for _, s := range settings {
+		if values[s.key] == nil {
+			t.Errorf("setting %s has no value", s.key)
+		}
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "tempest:\n  station_name: from_file\n  device_id: \"1\"\n")
+	t.Setenv("CONFIG_PATH", path)
+	t.Setenv("TEMPEST_DEVICE_ID", "2")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	load := configFlags(fs)
+	if err := fs.Parse([]string{"-tempest.device_id", "3", "-backfill.enabled", "-cwop.elevation=1288"}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	c, err := load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.Tempest.StationName != "from_file" || c.Tempest.DeviceID != "3" || !c.Backfill.Enabled {
+		t.Errorf("tempest = %+v, backfill = %+v", c.Tempest, c.Backfill)
+	}
+	if c.CWOP.Elevation == nil || *c.CWOP.Elevation != 1288 {
+		t.Errorf("cwop.elevation = %v", c.CWOP.Elevation)
+	}
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	good := writeConfigFile(t, "good.yaml", "tempest:\n  token: x\n  device_id: \"1\"\n  station_id: \"2\"\n")
+	bad := writeConfigFile(t, "bad.yaml", "tempest:\n  device_id: abc\n")
+	for _, k := range []string{"CONFIG_PATH", "TEMPEST_TOKEN", "TEMPEST_DEVICE_ID", "TEMPEST_STATION_ID"} {
+		t.Setenv(k, "")
+	}
+
+	if code := runConfigCommand([]string{"check", "-config", good}); code != 0 {
+		t.Errorf("valid config: exit code %d, want 0", code)
+	}
+	if code := runConfigCommand([]string{"check", "-config", bad}); code != 1 {
+		t.Errorf("invalid config: exit code %d, want 1", code)
+	}
+	if code := runConfigCommand([]string{"lint"}); code != 2 {
+		t.Errorf("unknown subcommand: exit code %d, want 2", code)
+	}
+}
+
+func TestLoadConfig_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	passcode := filepath.Join(dir, "passcode")
+	secret := filepath.Join(dir, "secret")
+	writeFile(t, passcode, "12345\n")
+	writeFile(t, secret, "  s3cret\n")
+
+	c, err := LoadConfig("", mapEnv(map[string]string{
+		"CWOP_PASSCODE":            "-1",
+		"CWOP_PASSCODE_FILE":       passcode,
+		"OAUTH_CLIENT_SECRET_FILE": secret,
+	}), nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if c.CWOP.Passcode != "12345" {
+		t.Errorf("passcode = %q, want the file's contents", c.CWOP.Passcode)
+	}
+	if c.OAuth.ClientSecret != "s3cret" {
+		t.Errorf("client secret = %q, want the file's trimmed contents", c.OAuth.ClientSecret)
+	}
+	if got := c.secrets(); !reflect.DeepEqual(got, []string{"", "s3cret"}) {
+		t.Errorf("secrets = %q, want the numeric passcode kept out of global masking", got)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	writeFile(t, empty, "\n")
+	if _, err := LoadConfig("", mapEnv(map[string]string{"CWOP_PASSCODE_FILE": empty}), nil); err == nil ||
+		!strings.Contains(err.Error(), "cwop.passcode_file") {
+		t.Errorf("empty file: error = %v, want mention of cwop.passcode_file", err)
+	}
+	if _, err := LoadConfig("", mapEnv(map[string]string{"OAUTH_CLIENT_SECRET_FILE": filepath.Join(dir, "missing")}), nil); err == nil {
+		t.Error("missing file: expected error")
+	}
+}
+
+func TestLoadConfig_OAuthTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "oauth.json")
+	env := map[string]string{
+		"TEMPEST_DEVICE_ID":   "1",
+		"TEMPEST_STATION_ID":  "2",
+		"OAUTH_CLIENT_ID":     "client",
+		"OAUTH_CLIENT_SECRET": "secret",
+		"OAUTH_TOKEN_PATH":    store,
+	}
+
+	// Before "oauth login" the configuration loads but is invalid.
+	c, err := LoadConfig("", mapEnv(env), nil)
+	if err != nil {
+		t.Fatalf("LoadConfig without store: %v", err)
+	}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "oauth login") {
+		t.Errorf("Validate without store = %v, want a hint to run oauth login", err)
+	}
+
+	if err := saveOAuthToken(store, &oauthToken{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err = LoadConfig("", mapEnv(env), nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if c.Tempest.Token != "access" {
+		t.Errorf("token = %q, want the stored access token", c.Tempest.Token)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	env["TEMPEST_TOKEN"] = "personal"
+	if _, err := LoadConfig("", mapEnv(env), nil); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("token and token store: error = %v, want rejection", err)
+	}
+	delete(env, "TEMPEST_TOKEN")
+
+	c.OAuth.ClientID = ""
+	c.OAuth.TokenURL = "ftp://example.com"
+	err = c.Validate()
+	for _, want := range []string{"oauth.client_id", "oauth.token_url"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate = %v, want mention of %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles holds the built-in dashboard, a static page that reads the
+// JSON API, the history API and the event stream.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the dashboard: index.html at / and its assets under
+// /assets/.
+func dashboardHandler() http.Handler {
+	sub, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+	return http.FileServerFS(sub)
+}
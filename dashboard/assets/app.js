@@ -0,0 +1,148 @@
+// Tempest exporter dashboard. Reads /api/v1/current, /api/v1/history and the
+// /api/v1/stream event stream; no external dependencies.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+const DAY = 24 * 3600;
+
+function fmt(v, digits = 1) {
+  return v === null || v === undefined ? "–" : Number(v).toFixed(digits);
+}
+
+function set(id, v, digits) {
+  $(id).textContent = fmt(v, digits);
+}
+
+function timeAgo(epoch) {
+  const s = Math.max(0, Math.round(Date.now() / 1000 - epoch));
+  if (s < 90) return s + " s ago";
+  if (s < 90 * 60) return Math.round(s / 60) + " min ago";
+  return Math.round(s / 3600) + " h ago";
+}
+
+function setStatus(text, ok) {
+  const el = $("status");
+  el.textContent = text;
+  el.className = "status " + (ok ? "ok" : "bad");
+}
+
+function setWind(speed, direction) {
+  if (speed !== undefined) set("wind", speed);
+  if (direction === null || direction === undefined) return;
+  set("dir", direction, 0);
+  $("needle").setAttribute("transform", "rotate(" + direction + ")");
+}
+
+async function loadCurrent() {
+  let body;
+  try {
+    const resp = await fetch("api/v1/current", { cache: "no-store" });
+    body = await resp.json();
+  } catch (e) {
+    setStatus("exporter unreachable", false);
+    return;
+  }
+
+  document.title = "Tempest – " + body.station_name;
+  $("station").textContent = body.station_name;
+  setStatus(body.connected ? "live" : "disconnected" + (body.source === "rest" ? " (REST fallback)" : ""), body.connected);
+
+  const o = body.observation;
+  if (!o) {
+    $("age").textContent = "Waiting for the first observation…";
+    return;
+  }
+  const d = body.derived || {};
+  set("temp", o.air_temperature);
+  set("feels", d.feels_like);
+  set("dew", d.dew_point);
+  set("humidity", o.relative_humidity, 0);
+  set("pressure", o.station_pressure);
+  set("uv", o.uv);
+  set("solar", o.solar_radiation, 0);
+  set("gust", o.wind_gust);
+  set("lull", o.wind_lull);
+  setWind(o.wind_avg, o.wind_direction);
+  set("rain-now", o.rain_accumulated, 2);
+  set("strikes", o.lightning_strike_count, 0);
+  set("strike-dist", o.lightning_strike_avg_distance, 0);
+  $("age").textContent = "Updated " + timeAgo(o.timestamp);
+
+  const r = body.rain;
+  if (r) {
+    set("rain-hour", r.rain_last_hour, 2);
+    set("rain-day", r.rain_last_24h, 2);
+    set("rain-today", r.rain_since_midnight, 2);
+  }
+  $("rain-start").textContent = body.rain_start_epoch ? timeAgo(body.rain_start_epoch) : "–";
+}
+
+function sparkline(svg, points) {
+  const vals = points.filter((p) => p[1] !== null);
+  svg.replaceChildren();
+  if (vals.length < 2) return null;
+
+  const t0 = vals[0][0], t1 = vals[vals.length - 1][0];
+  let lo = Math.min(...vals.map((p) => p[1]));
+  let hi = Math.max(...vals.map((p) => p[1]));
+  if (hi === lo) { hi += 1; lo -= 1; }
+
+  const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+  line.setAttribute("points", vals.map((p) => {
+    const x = ((p[0] - t0) / (t1 - t0 || 1)) * 300;
+    const y = 58 - ((p[1] - lo) / (hi - lo)) * 56;
+    return x.toFixed(1) + "," + y.toFixed(1);
+  }).join(" "));
+  svg.appendChild(line);
+  return [Math.min(...vals.map((p) => p[1])), Math.max(...vals.map((p) => p[1]))];
+}
+
+async function loadHistory() {
+  const now = Math.floor(Date.now() / 1000);
+  let body;
+  try {
+    const resp = await fetch("api/v1/history?from=" + (now - DAY) + "&to=" + now + "&step=15m", { cache: "no-store" });
+    if (!resp.ok) throw new Error(resp.status);
+    body = await resp.json();
+  } catch (e) {
+    $("trends-note").hidden = false;
+    return;
+  }
+
+  for (const svg of document.querySelectorAll("[data-spark]")) {
+    const field = svg.dataset.spark;
+    const range = sparkline(svg, body.observations.map((o) => [o.timestamp, o[field]]));
+    document.querySelector('[data-range="' + field + '"]').textContent =
+      range ? fmt(range[0]) + " – " + fmt(range[1]) : "";
+  }
+
+  const strikes = body.events.filter((e) => e.type === "strike");
+  $("strikes-day").textContent = strikes.length;
+  if (strikes.length) {
+    const last = strikes[strikes.length - 1];
+    $("strike-last").textContent = timeAgo(last.timestamp) + ", " + fmt(last.distance, 0) + " km";
+  }
+}
+
+function connectStream() {
+  if (!window.EventSource) return;
+  const es = new EventSource("api/v1/stream");
+  es.addEventListener("observation", loadCurrent);
+  es.addEventListener("rapid_wind", (e) => {
+    const w = JSON.parse(e.data);
+    setWind(w.wind_speed, w.wind_direction);
+  });
+  es.addEventListener("strike", (e) => {
+    const s = JSON.parse(e.data);
+    $("strike-last").textContent = timeAgo(s.timestamp) + ", " + fmt(s.distance, 0) + " km";
+  });
+  es.addEventListener("precip_start", loadCurrent);
+}
+
+loadCurrent();
+loadHistory();
+connectStream();
+// The stream delivers new observations; polling refreshes ages and covers
+// browsers or proxies without Server-Sent Events.
+setInterval(loadCurrent, 60 * 1000);
+setInterval(loadHistory, 15 * 60 * 1000);
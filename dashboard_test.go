@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	mux := newMux(NewCollector("99999", "backyard"), nil, nil)
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{"/", http.StatusOK, "text/html", `<script src="assets/app.js">`},
+		{"/assets/app.js", http.StatusOK, "javascript", "api/v1/current"},
+		{"/assets/style.css", http.StatusOK, "text/css", "#compass"},
+		{"/assets/missing.js", http.StatusNotFound, "", ""},
+		{"/nope", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if !strings.Contains(w.Header().Get("Content-Type"), tt.contentType) {
+			t.Errorf("%s: Content-Type = %q, want %s", tt.path, w.Header().Get("Content-Type"), tt.contentType)
+		}
+		if !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("%s: body missing %q", tt.path, tt.contains)
+		}
+	}
+}
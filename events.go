@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+// Event types published on the EventBus.
+const (
+	EventObservation = "observation"
+	EventRapidWind   = "rapid_wind"
+	EventStrike      = "strike"
+	EventPrecipStart = "precip_start"
+)
+
+// Event is a single typed update. Data holds an Observation, RapidWind,
+// Strike or PrecipStart depending on Type.
+type Event struct {
+	Type string
+	Data any
+}
+
+// RapidWind is a 3-second wind sample from a rapid_wind message.
+type RapidWind = weatherflow.RapidWind
+
+// Strike is a lightning strike from an evt_strike message.
+type Strike = weatherflow.Strike
+
+// PrecipStart is a rain start event from an evt_precip message.
+type PrecipStart = weatherflow.PrecipStart
+
+// EventBus fans events out to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full misses the event.
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewEventBus creates an empty event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish delivers e to every subscriber with room in its buffer.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishStreamEvent publishes strikes, rain starts and rapid wind samples
+// from the WebSocket client. Observations are published by the collector, so
+// that REST fallback observations are included.
+func (b *EventBus) publishStreamEvent(ev weatherflow.Event) {
+	switch ev := ev.(type) {
+	case RapidWind:
+		b.Publish(Event{Type: EventRapidWind, Data: ev})
+	case Strike:
+		b.Publish(Event{Type: EventStrike, Data: ev})
+	case PrecipStart:
+		b.Publish(Event{Type: EventPrecipStart, Data: ev})
+	}
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes and
+// closes it.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *EventBus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestEventBus_PublishSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	a, unsubA := bus.Subscribe(1)
+	b, unsubB := bus.Subscribe(1)
+	defer unsubB()
+
+	bus.Publish(Event{Type: EventPrecipStart, Data: PrecipStart{Timestamp: 1}})
+	for _, ch := range []<-chan Event{a, b} {
+		if e := <-ch; e.Type != EventPrecipStart {
+			t.Errorf("event type = %q, want %q", e.Type, EventPrecipStart)
+		}
+	}
+
+	unsubA()
+	unsubA() // idempotent
+	if _, ok := <-a; ok {
+		t.Error("channel should be closed after unsubscribe")
+	}
+	if n := bus.Subscribers(); n != 1 {
+		t.Errorf("Subscribers = %d, want 1", n)
+	}
+}
+
+func TestEventBus_DropsWhenFull(t *testing.T) {
+	bus := NewEventBus()
+	ch, unsub := bus.Subscribe(1)
+	defer unsub()
+
+	// Second publish must not block even though nobody is reading.
+	bus.Publish(Event{Type: EventStrike})
+	bus.Publish(Event{Type: EventRapidWind})
+
+	if e := <-ch; e.Type != EventStrike {
+		t.Errorf("first event = %q, want %q", e.Type, EventStrike)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected buffered event %q", e.Type)
+	default:
+	}
+}
+
+func TestEventBus_NilPublish(t *testing.T) {
+	var bus *EventBus
+	bus.Publish(Event{Type: EventStrike}) // must not panic
+}
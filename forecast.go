@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// defaultForecastInterval polls about twice per forecast update, costing
+	// 48 REST requests a day.
+	defaultForecastInterval = 30 * time.Minute
+	// minForecastInterval keeps the poller from using a noticeable share of
+	// the REST budget; the forecast changes about once an hour.
+	minForecastInterval  = 5 * time.Minute
+	defaultForecastHours = 24
+	// maxForecastHours is the length of better_forecast's hourly forecast.
+	maxForecastHours = 240
+)
+
+// ForecastPoller periodically fetches the station's better_forecast into the
+// collector. Each poll is a single REST request drawing on the shared budget.
+type ForecastPoller struct {
+	rest      *RESTClient
+	collector *Collector
+	interval  time.Duration
+	hours     int
+}
+
+// NewForecastPoller creates a poller that fetches the forecast every interval
+// and exports hours of its hourly forecast.
+func NewForecastPoller(rest *RESTClient, collector *Collector, interval time.Duration, hours int) *ForecastPoller {
+	return &ForecastPoller{rest: rest, collector: collector, interval: interval, hours: hours}
+}
+
+// Run polls at once and then every interval until ctx is cancelled. A failed
+// poll keeps the previous forecast.
+func (p *ForecastPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.poll(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("forecast poll failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches the forecast once. It is skipped while the WebSocket reports
+// the token as rejected, since the REST API would reject it too.
+func (p *ForecastPoller) poll(ctx context.Context) error {
+	if class, _ := p.collector.WebSocketFailure(); class == errAuth.String() {
+		slog.Warn("forecast polling paused while the token is rejected")
+		return nil
+	}
+	f, err := p.rest.FetchForecast(ctx)
+	if err != nil {
+		return err
+	}
+	p.collector.SetForecast(f, p.hours)
+	slog.Info("forecast updated", "hourly", len(f.Forecast.Hourly), "daily", len(f.Forecast.Daily))
+	return nil
+}
+
+// forecastMetrics emits the forecast for the day containing now and for the
+// hours after now, up to hours ahead. An hourly entry is hours_ahead="n" if it
+// starts within n hours of now, so each label keeps a fixed distance from the
+// scrape as the forecast ages.
+func forecastMetrics(ch chan<- prometheus.Metric, f *weatherflow.Forecast, hours int, now time.Time, stationID, stationName string) {
+	lv := []string{stationID, stationName}
+
+	if day, ok := forecastToday(f.Forecast.Daily, now); ok {
+		emit := func(desc *prometheus.Desc, val float64) {
+			if !math.IsNaN(val) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, val, lv...)
+			}
+		}
+		emit(descForecastTodayHigh, day.AirTempHigh)
+		emit(descForecastTodayLow, day.AirTempLow)
+		emit(descForecastTodayPrecipProbability, day.PrecipProbability)
+		ch <- prometheus.MustNewConstMetric(descForecastTodayConditions, prometheus.GaugeValue, 1,
+			stationID, stationName, day.Conditions, day.Icon)
+	}
+
+	for _, h := range f.Forecast.Hourly {
+		until := time.Unix(h.Time, 0).Sub(now)
+		if until <= 0 {
+			continue
+		}
+		ahead := int(math.Ceil(until.Hours()))
+		if ahead > hours {
+			break
+		}
+		hv := []string{stationID, stationName, strconv.Itoa(ahead)}
+		emit := func(desc *prometheus.Desc, val float64) {
+			if !math.IsNaN(val) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, val, hv...)
+			}
+		}
+		emit(descForecastAirTemperature, h.AirTemperature)
+		emit(descForecastPrecipProbability, h.PrecipProbability)
+		emit(descForecastPrecip, h.Precip)
+		emit(descForecastWindAvg, h.WindAvg)
+		emit(descForecastWindGust, h.WindGust)
+		emit(descForecastWindDirection, h.WindDirection)
+		ch <- prometheus.MustNewConstMetric(descForecastConditions, prometheus.GaugeValue, 1,
+			append(hv, h.Conditions, h.Icon)...)
+	}
+}
+
+// forecastToday returns the daily forecast for the local day containing now.
+// A day ends where the next one starts, or 24 hours after it starts if it is
+// the last.
+func forecastToday(daily []weatherflow.DailyForecast, now time.Time) (weatherflow.DailyForecast, bool) {
+	t := now.Unix()
+	for i, d := range daily {
+		end := d.DayStartLocal + 24*60*60
+		if i+1 < len(daily) {
+			end = daily[i+1].DayStartLocal
+		}
+		if d.DayStartLocal <= t && t < end {
+			return d, true
+		}
+	}
+	return weatherflow.DailyForecast{}, false
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow/weatherflowtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector_ForecastMetrics(t *testing.T) {
+	hour := time.Now().Truncate(time.Hour)
+	hourly := func(offset int, temp float64, conditions string) weatherflow.HourlyForecast {
+		return weatherflow.HourlyForecast{
+			Time:              hour.Add(time.Duration(offset) * time.Hour).Unix(),
+			Conditions:        conditions,
+			Icon:              "cloudy",
+			AirTemperature:    temp,
+			PrecipProbability: float64(offset * 10),
+			WindAvg:           3,
+			WindGust:          5,
+			WindDirection:     270,
+		}
+	}
+	f := &weatherflow.Forecast{Forecast: weatherflow.ForecastPeriods{
+		Daily: []weatherflow.DailyForecast{
+			{DayStartLocal: hour.Add(-30 * time.Hour).Unix(), Conditions: "Clear", Icon: "clear-day", AirTempHigh: 30},
+			{DayStartLocal: hour.Add(-6 * time.Hour).Unix(), Conditions: "Rain Likely", Icon: "rainy", AirTempHigh: 21.5, AirTempLow: 12, PrecipProbability: 70},
+		},
+		// The first hour has already started and the last is beyond hours.
+		Hourly: []weatherflow.HourlyForecast{
+			hourly(0, 15, "Cloudy"),
+			hourly(1, 16, "Cloudy"),
+			hourly(2, 17.5, "Rain Likely"),
+			hourly(3, 18, "Rain Likely"),
+		},
+	}}
+
+	c := NewCollector("12345", "backyard")
+	c.SetForecast(f, 2)
+
+	expected := `
+# HELP tempest_forecast_air_temperature_celsius Forecast air temperature in Celsius, by hours ahead
+# TYPE tempest_forecast_air_temperature_celsius gauge
+tempest_forecast_air_temperature_celsius{hours_ahead="1",station_id="12345",station_name="backyard"} 16
+tempest_forecast_air_temperature_celsius{hours_ahead="2",station_id="12345",station_name="backyard"} 17.5
+# HELP tempest_forecast_conditions_info Forecast conditions, by hours ahead (always 1)
+# TYPE tempest_forecast_conditions_info gauge
+tempest_forecast_conditions_info{conditions="Cloudy",hours_ahead="1",icon="cloudy",station_id="12345",station_name="backyard"} 1
+tempest_forecast_conditions_info{conditions="Rain Likely",hours_ahead="2",icon="cloudy",station_id="12345",station_name="backyard"} 1
+# HELP tempest_forecast_precipitation_probability_percent Forecast chance of precipitation, by hours ahead
+# TYPE tempest_forecast_precipitation_probability_percent gauge
+tempest_forecast_precipitation_probability_percent{hours_ahead="1",station_id="12345",station_name="backyard"} 10
+tempest_forecast_precipitation_probability_percent{hours_ahead="2",station_id="12345",station_name="backyard"} 20
+# HELP tempest_forecast_wind_gust_meters_per_second Forecast wind gust speed (m/s), by hours ahead
+# TYPE tempest_forecast_wind_gust_meters_per_second gauge
+tempest_forecast_wind_gust_meters_per_second{hours_ahead="1",station_id="12345",station_name="backyard"} 5
+tempest_forecast_wind_gust_meters_per_second{hours_ahead="2",station_id="12345",station_name="backyard"} 5
+# HELP tempest_forecast_today_air_temperature_high_celsius Forecast high air temperature for the current local day in Celsius
+# TYPE tempest_forecast_today_air_temperature_high_celsius gauge
+tempest_forecast_today_air_temperature_high_celsius{station_id="12345",station_name="backyard"} 21.5
+# HELP tempest_forecast_today_air_temperature_low_celsius Forecast low air temperature for the current local day in Celsius
+# TYPE tempest_forecast_today_air_temperature_low_celsius gauge
+tempest_forecast_today_air_temperature_low_celsius{station_id="12345",station_name="backyard"} 12
+# HELP tempest_forecast_today_conditions_info Forecast conditions for the current local day (always 1)
+# TYPE tempest_forecast_today_conditions_info gauge
+tempest_forecast_today_conditions_info{conditions="Rain Likely",icon="rainy",station_id="12345",station_name="backyard"} 1
+# HELP tempest_forecast_today_precipitation_probability_percent Forecast chance of precipitation for the current local day
+# TYPE tempest_forecast_today_precipitation_probability_percent gauge
+tempest_forecast_today_precipitation_probability_percent{station_id="12345",station_name="backyard"} 70
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"tempest_forecast_air_temperature_celsius",
+		"tempest_forecast_conditions_info",
+		"tempest_forecast_precipitation_probability_percent",
+		"tempest_forecast_wind_gust_meters_per_second",
+		"tempest_forecast_today_air_temperature_high_celsius",
+		"tempest_forecast_today_air_temperature_low_celsius",
+		"tempest_forecast_today_conditions_info",
+		"tempest_forecast_today_precipitation_probability_percent",
+	); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c, "tempest_forecast_updated_timestamp_seconds"); n != 1 {
+		t.Errorf("got %d forecast update timestamps, want 1", n)
+	}
+}
+
+func TestCollector_NoForecastMetricsBeforePoll(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	if n := testutil.CollectAndCount(c,
+		"tempest_forecast_updated_timestamp_seconds",
+		"tempest_forecast_air_temperature_celsius",
+		"tempest_forecast_today_air_temperature_high_celsius",
+	); n != 0 {
+		t.Errorf("got %d forecast metrics before a poll, want 0", n)
+	}
+}
+
+func TestForecastToday(t *testing.T) {
+	daily := []weatherflow.DailyForecast{
+		{DayStartLocal: 1000, DayNum: 1},
+		{DayStartLocal: 1000 + 82800, DayNum: 2}, // a 23-hour DST day before it
+	}
+	tests := []struct {
+		at     int64
+		want   int
+		wantOK bool
+	}{
+		{999, 0, false},
+		{1000, 1, true},
+		{1000 + 82799, 1, true},
+		{1000 + 82800, 2, true},
+		{1000 + 82800 + 86399, 2, true},
+		{1000 + 82800 + 86400, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := forecastToday(daily, time.Unix(tt.at, 0))
+		if ok != tt.wantOK || got.DayNum != tt.want {
+			t.Errorf("forecastToday(%d) = day %d, %v; want day %d, %v", tt.at, got.DayNum, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestForecastPoller_Poll(t *testing.T) {
+	srv := weatherflowtest.NewServer("test-token")
+	defer srv.Close()
+	srv.SetForecast(99999, weatherflow.Forecast{Forecast: weatherflow.ForecastPeriods{
+		Hourly: []weatherflow.HourlyForecast{{Time: time.Now().Add(time.Hour).Unix(), AirTemperature: 14}},
+	}})
+
+	c := NewCollector("99999", "test")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+	rc.budget = newRequestBudget(1, 1)
+	p := NewForecastPoller(rc, c, time.Hour, 12)
+
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	reqs := srv.Requests()
+	if len(reqs) != 1 || !strings.HasPrefix(reqs[0], "/better_forecast?") || !strings.Contains(reqs[0], "units_temp=c") {
+		t.Errorf("requests = %v, want one metric better_forecast request", reqs)
+	}
+	if n := testutil.CollectAndCount(c, "tempest_forecast_air_temperature_celsius"); n != 1 {
+		t.Errorf("got %d hourly temperatures, want 1", n)
+	}
+	if got := rc.budget.Remaining(); got >= 1 {
+		t.Errorf("budget remaining = %v, want the poll drawn from it", got)
+	}
+}
+
+func TestForecastPoller_PausedWhileTokenRejected(t *testing.T) {
+	srv := weatherflowtest.NewServer("test-token")
+	defer srv.Close()
+
+	c := NewCollector("99999", "test")
+	c.SetWebSocketFailure(errAuth.String(), "401 Unauthorized")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+
+	if err := NewForecastPoller(rc, c, time.Hour, 12).poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if reqs := srv.Requests(); len(reqs) != 0 {
+		t.Errorf("requests = %v, want none while the token is rejected", reqs)
+	}
+}
+
+func TestForecastPoller_KeepsForecastOnError(t *testing.T) {
+	srv := weatherflowtest.NewServer("test-token")
+	defer srv.Close()
+	srv.SetForecast(99999, weatherflow.Forecast{})
+
+	c := NewCollector("99999", "test")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+	p := NewForecastPoller(rc, c, time.Hour, 12)
+
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	srv.FailNext(1, http.StatusInternalServerError, 0)
+	if err := p.poll(context.Background()); err == nil || !strings.Contains(err.Error(), "fetching forecast") {
+		t.Errorf("error = %v, want a fetching forecast error", err)
+	}
+	if n := testutil.CollectAndCount(c, "tempest_forecast_updated_timestamp_seconds"); n != 1 {
+		t.Errorf("got %d forecast update timestamps, want the previous forecast kept", n)
+	}
+}
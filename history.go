@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketObservations = []byte("observations")
+	bucketEvents       = []byte("events")
+)
+
+// historyPruneInterval is how often data older than the retention is deleted.
+const historyPruneInterval = time.Hour
+
+// maxHistoryPoints caps the number of points a single history query may return.
+const maxHistoryPoints = 20000
+
+// HistoryStore is a bounded on-disk store of observations and events, so
+// history survives restarts and is available without Prometheus.
+type HistoryStore struct {
+	db        *bolt.DB
+	retention time.Duration
+}
+
+// OpenHistoryStore opens (or creates) the store at path. Data older than
+// retention is pruned periodically by Run.
+func OpenHistoryStore(path string, retention time.Duration) (*HistoryStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening history store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketObservations, bucketEvents} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("initializing history store: %w", err)
+	}
+	return &HistoryStore{db: db, retention: retention}, nil
+}
+
+// Close closes the underlying database.
+func (h *HistoryStore) Close() error {
+	return h.db.Close()
+}
+
+// Run records strikes and rain start events from bus and prunes expired data
+// until the context is cancelled. Observations are not taken from the bus,
+// which drops events while a subscriber is busy; register Observe with the
+// collector instead. Rapid wind samples are not stored.
+func (h *HistoryStore) Run(ctx context.Context, bus *EventBus) {
+	events, unsubscribe := bus.Subscribe(256)
+	defer unsubscribe()
+
+	h.prune(time.Now())
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.prune(now)
+		case e := <-events:
+			var err error
+			switch d := e.Data.(type) {
+			case Strike:
+				err = h.AddEvent(EventStrike, d.Timestamp, d)
+			case PrecipStart:
+				err = h.AddEvent(EventPrecipStart, d.Timestamp, d)
+			}
+			if err != nil {
+				slog.Error("history store write failed", "type", e.Type, "error", err)
+			}
+		}
+	}
+}
+
+func (h *HistoryStore) prune(now time.Time) {
+	n, err := h.Prune(now.Add(-h.retention).Unix())
+	if err != nil {
+		slog.Error("history store prune failed", "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("history store pruned", "deleted", n)
+	}
+}
+
+// Observe stores obs, logging a failed write. It is registered with
+// Collector.OnObservation and as a backfill sink, so every observation is
+// written synchronously.
+func (h *HistoryStore) Observe(obs Observation) {
+	if err := h.AddObservation(obs); err != nil {
+		slog.Error("history store write failed", "type", EventObservation, "error", err)
+	}
+}
+
+// AddObservation stores obs keyed by its timestamp. Storing the same timestamp
+// again overwrites it, so REST fallback re-polls don't create duplicates.
+func (h *HistoryStore) AddObservation(obs Observation) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketObservations).Put(timeKey(obs.Timestamp), encodeObservation(obs))
+	})
+}
+
+// storedEvent is the JSON value stored for each event.
+type storedEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// AddEvent stores an event at ts. Several events may share a timestamp.
+func (h *HistoryStore) AddEvent(eventType string, ts int64, data any) error {
+	raw, err := json.Marshal(streamPayload(Event{Type: eventType, Data: data}))
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(storedEvent{Type: eventType, Data: raw})
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketEvents)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := binary.BigEndian.AppendUint64(timeKey(ts), seq)
+		return b.Put(key, value)
+	})
+}
+
+// Observations returns stored observations with from <= Timestamp <= to, oldest first.
+func (h *HistoryStore) Observations(from, to int64) ([]Observation, error) {
+	var out []Observation
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketObservations).Cursor()
+		end := timeKey(to)
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) <= string(end); k, v = c.Next() {
+			obs, err := decodeObservation(int64(binary.BigEndian.Uint64(k)), v)
+			if err != nil {
+				return err
+			}
+			out = append(out, obs)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Events returns stored events with from <= timestamp <= to, oldest first.
+func (h *HistoryStore) Events(from, to int64) ([]storedEvent, error) {
+	var out []storedEvent
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketEvents).Cursor()
+		end := timeKey(to + 1)
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) < string(end); k, v = c.Next() {
+			var e storedEvent
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Prune deletes observations and events older than cutoff and returns how many were removed.
+func (h *HistoryStore) Prune(cutoff int64) (int, error) {
+	deleted := 0
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		limit := timeKey(cutoff)
+		for _, name := range [][]byte{bucketObservations, bucketEvents} {
+			c := tx.Bucket(name).Cursor()
+			for k, _ := c.First(); k != nil && string(k[:8]) < string(limit); k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// timeKey encodes a Unix timestamp as a big-endian key so keys sort by time.
+func timeKey(ts int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(ts))
+}
+
+// observationFields returns the observation's values (excluding the timestamp)
+// in obs_st order. It is the single source of field order for storage and
+// downsampling.
+func observationFields(obs Observation) []float64 {
+	return []float64{
+		obs.WindLull, obs.WindAvg, obs.WindGust, obs.WindDirection, obs.WindSampleInterval,
+		obs.StationPressure, obs.AirTemperature, obs.RelativeHumidity, obs.Illuminance,
+		obs.UV, obs.SolarRadiation, obs.RainAccumulated, obs.PrecipitationType,
+		obs.LightningStrikeAvgDist, obs.LightningStrikeCount, obs.Battery, obs.ReportInterval,
+	}
+}
+
+func observationFromFields(ts int64, f []float64) Observation {
+	return Observation{
+		Timestamp: ts,
+		WindLull:  f[0], WindAvg: f[1], WindGust: f[2], WindDirection: f[3], WindSampleInterval: f[4],
+		StationPressure: f[5], AirTemperature: f[6], RelativeHumidity: f[7], Illuminance: f[8],
+		UV: f[9], SolarRadiation: f[10], RainAccumulated: f[11], PrecipitationType: f[12],
+		LightningStrikeAvgDist: f[13], LightningStrikeCount: f[14], Battery: f[15], ReportInterval: f[16],
+	}
+}
+
+const observationFieldCount = obsSTFieldCount - 1
+
+// encodeObservation packs the observation's fields as big-endian float64 bits,
+// which preserves NaN for missing values.
+func encodeObservation(obs Observation) []byte {
+	buf := make([]byte, 0, observationFieldCount*8)
+	for _, v := range observationFields(obs) {
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+	return buf
+}
+
+func decodeObservation(ts int64, data []byte) (Observation, error) {
+	if len(data) != observationFieldCount*8 {
+		return Observation{}, fmt.Errorf("corrupt observation at %d: %d bytes", ts, len(data))
+	}
+	f := make([]float64, observationFieldCount)
+	for i := range f {
+		f[i] = math.Float64frombits(binary.BigEndian.Uint64(data[i*8:]))
+	}
+	return observationFromFields(ts, f), nil
+}
+
+// fieldAggregation is how each observation field is combined when downsampling,
+// indexed like observationFields.
+type aggregation int
+
+const (
+	aggMean aggregation = iota
+	aggMin
+	aggMax
+	aggSum
+	aggLast
+)
+
+var fieldAggregation = [observationFieldCount]aggregation{
+	aggMin,  // wind lull
+	aggMean, // wind avg
+	aggMax,  // wind gust
+	aggMean, // wind direction
+	aggLast, // wind sample interval
+	aggMean, // station pressure
+	aggMean, // air temperature
+	aggMean, // relative humidity
+	aggMean, // illuminance
+	aggMean, // UV
+	aggMean, // solar radiation
+	aggSum,  // rain accumulated
+	aggMax,  // precipitation type
+	aggMean, // lightning strike avg distance
+	aggSum,  // lightning strike count
+	aggLast, // battery
+	aggLast, // report interval
+}
+
+// Downsample groups observations into step-second buckets aligned to the Unix
+// epoch. Each bucket is stamped with its start time; rain and strike counts
+// are summed, gust and lull use max and min, and other fields are averaged.
+// Wind direction uses the circular mean. A step of 0 returns obs unchanged.
+func Downsample(obs []Observation, step int64) []Observation {
+	if step <= 0 || len(obs) == 0 {
+		return obs
+	}
+
+	var out []Observation
+	var group []Observation
+	flush := func() {
+		if len(group) > 0 {
+			out = append(out, aggregateBucket(group[0].Timestamp/step*step, group))
+			group = group[:0]
+		}
+	}
+	for _, o := range obs {
+		if len(group) > 0 && o.Timestamp/step != group[0].Timestamp/step {
+			flush()
+		}
+		group = append(group, o)
+	}
+	flush()
+	return out
+}
+
+func aggregateBucket(ts int64, group []Observation) Observation {
+	result := make([]float64, observationFieldCount)
+	for i := range result {
+		result[i] = math.NaN()
+	}
+
+	var sinSum, cosSum float64
+	var dirCount int
+	sums := make([]float64, observationFieldCount)
+	counts := make([]int, observationFieldCount)
+
+	for _, o := range group {
+		for i, v := range observationFields(o) {
+			if math.IsNaN(v) {
+				continue
+			}
+			counts[i]++
+			switch fieldAggregation[i] {
+			case aggMean, aggSum:
+				sums[i] += v
+			case aggMin:
+				if counts[i] == 1 || v < result[i] {
+					result[i] = v
+				}
+			case aggMax:
+				if counts[i] == 1 || v > result[i] {
+					result[i] = v
+				}
+			case aggLast:
+				result[i] = v
+			}
+		}
+		if !math.IsNaN(o.WindDirection) {
+			rad := o.WindDirection * math.Pi / 180
+			sinSum += math.Sin(rad)
+			cosSum += math.Cos(rad)
+			dirCount++
+		}
+	}
+
+	for i, agg := range fieldAggregation {
+		if counts[i] == 0 {
+			continue
+		}
+		switch agg {
+		case aggMean:
+			result[i] = sums[i] / float64(counts[i])
+		case aggSum:
+			result[i] = sums[i]
+		}
+	}
+	if dirCount > 0 {
+		deg := math.Atan2(sinSum, cosSum) * 180 / math.Pi
+		if deg < 0 {
+			deg += 360
+		}
+		result[3] = deg
+	}
+	return observationFromFields(ts, result)
+}
+
+// historyResponse is the /api/v1/history response body.
+type historyResponse struct {
+	From         int64             `json:"from"`
+	To           int64             `json:"to"`
+	Step         int64             `json:"step"`
+	Observations []restObs         `json:"observations"`
+	Events       []json.RawMessage `json:"events"`
+}
+
+// historyHandler serves /api/v1/history?from=&to=&step=. from and to accept
+// Unix seconds or RFC 3339 and default to the last 24 hours; step is a
+// duration ("5m") or seconds, and 0 or absent returns raw observations.
+func historyHandler(store *HistoryStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		now := time.Now()
+
+		to, err := parseTimeParam(q.Get("to"), now)
+		if err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		from, err := parseTimeParam(q.Get("from"), to.Add(-24*time.Hour))
+		if err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if from.After(to) {
+			http.Error(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+		step, err := parseStepParam(q.Get("step"))
+		if err != nil {
+			http.Error(w, "invalid step: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		obs, err := store.Observations(from.Unix(), to.Unix())
+		if err != nil {
+			slog.Error("history query failed", "error", err)
+			http.Error(w, "history query failed", http.StatusInternalServerError)
+			return
+		}
+		obs = Downsample(obs, step)
+		if len(obs) > maxHistoryPoints {
+			http.Error(w, fmt.Sprintf("query returns %d points, more than %d; increase step", len(obs), maxHistoryPoints),
+				http.StatusBadRequest)
+			return
+		}
+		events, err := store.Events(from.Unix(), to.Unix())
+		if err != nil {
+			slog.Error("history query failed", "error", err)
+			http.Error(w, "history query failed", http.StatusInternalServerError)
+			return
+		}
+
+		resp := historyResponse{
+			From:         from.Unix(),
+			To:           to.Unix(),
+			Step:         step,
+			Observations: make([]restObs, 0, len(obs)),
+			Events:       make([]json.RawMessage, 0, len(events)),
+		}
+		for _, o := range obs {
+			resp.Observations = append(resp.Observations, observationToRESTObs(o))
+		}
+		for _, e := range events {
+			// Flatten {"type", "data": {...}} to {"type", ...data}.
+			var fields map[string]any
+			_ = json.Unmarshal(e.Data, &fields)
+			if fields == nil {
+				fields = map[string]any{}
+			}
+			fields["type"] = e.Type
+			raw, _ := json.Marshal(fields)
+			resp.Events = append(resp.Events, raw)
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// parseTimeParam parses Unix seconds or RFC 3339, returning def when empty.
+// Times before 1970 are rejected: keys are unsigned, so they would match
+// nothing.
+func parseTimeParam(v string, def time.Time) (time.Time, error) {
+	t := def
+	if v != "" {
+		var err error
+		if secs, perr := strconv.ParseInt(v, 10, 64); perr == nil {
+			t = time.Unix(secs, 0)
+		} else if t, err = time.Parse(time.RFC3339, v); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if t.Unix() < 0 {
+		return time.Time{}, fmt.Errorf("must not be before 1970")
+	}
+	return t, nil
+}
+
+// parseStepParam parses a Go duration or a number of seconds. Durations
+// must be whole seconds, so a sub-second step doesn't silently become 0,
+// which means raw observations.
+func parseStepParam(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("must not be negative")
+		}
+		return secs, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("must be whole seconds")
+	}
+	return int64(d / time.Second), nil
+}
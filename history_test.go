@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestHistoryStore(t *testing.T) *HistoryStore {
+	t.Helper()
+	store, err := OpenHistoryStore(filepath.Join(t.TempDir(), "history.db"), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("OpenHistoryStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestHistoryStore_ObservationRoundTrip(t *testing.T) {
+	store := newTestHistoryStore(t)
+
+	obs := testObservation()
+	obs.UV = math.NaN()
+	if err := store.AddObservation(obs); err != nil {
+		t.Fatalf("AddObservation: %v", err)
+	}
+	// Same timestamp overwrites rather than duplicating.
+	if err := store.AddObservation(obs); err != nil {
+		t.Fatalf("AddObservation: %v", err)
+	}
+
+	got, err := store.Observations(obs.Timestamp, obs.Timestamp)
+	if err != nil {
+		t.Fatalf("Observations: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d observations, want 1", len(got))
+	}
+	if !math.IsNaN(got[0].UV) {
+		t.Errorf("UV = %v, want NaN preserved", got[0].UV)
+	}
+	got[0].UV = 0
+	obs.UV = 0
+	if got[0] != obs {
+		t.Errorf("round trip = %+v, want %+v", got[0], obs)
+	}
+}
+
+func TestHistoryStore_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := OpenHistoryStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := store.AddObservation(testObservation()); err != nil {
+		t.Fatalf("AddObservation: %v", err)
+	}
+	_ = store.Close()
+
+	store, err = OpenHistoryStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	got, _ := store.Observations(0, math.MaxInt64)
+	if len(got) != 1 {
+		t.Errorf("got %d observations after reopen, want 1", len(got))
+	}
+}
+
+func TestHistoryStore_EventsAndPrune(t *testing.T) {
+	store := newTestHistoryStore(t)
+
+	for i := int64(0); i < 5; i++ {
+		_ = store.AddObservation(Observation{Timestamp: 1000 + i*60})
+	}
+	_ = store.AddEvent(EventStrike, 1060, Strike{Timestamp: 1060, Distance: 12, Energy: 50})
+	_ = store.AddEvent(EventStrike, 1060, Strike{Timestamp: 1060, Distance: 8, Energy: 20})
+	_ = store.AddEvent(EventPrecipStart, 1200, PrecipStart{Timestamp: 1200})
+
+	events, err := store.Events(1060, 1060)
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != EventStrike {
+		t.Fatalf("events at 1060 = %+v, want 2 strikes", events)
+	}
+
+	n, err := store.Prune(1120)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if n != 4 { // 2 observations + 2 strikes
+		t.Errorf("pruned %d, want 4", n)
+	}
+	obs, _ := store.Observations(0, math.MaxInt64)
+	if len(obs) != 3 || obs[0].Timestamp != 1120 {
+		t.Errorf("remaining observations = %v", obs)
+	}
+	events, _ = store.Events(0, math.MaxInt64)
+	if len(events) != 1 || events[0].Type != EventPrecipStart {
+		t.Errorf("remaining events = %+v", events)
+	}
+}
+
+func TestHistoryStore_RunStoresBusEvents(t *testing.T) {
+	store := newTestHistoryStore(t)
+	bus := NewEventBus()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.Run(ctx, bus)
+		close(done)
+	}()
+	for bus.Subscribers() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	now := time.Now().Unix()
+	bus.Publish(Event{Type: EventObservation, Data: Observation{Timestamp: now}})
+	bus.Publish(Event{Type: EventRapidWind, Data: RapidWind{Timestamp: now}})
+	bus.Publish(Event{Type: EventPrecipStart, Data: PrecipStart{Timestamp: now}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events, _ := store.Events(now, now)
+		if len(events) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("store has %d events, want 1", len(events))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	// Observations come from the collector, not the lossy bus.
+	if obs, _ := store.Observations(now, now); len(obs) != 0 {
+		t.Errorf("stored %d observations from the bus, want 0", len(obs))
+	}
+}
+
+func TestHistoryStore_ObserveFromCollector(t *testing.T) {
+	store := newTestHistoryStore(t)
+	c := NewCollector("1", "test")
+	c.OnObservation(store.Observe)
+
+	// More observations than any bus buffer holds, with nobody reading.
+	for ts := int64(1); ts <= 1000; ts++ {
+		c.UpdateObservation(Observation{Timestamp: 1700000000 + ts*60})
+	}
+	if obs, _ := store.Observations(0, math.MaxInt64); len(obs) != 1000 {
+		t.Errorf("stored %d observations, want all 1000", len(obs))
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	mk := func(ts int64, temp, gust, lull, rain, dir float64) Observation {
+		o := Observation{Timestamp: ts, AirTemperature: temp, WindGust: gust, WindLull: lull,
+			RainAccumulated: rain, WindDirection: dir, Battery: float64(ts)}
+		return o
+	}
+	obs := []Observation{
+		mk(300, 10, 5, 1, 0.1, 350),
+		mk(360, 20, 9, 0.5, 0.2, 10),
+		mk(420, math.NaN(), 3, 2, 0.3, 0),
+		mk(600, 30, 1, 1, 0, 90),
+	}
+
+	got := Downsample(obs, 300)
+	if len(got) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(got))
+	}
+	b := got[0]
+	if b.Timestamp != 300 {
+		t.Errorf("bucket timestamp = %d, want 300", b.Timestamp)
+	}
+	if b.AirTemperature != 15 {
+		t.Errorf("mean temp = %v, want 15 (NaN skipped)", b.AirTemperature)
+	}
+	if b.WindGust != 9 || b.WindLull != 0.5 {
+		t.Errorf("gust/lull = %v/%v, want 9/0.5", b.WindGust, b.WindLull)
+	}
+	if math.Abs(b.RainAccumulated-0.6) > 1e-9 {
+		t.Errorf("rain = %v, want 0.6 (sum)", b.RainAccumulated)
+	}
+	if b.Battery != 420 {
+		t.Errorf("battery = %v, want last value 420", b.Battery)
+	}
+	// Circular mean of 350°, 10° and 0° is 0°, not 120°.
+	if d := math.Min(b.WindDirection, 360-b.WindDirection); d > 1e-6 {
+		t.Errorf("wind direction = %v, want ~0", b.WindDirection)
+	}
+	if got[1].Timestamp != 600 || got[1].AirTemperature != 30 {
+		t.Errorf("second bucket = %+v", got[1])
+	}
+
+	if raw := Downsample(obs, 0); len(raw) != len(obs) {
+		t.Errorf("step 0 should return raw observations")
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	store := newTestHistoryStore(t)
+	for i := int64(0); i < 10; i++ {
+		o := testObservation()
+		o.Timestamp = 1700000000 + i*60
+		_ = store.AddObservation(o)
+	}
+	_ = store.AddEvent(EventStrike, 1700000060, Strike{Timestamp: 1700000060, Distance: 12, Energy: 50})
+
+	h := historyHandler(store)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/history?from=1700000000&to=2023-11-14T22:22:20Z&step=5m", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Step         int64            `json:"step"`
+		Observations []map[string]any `json:"observations"`
+		Events       []map[string]any `json:"events"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Step != 300 {
+		t.Errorf("step = %d, want 300", resp.Step)
+	}
+	// 1700000000 is not aligned to 300s: buckets start at 1699999800, 1700000100 and 1700000400.
+	if len(resp.Observations) != 3 {
+		t.Fatalf("got %d points, want 3", len(resp.Observations))
+	}
+	if resp.Observations[0]["timestamp"] != 1699999800.0 {
+		t.Errorf("first bucket timestamp = %v, want 1699999800", resp.Observations[0]["timestamp"])
+	}
+	if resp.Observations[0]["air_temperature"] != 22.5 {
+		t.Errorf("air_temperature = %v", resp.Observations[0]["air_temperature"])
+	}
+	if len(resp.Events) != 1 || resp.Events[0]["type"] != EventStrike || resp.Events[0]["distance"] != 12.0 {
+		t.Errorf("events = %v", resp.Events)
+	}
+}
+
+func TestHistoryHandler_BadParams(t *testing.T) {
+	h := historyHandler(newTestHistoryStore(t))
+	for _, q := range []string{
+		"from=yesterday",
+		"to=abc",
+		"from=200&to=100",
+		"step=-5",
+		"step=500ms",
+		"step=1500ms",
+		"from=-1",
+		"to=1969-12-31T23:59:59Z",
+		"step=soon",
+	} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/api/v1/history?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", q, w.Code)
+		}
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
-	"net"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // station time zones for CWOP rain totals, whatever the base image ships
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -24,52 +25,50 @@ var version = "dev"
 var validStationName = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
 
 func main() {
+	// Log with LOG_FORMAT until the config is loaded, so config errors are
+	// formatted as expected.
+	setupLogging(os.Getenv("LOG_FORMAT"))
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backfill":
+			os.Exit(runBackfillCommand(os.Args[2:]))
+		case "watch":
+			os.Exit(runWatchCommand(os.Args[2:]))
+		case "simulate":
+			os.Exit(runSimulateCommand(os.Args[2:]))
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "oauth":
+			os.Exit(runOAuthCommand(os.Args[2:]))
+		}
+	}
+
 	showVersion := flag.Bool("version", false, "print version and exit")
+	loadConfig := configFlags(flag.CommandLine)
 	flag.Parse()
 	if *showVersion {
 		fmt.Println(version)
 		os.Exit(0)
 	}
 
-	// Default to JSON logging; use text for local dev via LOG_FORMAT=text
-	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
-	} else {
-		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
-	}
-
-	token := os.Getenv("TEMPEST_TOKEN")
-	deviceID := os.Getenv("TEMPEST_DEVICE_ID")
-	stationID := os.Getenv("TEMPEST_STATION_ID")
-
-	if token == "" || deviceID == "" || stationID == "" {
-		slog.Error("missing required environment variables",
-			"required", "TEMPEST_TOKEN, TEMPEST_DEVICE_ID, TEMPEST_STATION_ID")
-		os.Exit(1)
-	}
-
-	stationName := os.Getenv("TEMPEST_STATION_NAME")
-	if stationName == "" {
-		stationName = "tempest"
+	cfg, err := loadConfig()
+	if err == nil {
+		err = cfg.Validate()
 	}
-	if !validStationName.MatchString(stationName) {
-		slog.Error("invalid TEMPEST_STATION_NAME: must contain only alphanumeric, underscore, hyphen, or dot characters",
-			"value", stationName)
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
 		os.Exit(1)
 	}
+	setupLogging(cfg.Log.Format)
 
-	listenAddr := os.Getenv("LISTEN_ADDR")
-	if listenAddr == "" {
-		listenAddr = ":8080"
-	}
-	if _, _, err := net.SplitHostPort(listenAddr); err != nil {
-		slog.Error("invalid LISTEN_ADDR", "value", listenAddr, "error", err)
-		os.Exit(1)
-	}
+	deviceID := cfg.Tempest.DeviceID
+	stationID := cfg.Tempest.StationID
+	stationName := cfg.Tempest.StationName
 
 	slog.Info("starting tempest-exporter",
 		"version", version,
-		"listen_addr", listenAddr,
+		"listen_addr", cfg.Server.ListenAddr,
 		"device_id", deviceID,
 		"station_id", stationID,
 		"station_name", stationName,
@@ -78,27 +77,198 @@ func main() {
 	collector := NewCollector(stationID, stationName)
 	prometheus.MustRegister(collector)
 
-	wsClient := NewClient(token, deviceID, collector)
-	restClient := NewRESTClient(token, stationID, collector)
+	// Rolling rain totals (used by CWOP uploads, persisted in the state file)
+	rain := &rainAccumulator{}
+	collector.OnObservation(rain.Observe)
+
+	// Optional state file: restore before any client starts
+	var state *StateStore
+	if path := cfg.State.Path; path != "" {
+		state = NewStateStore(path, collector, rain, cfg.State.MaxAge)
+		if err := state.Load(time.Now()); err != nil {
+			slog.Warn("ignoring unusable state file", "path", path, "error", err)
+		}
+	}
+
+	wsClient := newClientFromConfig(cfg, cfg.Tempest.Token, deviceID, collector)
+	restClient := NewRESTClient(cfg.Tempest.Token, stationID, collector)
+	restClient.baseURL = strings.TrimSuffix(cfg.Tempest.RESTURL, "/")
+	restClient.budget = newRequestBudget(cfg.REST.RequestsPerMinute, cfg.REST.Burst)
+	collector.SetRESTBudget(restClient.budget)
+
+	// The station's time zone, whose midnight resets the rain since
+	// midnight for the JSON API, the dashboard and CWOP
+	var loc *time.Location
+	if cfg.CWOP.Timezone != "" {
+		loc, _ = time.LoadLocation(cfg.CWOP.Timezone)
+	}
+	zone := newStationZone(loc, restClient.FetchStation)
+
+	// Typed events for /api/v1/stream
+	events := NewEventBus()
+	wsClient.SetEventBus(events)
+	collector.OnObservation(func(obs Observation) {
+		events.Publish(Event{Type: EventObservation, Data: obs})
+	})
+	if cfg.Tempest.RapidWind {
+		wsClient.EnableRapidWind()
+	}
+
+	// Optional local WebSocket fan-out of the upstream connection
+	var proxy *WSProxy
+	if cfg.Proxy.Enabled {
+		proxy = NewWSProxy(cfg.Proxy.MaxClients)
+		wsClient.OnMessage(proxy.Publish)
+		slog.Info("websocket proxy enabled", "path", wsProxyPath, "max_clients", cfg.Proxy.MaxClients)
+	}
+
+	// Optional recording of every upstream message
+	if path := cfg.Record.Path; path != "" {
+		recorder, err := NewRecorder(path, int64(cfg.Record.MaxMB)<<20, cfg.Record.MaxFiles)
+		if err != nil {
+			slog.Error("failed to open recording", "path", path, "error", err)
+			os.Exit(1)
+		}
+		defer func() { _ = recorder.Close() }()
+		recorder.Attach(wsClient)
+		slog.Info("recording upstream messages", "path", path, "max_mb", cfg.Record.MaxMB, "max_files", cfg.Record.MaxFiles)
+	}
+
+	// Optional on-disk history store. Observations are written as the
+	// collector receives them rather than through the event bus, which
+	// drops events for slow subscribers.
+	var store *HistoryStore
+	if path := cfg.History.Path; path != "" {
+		var err error
+		store, err = OpenHistoryStore(path, cfg.History.Retention)
+		if err != nil {
+			slog.Error("failed to open history store", "error", err)
+			os.Exit(1)
+		}
+		defer func() { _ = store.Close() }()
+		collector.OnObservation(store.Observe)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start WebSocket client
-	go wsClient.Run(ctx)
+	if replayPaths := cfg.Replay.Paths; len(replayPaths) > 0 {
+		// Replay through the WebSocket handlers; the REST fallback stays off
+		// so the replayed data isn't mixed with live data.
+		go func() {
+			collector.SetConnected(true)
+			n, err := ReplayFiles(ctx, replayPaths, cfg.Replay.Speed, wsClient.dispatch)
+			collector.SetConnected(false)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("replay failed", "error", err, "replayed", n)
+				return
+			}
+			slog.Info("replay finished", "messages", n)
+		}()
+		slog.Info("replaying recording", "paths", replayPaths, "speed", cfg.Replay.Speed)
+	} else {
+		// Start WebSocket client
+		go wsClient.Run(ctx)
+
+		// Start REST fallback (activates after the WebSocket has been down for
+		// fallback.threshold, then polls every fallback.poll_interval)
+		go restClient.RunFallback(ctx, cfg.Fallback.Threshold, cfg.Fallback.PollInterval)
+
+		go func() {
+			if err := zone.Resolve(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("using the local time zone for rain since midnight", "error", err)
+			}
+		}()
+	}
+
+	if state != nil {
+		go state.Run(ctx, cfg.State.Interval)
+	}
+
+	// Optional CWOP (APRS-IS) uploader
+	if cfg.CWOP.Callsign != "" {
+		uploader := newCWOPUploaderFromConfig(cfg.CWOP, restClient, collector, rain, zone)
+		slog.Info("CWOP uploads enabled", "callsign", cfg.CWOP.Callsign, "interval", cfg.CWOP.Interval)
+		go uploader.Run(ctx, cfg.CWOP.Interval)
+	}
+
+	// Optional forecast metrics from better_forecast
+	if cfg.Forecast.Enabled && len(cfg.Replay.Paths) == 0 {
+		poller := NewForecastPoller(restClient, collector, cfg.Forecast.Interval, cfg.Forecast.Hours)
+		slog.Info("forecast metrics enabled", "interval", cfg.Forecast.Interval, "hours", cfg.Forecast.Hours)
+		go poller.Run(ctx)
+	}
+
+	mux := newMux(collector, rain, zone)
+	mux.Handle("GET /api/v1/stream", streamHandler(events))
+
+	if store != nil {
+		go store.Run(ctx, events)
+		mux.Handle("GET /api/v1/history", historyHandler(store))
+		slog.Info("history store enabled", "path", cfg.History.Path, "retention", cfg.History.Retention)
+	}
+
+	// Optional gap backfill from REST device history
+	var backfiller *Backfiller
+	if cfg.Backfill.Enabled {
+		backfiller = NewBackfiller(restClient, collector, deviceID, cfg.Backfill.Threshold, cfg.Backfill.MaxAge)
+		backfiller.AddSink(rain.Observe)
+		if store != nil {
+			backfiller.AddSink(store.Observe)
+		}
+		go backfiller.Run(ctx)
+		slog.Info("gap backfill enabled", "max_age", cfg.Backfill.MaxAge)
+	}
+	if proxy != nil {
+		mux.Handle(wsProxyPath, proxy)
+	}
+	var cache *RESTCache
+	if cfg.RESTCache.Enabled {
+		cache = NewRESTCache(collector, stationID, stationName, deviceID)
+		if store != nil {
+			cache.UseStore(store)
+		}
+		cache.Register(mux)
+		slog.Info("REST cache endpoints enabled", "path", "/swd/rest/observations/")
+	}
 
-	// Start REST fallback (activates after 5min disconnect, polls every 60s)
-	go restClient.RunFallback(ctx, 5*time.Minute, 60*time.Second)
+	// Reload the config and secret files on SIGHUP or when they change
+	reloader := NewReloader(cfg, loadConfig, func(cfg *Config) {
+		t := cfg.Tempest
+		setupLogging(cfg.Log.Format)
+		collector.SetStation(t.StationID, t.StationName)
+		restClient.SetCredentials(t.Token, t.StationID)
+		wsClient.Reconfigure(t.Token, t.DeviceID, t.RapidWind)
+		if cache != nil {
+			cache.SetStation(t.StationID, t.StationName, t.DeviceID)
+		}
+		if backfiller != nil {
+			backfiller.SetDevice(t.DeviceID)
+		}
+	})
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go reloader.Run(ctx, hupCh)
 
-	mux := newMux(collector)
+	// Renew an expiring OAuth access token; the reload then applies the
+	// renewed token from the store
+	if cfg.OAuth.TokenPath != "" && len(cfg.Replay.Paths) == 0 {
+		renewer := NewTokenRenewer(NewOAuthClient(cfg.OAuth), cfg.OAuth.TokenPath)
+		go renewer.Run(ctx, func() {
+			if err := reloader.Reload(); err != nil {
+				slog.Error("configuration reload failed", "error", err)
+			}
+		})
+		slog.Info("OAuth token renewal enabled", "token_path", cfg.OAuth.TokenPath)
+	}
 
 	srv := &http.Server{
-		Addr:              listenAddr,
+		Addr:              cfg.Server.ListenAddr,
 		Handler:           mux,
-		ReadHeaderTimeout: 10 * time.Second,
-		ReadTimeout:       30 * time.Second,
-		WriteTimeout:      60 * time.Second,
-		IdleTimeout:       120 * time.Second,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 
 	// Graceful shutdown
@@ -110,7 +280,7 @@ func main() {
 		slog.Info("received signal, shutting down", "signal", sig.String())
 		cancel()
 
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 		defer shutdownCancel()
 
 		if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -118,23 +288,98 @@ func main() {
 		}
 	}()
 
-	slog.Info("HTTP server listening", "addr", listenAddr)
+	slog.Info("HTTP server listening", "addr", cfg.Server.ListenAddr)
 	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
 		slog.Error("HTTP server error", "error", err)
 		os.Exit(1)
 	}
+	if state != nil {
+		if err := state.Save(time.Now()); err != nil {
+			slog.Error("failed to save state", "error", err)
+		}
+	}
 	slog.Info("server stopped")
 }
 
-// newMux creates the HTTP handler with /metrics, /healthz, and /readyz endpoints.
-func newMux(collector *Collector) *http.ServeMux {
+// setupLogging logs JSON to stderr, or text when format is "text". Secrets
+// in logSecrets are masked in every record.
+func setupLogging(format string) {
+	var h slog.Handler
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(os.Stderr, nil)
+	} else {
+		h = slog.NewJSONHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(newRedactHandler(h, &logSecrets)))
+}
+
+// newClientFromConfig builds the WebSocket client from the tempest and
+// websocket sections of cfg. Rapid wind is left to the caller. cfg must have
+// been validated.
+func newClientFromConfig(cfg *Config, token, deviceID string, c *Collector) *Client {
+	client := NewClient(token, deviceID, c)
+	client.wsURL = cfg.Tempest.WSURL
+	client.readTimeout = cfg.WebSocket.ReadTimeout
+	client.minBackoff = cfg.WebSocket.MinBackoff
+	client.maxBackoff = cfg.WebSocket.MaxBackoff
+	client.backoffReset = cfg.WebSocket.BackoffReset
+	client.breakerFailures = cfg.WebSocket.BreakerFailures
+	client.breakerCooldown = cfg.WebSocket.BreakerCooldown
+	client.tokenInURL = cfg.WebSocket.TokenInURL
+	client.fatalRetry = cfg.WebSocket.FatalRetryInterval
+	client.ackTimeout = cfg.WebSocket.AckTimeout
+	client.staleIntervals = cfg.WebSocket.StaleIntervals
+	return client
+}
+
+// newCWOPUploaderFromConfig builds the CWOP uploader. The station position
+// comes from cfg when set, otherwise it is looked up from the REST /stations
+// endpoint on first upload. cfg must have been validated.
+func newCWOPUploaderFromConfig(cfg CWOPConfig, restClient *RESTClient, collector *Collector, rain *rainAccumulator, zone *stationZone) *CWOPUploader {
+	var pos *Position
+	if cfg.Latitude != nil {
+		pos = &Position{Latitude: *cfg.Latitude, Longitude: *cfg.Longitude, Elevation: *cfg.Elevation}
+	}
+
+	aprs := NewAPRSClient(cfg.Server, cfg.Callsign, cfg.Passcode)
+	return NewCWOPUploader(aprs, collector, rain, pos, zone, restClient.FetchStation)
+}
+
+// checkPosition range-checks latitude and longitude.
+func checkPosition(lat, lon float64) error {
+	if lat < -90 || lat > 90 || math.IsNaN(lat) {
+		return fmt.Errorf("invalid latitude %v", lat)
+	}
+	if lon < -180 || lon > 180 || math.IsNaN(lon) {
+		return fmt.Errorf("invalid longitude %v", lon)
+	}
+	return nil
+}
+
+// newMux creates the HTTP handler with /metrics, /healthz, /readyz, the JSON API
+// and the dashboard. rain may be nil, in which case rain totals are omitted;
+// their midnight is in zone, or the local zone if zone is nil.
+func newMux(collector *Collector, rain *rainAccumulator, zone *stationZone) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("GET /api/v1/current", currentHandler(collector, rain, zone))
+	dashboard := dashboardHandler()
+	mux.Handle("GET /{$}", dashboard)
+	mux.Handle("GET /assets/", dashboard)
+	// /healthz is the liveness probe and only reports that the process is
+	// serving: restarting on a rejected token would redial straight away
+	// with the same token and lose a pending hot reload. The rejection is
+	// reported by /readyz instead.
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = fmt.Fprintln(w, "ok")
 	})
 	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if class, msg := collector.WebSocketFailure(); class != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "not ready: websocket %s error: %s\n", class, msg)
+			return
+		}
 		if collector.HasObservation() {
 			w.WriteHeader(http.StatusOK)
 			_, _ = fmt.Fprintln(w, "ready")
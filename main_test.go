@@ -1,15 +1,17 @@
 package main
 
 import (
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHealthz(t *testing.T) {
 	c := NewCollector("99999", "test")
-	mux := newMux(c)
+	mux := newMux(c, nil, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	w := httptest.NewRecorder()
@@ -23,9 +25,34 @@ func TestHealthz(t *testing.T) {
 	}
 }
 
+func TestHealthz_WebSocketFailure(t *testing.T) {
+	c := NewCollector("99999", "test")
+	c.UpdateObservation(Observation{Timestamp: 1700000000, AirTemperature: 22.5})
+	mux := newMux(c, nil, nil)
+	c.SetWebSocketFailure("auth", "websocket dial failed: status 401")
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("healthz = %d, want 200 so the pod is not restarted", w.Code)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "auth") {
+		t.Errorf("readyz = %d %q, want 503 naming the auth failure", w.Code, w.Body.String())
+	}
+
+	c.SetConnected(true)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("readyz after reconnect = %d, want 200", w.Code)
+	}
+}
+
 func TestReadyz_NotReady(t *testing.T) {
 	c := NewCollector("99999", "test")
-	mux := newMux(c)
+	mux := newMux(c, nil, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	w := httptest.NewRecorder()
@@ -40,7 +67,7 @@ func TestReadyz_Ready(t *testing.T) {
 	c := NewCollector("99999", "test")
 	obs := Observation{Timestamp: 1700000000, AirTemperature: 22.5}
 	c.UpdateObservation(obs)
-	mux := newMux(c)
+	mux := newMux(c, nil, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	w := httptest.NewRecorder()
@@ -56,7 +83,7 @@ func TestReadyz_Ready(t *testing.T) {
 
 func TestMetricsEndpoint(t *testing.T) {
 	c := NewCollector("99999", "test")
-	mux := newMux(c)
+	mux := newMux(c, nil, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
 	w := httptest.NewRecorder()
@@ -87,3 +114,46 @@ func TestValidStationName(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckPosition(t *testing.T) {
+	if err := checkPosition(40.7608, -111.891); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range [][2]float64{
+		{91, 0},
+		{0, -181},
+		{math.NaN(), 0},
+		{0, math.Inf(1)},
+	} {
+		if err := checkPosition(tc[0], tc[1]); err == nil {
+			t.Errorf("checkPosition(%v, %v) should fail", tc[0], tc[1])
+		}
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Tempest.WSURL = "ws://127.0.0.1:1/swd/data"
+	cfg.WebSocket.ReadTimeout = 7 * time.Minute
+	cfg.WebSocket.BreakerFailures = 9
+	cfg.WebSocket.TokenInURL = false
+	cfg.WebSocket.StaleIntervals = 4
+
+	c := newClientFromConfig(cfg, "tok", "123", NewCollector("12345", "backyard"))
+	if c.wsURL != cfg.Tempest.WSURL {
+		t.Errorf("wsURL = %q, want %q", c.wsURL, cfg.Tempest.WSURL)
+	}
+	if c.readTimeout != 7*time.Minute {
+		t.Errorf("readTimeout = %v, want 7m", c.readTimeout)
+	}
+	if c.breakerFailures != 9 {
+		t.Errorf("breakerFailures = %d, want 9", c.breakerFailures)
+	}
+	if c.tokenInURL {
+		t.Error("tokenInURL should be false")
+	}
+	if c.staleIntervals != 4 {
+		t.Errorf("staleIntervals = %d, want 4", c.staleIntervals)
+	}
+}
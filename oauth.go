@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultOAuthAuthURL     = "https://tempestwx.com/authorize.html"
+	defaultOAuthTokenURL    = "https://swd.weatherflow.com/id/oauth2/token"
+	defaultOAuthRedirectURL = "http://localhost:8085/callback"
+
+	// oauthRenewBefore is how long before expiry an access token is renewed.
+	oauthRenewBefore = 5 * time.Minute
+	// oauthRecheckInterval is the longest the renewer waits before reading
+	// the token store again, so a store replaced by "oauth login" is noticed.
+	oauthRecheckInterval = time.Hour
+	// oauthRetryBackoff is the first wait after a failed renewal; it doubles
+	// per failure up to maxOAuthRetryWait.
+	oauthRetryBackoff = time.Minute
+	maxOAuthRetryWait = 30 * time.Minute
+)
+
+// oauthToken is the content of the token store.
+type oauthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Expiry is the access token's expiry in Unix seconds; 0 if it doesn't
+	// expire.
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// loadOAuthToken reads the token store at path.
+func loadOAuthToken(path string) (*oauthToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tok oauthToken
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("%s has no access token", path)
+	}
+	return &tok, nil
+}
+
+// saveOAuthToken replaces the token store at path. The file is readable only
+// by its owner.
+func saveOAuthToken(path string, tok *oauthToken) error {
+	data, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding token: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".oauth-token-*")
+	if err != nil {
+		return fmt.Errorf("creating temp token file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing token file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("syncing token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing token file: %w", err)
+	}
+	return nil
+}
+
+// oauthError is an error response from the token endpoint.
+type oauthError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	msg := fmt.Sprintf("token endpoint returned %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// Permanent reports whether retrying cannot succeed, because the grant or
+// the client was rejected.
+func (e *oauthError) Permanent() bool {
+	switch e.Code {
+	case "invalid_grant", "invalid_client", "unauthorized_client":
+		return true
+	}
+	return false
+}
+
+// OAuthClient runs the authorization-code flow against the WeatherFlow
+// OAuth endpoints.
+type OAuthClient struct {
+	cfg        OAuthConfig
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewOAuthClient creates a client for the configured OAuth application.
+func NewOAuthClient(cfg OAuthConfig) *OAuthClient {
+	return &OAuthClient{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// AuthCodeURL returns the URL where the station owner grants access. state
+// is echoed back to the redirect URL.
+func (o *OAuthClient) AuthCodeURL(state string) string {
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.cfg.ClientID},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"state":         {state},
+	}
+	sep := "?"
+	if strings.Contains(o.cfg.AuthURL, "?") {
+		sep = "&"
+	}
+	return o.cfg.AuthURL + sep + q.Encode()
+}
+
+// Exchange trades an authorization code for tokens.
+func (o *OAuthClient) Exchange(ctx context.Context, code string) (*oauthToken, error) {
+	return o.token(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.cfg.RedirectURL},
+	})
+}
+
+// Refresh trades a refresh token for a new access token. The response may
+// omit the refresh token, in which case the old one stays valid.
+func (o *OAuthClient) Refresh(ctx context.Context, refreshToken string) (*oauthToken, error) {
+	tok, err := o.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refreshToken
+	}
+	return tok, nil
+}
+
+// token posts a grant to the token endpoint.
+func (o *OAuthClient) token(ctx context.Context, form url.Values) (*oauthToken, error) {
+	form.Set("client_id", o.cfg.ClientID)
+	form.Set("client_secret", o.cfg.ClientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &oauthError{StatusCode: resp.StatusCode, Code: body.Error, Description: body.ErrorDescription}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decoding token response: %w", decodeErr)
+	}
+	if body.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	tok := &oauthToken{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+	}
+	if body.ExpiresIn > 0 {
+		tok.Expiry = o.now().Unix() + body.ExpiresIn
+	}
+	return tok, nil
+}
+
+// TokenRenewer keeps the access token in the token store fresh by refreshing
+// it shortly before it expires.
+type TokenRenewer struct {
+	client *OAuthClient
+	path   string
+	now    func() time.Time
+	// sleep waits for d or until ctx is done; replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewTokenRenewer creates a renewer for the token store at path.
+func NewTokenRenewer(client *OAuthClient, path string) *TokenRenewer {
+	return &TokenRenewer{client: client, path: path, now: time.Now, sleep: sleepContext}
+}
+
+// Run renews the token whenever it is due and calls renewed after the store
+// has been updated. It blocks until the context is cancelled.
+func (r *TokenRenewer) Run(ctx context.Context, renewed func()) {
+	backoff := oauthRetryBackoff
+	for {
+		wait, err := r.check(ctx, renewed)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			wait = backoff
+			backoff = min(backoff*2, maxOAuthRetryWait)
+			var oe *oauthError
+			if errors.As(err, &oe) && oe.Permanent() {
+				slog.Error("OAuth token renewal rejected; run \"tempest-exporter oauth login\" again",
+					"error", err, "retry_in", wait)
+			} else {
+				slog.Error("OAuth token renewal failed", "error", err, "retry_in", wait)
+			}
+		} else {
+			backoff = oauthRetryBackoff
+		}
+		if err := r.sleep(ctx, wait); err != nil {
+			return
+		}
+	}
+}
+
+// check renews the stored token if it is due and returns how long to wait
+// before checking again.
+func (r *TokenRenewer) check(ctx context.Context, renewed func()) (time.Duration, error) {
+	tok, err := loadOAuthToken(r.path)
+	if err != nil {
+		return 0, err
+	}
+	if tok.Expiry == 0 {
+		return oauthRecheckInterval, nil
+	}
+	if due := time.Unix(tok.Expiry, 0).Add(-oauthRenewBefore).Sub(r.now()); due > 0 {
+		return min(due, oauthRecheckInterval), nil
+	}
+	if tok.RefreshToken == "" {
+		return 0, errors.New("access token is expiring and there is no refresh token")
+	}
+
+	fresh, err := r.client.Refresh(ctx, tok.RefreshToken)
+	if err != nil {
+		return 0, err
+	}
+	logSecrets.Add(fresh.AccessToken, fresh.RefreshToken)
+	if err := saveOAuthToken(r.path, fresh); err != nil {
+		return 0, err
+	}
+	slog.Info("renewed OAuth access token", "expires", time.Unix(fresh.Expiry, 0).UTC())
+	renewed()
+	return 0, nil
+}
+
+// callbackHandler receives the authorization redirect and sends the code, or
+// an error, to result. Requests with the wrong state are rejected.
+func callbackHandler(state string, result chan<- error, code *string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		var err error
+		switch {
+		case q.Get("error") != "":
+			err = fmt.Errorf("authorization denied: %s %s", q.Get("error"), q.Get("error_description"))
+			http.Error(w, "Authorization failed; see the exporter's output.", http.StatusBadRequest)
+		case q.Get("code") == "":
+			err = errors.New("redirect has no code")
+			http.Error(w, "Missing authorization code.", http.StatusBadRequest)
+		default:
+			*code = q.Get("code")
+			fmt.Fprintln(w, "Authorized. You can close this window.")
+		}
+		select {
+		case result <- err:
+		default:
+		}
+	})
+}
+
+// waitForCode serves redirectURL until the authorization redirect arrives
+// and returns its code.
+func waitForCode(ctx context.Context, redirectURL, state string) (string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", fmt.Errorf("oauth.redirect_url: %w", err)
+	}
+	if u.Scheme != "http" || u.Port() == "" {
+		return "", fmt.Errorf("oauth.redirect_url: must be http:// with a port to receive the redirect, got %q; use -code instead", redirectURL)
+	}
+	ln, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return "", fmt.Errorf("listening for the redirect: %w", err)
+	}
+
+	var code string
+	result := make(chan error, 1)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, callbackHandler(state, result, &code))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer func() { _ = srv.Close() }()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case err := <-result:
+		if err != nil {
+			return "", err
+		}
+		return code, nil
+	}
+}
+
+// runOAuthCommand implements "oauth login", which authorizes the exporter
+// to read a station and stores the resulting tokens at oauth.token_path. It
+// returns the exit code.
+func runOAuthCommand(args []string) int {
+	if len(args) == 0 || args[0] != "login" {
+		fmt.Fprintln(os.Stderr, "Usage: tempest-exporter oauth login [-code CODE] [-config FILE] [flags]")
+		return 2
+	}
+	fs := flag.NewFlagSet("oauth login", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tempest-exporter oauth login [-code CODE] [-config FILE] [flags]\n\n"+
+			"Prints the WeatherFlow authorization URL, waits for the redirect to\n"+
+			"oauth.redirect_url and stores the tokens at oauth.token_path. Without a\n"+
+			"local browser, open the URL elsewhere and pass the code with -code.\n\n")
+		fs.PrintDefaults()
+	}
+	codeFlag := fs.String("code", "", "authorization code to exchange instead of waiting for the redirect")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for the redirect")
+	load := configFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := load()
+	if err == nil {
+		err = cfg.OAuth.validate()
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	client := NewOAuthClient(cfg.OAuth)
+	code := *codeFlag
+	if code == "" {
+		state, err := randomState()
+		if err != nil {
+			slog.Error("generating state", "error", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Open this URL in a browser and authorize access to the station:\n\n  %s\n\n", client.AuthCodeURL(state))
+		fmt.Fprintf(os.Stderr, "Waiting for the redirect to %s ...\n", cfg.OAuth.RedirectURL)
+		if code, err = waitForCode(ctx, cfg.OAuth.RedirectURL, state); err != nil {
+			slog.Error("authorization failed", "error", err)
+			return 1
+		}
+	}
+
+	tok, err := client.Exchange(ctx, code)
+	if err != nil {
+		slog.Error("exchanging authorization code", "error", err)
+		return 1
+	}
+	logSecrets.Add(tok.AccessToken, tok.RefreshToken)
+	if err := saveOAuthToken(cfg.OAuth.TokenPath, tok); err != nil {
+		slog.Error("saving token", "error", err)
+		return 1
+	}
+	fmt.Printf("token saved to %s\n", cfg.OAuth.TokenPath)
+	return 0
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTokenEndpoint serves the OAuth token endpoint. It accepts the code
+// "good-code" and the refresh token "refresh-1".
+func fakeTokenEndpoint(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		if r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		var resp map[string]any
+		switch {
+		case r.PostForm.Get("grant_type") == "authorization_code" && r.PostForm.Get("code") == "good-code":
+			if r.PostForm.Get("redirect_uri") != defaultOAuthRedirectURL {
+				t.Errorf("redirect_uri = %q", r.PostForm.Get("redirect_uri"))
+			}
+			resp = map[string]any{"access_token": "access-1", "token_type": "Bearer", "refresh_token": "refresh-1", "expires_in": 3600}
+		case r.PostForm.Get("grant_type") == "refresh_token" && r.PostForm.Get("refresh_token") == "refresh-1":
+			resp = map[string]any{"access_token": "access-2", "token_type": "Bearer", "expires_in": 3600}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "expired"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testOAuthClient(tokenURL string, now time.Time) *OAuthClient {
+	cfg := defaultConfig().OAuth
+	cfg.ClientID, cfg.ClientSecret, cfg.TokenURL = "client", "secret", tokenURL
+	o := NewOAuthClient(cfg)
+	o.now = func() time.Time { return now }
+	return o
+}
+
+func TestOAuthClient_AuthCodeURL(t *testing.T) {
+	o := testOAuthClient("", time.Now())
+	u, err := url.Parse(o.AuthCodeURL("xyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Host != "tempestwx.com" || q.Get("response_type") != "code" || q.Get("client_id") != "client" ||
+		q.Get("state") != "xyz" || q.Get("redirect_uri") != defaultOAuthRedirectURL {
+		t.Errorf("AuthCodeURL = %s", u)
+	}
+}
+
+func TestOAuthClient_ExchangeAndRefresh(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	o := testOAuthClient(fakeTokenEndpoint(t).URL, now)
+	ctx := context.Background()
+
+	tok, err := o.Exchange(ctx, "good-code")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := oauthToken{AccessToken: "access-1", TokenType: "Bearer", RefreshToken: "refresh-1", Expiry: now.Unix() + 3600}
+	if *tok != want {
+		t.Errorf("Exchange = %+v, want %+v", *tok, want)
+	}
+
+	// The response omits the refresh token, so the old one is kept.
+	tok, err = o.Refresh(ctx, "refresh-1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if tok.AccessToken != "access-2" || tok.RefreshToken != "refresh-1" {
+		t.Errorf("Refresh = %+v", *tok)
+	}
+
+	_, err = o.Refresh(ctx, "revoked")
+	var oe *oauthError
+	if !errors.As(err, &oe) || !oe.Permanent() || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Refresh with revoked token: error = %v, want permanent invalid_grant", err)
+	}
+}
+
+func TestOAuthToken_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oauth.json")
+	want := oauthToken{AccessToken: "a", RefreshToken: "r", Expiry: 42}
+	if err := saveOAuthToken(path, &want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		t.Errorf("token store mode = %v, want owner-only", perm)
+	}
+	got, err := loadOAuthToken(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if *got != want {
+		t.Errorf("loaded %+v, want %+v", *got, want)
+	}
+
+	writeFile(t, path, `{"refresh_token":"r"}`)
+	if _, err := loadOAuthToken(path); err == nil {
+		t.Error("store without access token: expected error")
+	}
+}
+
+func TestTokenRenewer_Check(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	path := filepath.Join(t.TempDir(), "oauth.json")
+	r := NewTokenRenewer(testOAuthClient(fakeTokenEndpoint(t).URL, now), path)
+	r.now = func() time.Time { return now }
+	renewals := 0
+	renewed := func() { renewals++ }
+	ctx := context.Background()
+
+	// Not yet due: wait until oauthRenewBefore ahead of expiry.
+	if err := saveOAuthToken(path, &oauthToken{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: now.Unix() + 1800}); err != nil {
+		t.Fatal(err)
+	}
+	wait, err := r.check(ctx, renewed)
+	if err != nil || wait != 30*time.Minute-oauthRenewBefore || renewals != 0 {
+		t.Errorf("check before due = %v, %v, %d renewals", wait, err, renewals)
+	}
+
+	// Due: the store is replaced and renewed is called.
+	if err := saveOAuthToken(path, &oauthToken{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: now.Unix() + 60}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.check(ctx, renewed); err != nil {
+		t.Fatalf("check when due: %v", err)
+	}
+	tok, err := loadOAuthToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access-2" || tok.RefreshToken != "refresh-1" || tok.Expiry != now.Unix()+3600 || renewals != 1 {
+		t.Errorf("after renewal: %+v, %d renewals", *tok, renewals)
+	}
+
+	// Tokens that don't expire are only rechecked.
+	if err := saveOAuthToken(path, &oauthToken{AccessToken: "forever"}); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := r.check(ctx, renewed); err != nil || wait != oauthRecheckInterval {
+		t.Errorf("check without expiry = %v, %v", wait, err)
+	}
+
+	// A rejected refresh leaves the store alone.
+	if err := saveOAuthToken(path, &oauthToken{AccessToken: "access-1", RefreshToken: "revoked", Expiry: now.Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.check(ctx, renewed); err == nil {
+		t.Error("check with revoked refresh token: expected error")
+	}
+	if tok, _ := loadOAuthToken(path); tok.RefreshToken != "revoked" || renewals != 1 {
+		t.Errorf("store changed after failed renewal: %+v", tok)
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	tests := []struct {
+		name, query string
+		wantStatus  int
+		wantCode    string
+		wantErr     bool
+		wantResult  bool
+	}{
+		{"code", "state=s&code=abc", http.StatusOK, "abc", false, true},
+		{"wrong state", "state=x&code=abc", http.StatusBadRequest, "", false, false},
+		{"denied", "state=s&error=access_denied", http.StatusBadRequest, "", true, true},
+		{"no code", "state=s", http.StatusBadRequest, "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code string
+			result := make(chan error, 1)
+			rec := httptest.NewRecorder()
+			callbackHandler("s", result, &code).ServeHTTP(rec, httptest.NewRequest("GET", "/callback?"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			select {
+			case err := <-result:
+				if !tt.wantResult || (err != nil) != tt.wantErr {
+					t.Errorf("result = %v, want result %v with error %v", err, tt.wantResult, tt.wantErr)
+				}
+			default:
+				if tt.wantResult {
+					t.Error("no result sent")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// openMetricsFamilies lists the Collector gauges that describe the weather
+// itself. Everything else the Collector exports is about the exporter
+// process or its connections and is meaningless in a historical import.
+var openMetricsFamilies = map[string]bool{
+	"tempest_wind_lull_meters_per_second":          true,
+	"tempest_wind_speed_meters_per_second":         true,
+	"tempest_wind_gust_meters_per_second":          true,
+	"tempest_wind_direction_degrees":               true,
+	"tempest_station_pressure_millibars":           true,
+	"tempest_air_temperature_celsius":              true,
+	"tempest_relative_humidity_percent":            true,
+	"tempest_illuminance_lux":                      true,
+	"tempest_uv_index":                             true,
+	"tempest_solar_radiation_watts":                true,
+	"tempest_precipitation_millimeters":            true,
+	"tempest_precipitation_type":                   true,
+	"tempest_lightning_strike_distance_kilometers": true,
+	"tempest_lightning_strike_count":               true,
+	"tempest_battery_volts":                        true,
+	"tempest_dew_point_celsius":                    true,
+	"tempest_feels_like_temperature_celsius":       true,
+}
+
+// openMetricsWriter converts observations into timestamped OpenMetrics
+// samples using the same metric names and labels as Collector. OpenMetrics
+// requires all samples of a family to be contiguous, so each family is
+// spooled to its own temporary file and the files are joined by WriteTo.
+type openMetricsWriter struct {
+	dir       string
+	collector *Collector
+	registry  *prometheus.Registry
+	families  map[string]*omFamily
+	order     []string
+}
+
+type omFamily struct {
+	help string
+	typ  string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// newOpenMetricsWriter creates a writer that spools into a new temporary
+// directory inside dir. Close removes it.
+func newOpenMetricsWriter(dir, stationID, stationName string) (*openMetricsWriter, error) {
+	tmp, err := os.MkdirTemp(dir, ".tempest-openmetrics-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+	c := NewCollector(stationID, stationName)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	return &openMetricsWriter{
+		dir:       tmp,
+		collector: c,
+		registry:  reg,
+		families:  make(map[string]*omFamily),
+	}, nil
+}
+
+// WriteObservation appends one sample per metric for obs, timestamped with
+// the observation time.
+func (w *openMetricsWriter) WriteObservation(obs Observation) error {
+	w.collector.Restore(CollectorState{Observation: obs, HasObs: true})
+	mfs, err := w.registry.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics: %w", err)
+	}
+
+	ts := strconv.FormatInt(obs.Timestamp, 10)
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if !openMetricsFamilies[name] || mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			fam, err := w.family(name, mf)
+			if err != nil {
+				return err
+			}
+			_, _ = fam.buf.WriteString(name)
+			writeOpenMetricsLabels(fam.buf, m.GetLabel())
+			_, _ = fam.buf.WriteString(" " + strconv.FormatFloat(m.GetGauge().GetValue(), 'g', -1, 64) + " " + ts + "\n")
+		}
+	}
+	return nil
+}
+
+func (w *openMetricsWriter) family(name string, mf *dto.MetricFamily) (*omFamily, error) {
+	if fam, ok := w.families[name]; ok {
+		return fam, nil
+	}
+	f, err := os.CreateTemp(w.dir, "family-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating spool file: %w", err)
+	}
+	fam := &omFamily{
+		help: mf.GetHelp(),
+		typ:  strings.ToLower(mf.GetType().String()),
+		file: f,
+		buf:  bufio.NewWriter(f),
+	}
+	w.families[name] = fam
+	w.order = append(w.order, name)
+	return fam, nil
+}
+
+// WriteTo writes the complete OpenMetrics exposition, terminated by # EOF.
+func (w *openMetricsWriter) WriteTo(out io.Writer) (int64, error) {
+	bw := bufio.NewWriter(out)
+	cw := &countingWriter{w: bw}
+	for _, name := range w.order {
+		fam := w.families[name]
+		if err := fam.buf.Flush(); err != nil {
+			return cw.n, fmt.Errorf("flushing spool file: %w", err)
+		}
+		if _, err := fam.file.Seek(0, io.SeekStart); err != nil {
+			return cw.n, fmt.Errorf("rewinding spool file: %w", err)
+		}
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", name, escapeOpenMetrics(fam.help), name, fam.typ)
+		if _, err := io.Copy(cw, fam.file); err != nil {
+			return cw.n, fmt.Errorf("copying spool file: %w", err)
+		}
+	}
+	_, _ = io.WriteString(cw, "# EOF\n")
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// Close removes the spool files.
+func (w *openMetricsWriter) Close() error {
+	for _, fam := range w.families {
+		_ = fam.file.Close()
+	}
+	return os.RemoveAll(w.dir)
+}
+
+func writeOpenMetricsLabels(w *bufio.Writer, labels []*dto.LabelPair) {
+	if len(labels) == 0 {
+		return
+	}
+	_ = w.WriteByte('{')
+	for i, lp := range labels {
+		if i > 0 {
+			_ = w.WriteByte(',')
+		}
+		_, _ = w.WriteString(lp.GetName() + `="` + escapeOpenMetrics(lp.GetValue()) + `"`)
+	}
+	_ = w.WriteByte('}')
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// escapeOpenMetrics escapes a label value or HELP text.
+func escapeOpenMetrics(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
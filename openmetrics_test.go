@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestOpenMetricsWriter(t *testing.T) {
+	w, err := newOpenMetricsWriter(t.TempDir(), "12345", "backyard")
+	if err != nil {
+		t.Fatalf("newOpenMetricsWriter: %v", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	first := testObservation()
+	second := testObservation()
+	second.Timestamp += 60
+	second.AirTemperature = 23
+	second.UV = math.NaN()
+	for _, obs := range []Observation{first, second} {
+		if err := w.WriteObservation(obs); err != nil {
+			t.Fatalf("WriteObservation: %v", err)
+		}
+	}
+
+	var sb strings.Builder
+	if _, err := w.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	out := sb.String()
+
+	want := `# HELP tempest_air_temperature_celsius Air temperature in Celsius
+# TYPE tempest_air_temperature_celsius gauge
+tempest_air_temperature_celsius{station_id="12345",station_name="backyard"} 22.5 1700000000
+tempest_air_temperature_celsius{station_id="12345",station_name="backyard"} 23 1700000060
+`
+	if !strings.Contains(out, want) {
+		t.Errorf("air temperature family not contiguous:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Error("output must end with # EOF")
+	}
+	if strings.Count(out, "# TYPE tempest_uv_index ") != 1 || strings.Count(out, "tempest_uv_index{") != 1 {
+		t.Error("NaN UV should be skipped, with the family written once")
+	}
+
+	families := parseOpenMetrics(t, out)
+	for name := range families {
+		if !openMetricsFamilies[name] {
+			t.Errorf("family %s should not be exported", name)
+		}
+	}
+	for name := range openMetricsFamilies {
+		if families[name] == 0 {
+			t.Errorf("family %s missing or without samples", name)
+		}
+	}
+}
+
+// parseOpenMetrics checks that out is a well-formed OpenMetrics exposition
+// of gauge families with timestamped samples, and returns the number of
+// samples in each family.
+func parseOpenMetrics(t *testing.T, out string) map[string]int {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if lines[len(lines)-1] != "# EOF" {
+		t.Fatalf("last line = %q, want # EOF", lines[len(lines)-1])
+	}
+	families := make(map[string]int)
+	var current, typ string
+	for i, line := range lines[:len(lines)-1] {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "# HELP "), " ")
+			if _, seen := families[name]; seen {
+				t.Fatalf("line %d: family %s is not contiguous", i+1, name)
+			}
+			families[name] = 0
+			current, typ = name, ""
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(fields) != 2 || fields[0] != current {
+				t.Fatalf("line %d: TYPE %q does not follow HELP for %s", i+1, line, current)
+			}
+			typ = fields[1]
+			if typ == "counter" && strings.HasSuffix(current, "_total") {
+				t.Fatalf("line %d: counter family %s must not end in _total", i+1, current)
+			}
+		case strings.HasPrefix(line, "#"):
+			t.Fatalf("line %d: unexpected comment %q", i+1, line)
+		default:
+			if typ != "gauge" {
+				t.Fatalf("line %d: sample in %s family %s", i+1, typ, current)
+			}
+			name, rest, _ := strings.Cut(line, "{")
+			if name != current {
+				t.Fatalf("line %d: sample %s outside its family %s", i+1, name, current)
+			}
+			_, rest, ok := strings.Cut(rest, "} ")
+			fields := strings.Fields(rest)
+			if !ok || len(fields) != 2 {
+				t.Fatalf("line %d: want labels, value and timestamp: %q", i+1, line)
+			}
+			if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+				t.Fatalf("line %d: bad value: %v", i+1, err)
+			}
+			if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+				t.Fatalf("line %d: bad timestamp: %v", i+1, err)
+			}
+			families[current]++
+		}
+	}
+	return families
+}
+
+func TestEscapeOpenMetrics(t *testing.T) {
+	if got := escapeOpenMetrics("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeOpenMetrics = %q", got)
+	}
+}
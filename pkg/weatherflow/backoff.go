@@ -0,0 +1,44 @@
+package weatherflow
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes reconnect delays with full jitter: the nth delay is
+// uniformly random below min(max, min×2ⁿ), so clients that lost the server
+// at the same time don't come back in lockstep. It is not safe for
+// concurrent use.
+type Backoff struct {
+	min, max time.Duration
+	attempt  int
+	// Rand returns a number in [0, n). NewBackoff sets it to
+	// math/rand/v2's Int64N; replace it for deterministic delays.
+	Rand func(n int64) int64
+}
+
+// NewBackoff returns a backoff whose delays start below min and never
+// reach max.
+func NewBackoff(min, max time.Duration) *Backoff {
+	return &Backoff{min: min, max: max, Rand: rand.Int64N}
+}
+
+// Next returns the next delay and raises the ceiling for the one after.
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.max
+	if b.attempt < 62 {
+		if d := b.min << b.attempt; d > 0 && d < b.max {
+			ceiling = d
+		}
+	}
+	b.attempt++
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(b.Rand(int64(ceiling)))
+}
+
+// Reset starts the delays over from min.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,61 @@
+package weatherflow_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func TestBackoff_CeilingDoublesUpToMax(t *testing.T) {
+	b := weatherflow.NewBackoff(time.Second, 10*time.Second)
+	var ceilings []time.Duration
+	b.Rand = func(n int64) int64 {
+		ceilings = append(ceilings, time.Duration(n))
+		return n - 1
+	}
+	for range 6 {
+		b.Next()
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if ceilings[i] != w {
+			t.Errorf("attempt %d: ceiling = %s, want %s", i, ceilings[i], w)
+		}
+	}
+
+	b.Reset()
+	b.Next()
+	if got := ceilings[len(ceilings)-1]; got != time.Second {
+		t.Errorf("after Reset: ceiling = %s, want 1s", got)
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	b := weatherflow.NewBackoff(time.Second, time.Minute)
+	for range 100 {
+		b.Reset()
+		for range 10 {
+			if d := b.Next(); d < 0 || d >= time.Minute {
+				t.Fatalf("Next() = %s, want within [0, 1m)", d)
+			}
+		}
+	}
+}
+
+func TestBackoff_ManyAttemptsDoNotOverflow(t *testing.T) {
+	b := weatherflow.NewBackoff(time.Second, time.Minute)
+	for range 100 {
+		b.Next()
+	}
+	if d := b.Next(); d < 0 || d >= time.Minute {
+		t.Errorf("Next() = %s, want within [0, 1m)", d)
+	}
+}
+
+func TestBackoff_MinAboveMax(t *testing.T) {
+	b := weatherflow.NewBackoff(time.Minute, time.Second)
+	if d := b.Next(); d >= time.Second {
+		t.Errorf("Next() = %s, want below max 1s", d)
+	}
+}
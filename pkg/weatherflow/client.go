@@ -0,0 +1,211 @@
+// Package weatherflow is a client for the WeatherFlow Tempest REST and
+// WebSocket APIs (https://weatherflow.github.io/Tempest/api/).
+//
+// A Client covers stations, station and device observations including
+// paged history, the better_forecast endpoint and station statistics. Every
+// method takes a context. Requests authenticate with a personal access token
+// or OAuth access token sent as a bearer header, so the token never appears
+// in URLs or errors. A Limiter can pace requests to share the account's rate
+// limit between clients.
+//
+// A Stream follows a device's live messages and delivers them as typed
+// events (Observation, RapidWind, Strike, PrecipStart and DeviceStatus) to
+// callbacks and channels. ParseMessage decodes a single message, for
+// programs that manage their own connection or read the local UDP broadcast.
+//
+// The weatherflowtest package provides local fakes of both APIs for tests.
+package weatherflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the WeatherFlow REST API.
+const DefaultBaseURL = "https://swd.weatherflow.com/swd/rest"
+
+const (
+	// maxResponseBytes bounds a response body; a day of 1-minute device
+	// history is roughly 150 KB.
+	maxResponseBytes = 8 << 20
+	// maxErrorBodyBytes is how much of an error response is kept.
+	maxErrorBodyBytes = 512
+)
+
+// A Limiter paces requests, for example to share an account's rate limit
+// between several clients. Wait is called before every request and may
+// block; an error aborts the request. Done is called after every response
+// with its status code and the Retry-After it carried, or zero.
+type Limiter interface {
+	Wait(ctx context.Context) error
+	Done(statusCode int, retryAfter time.Duration)
+}
+
+// Client calls the WeatherFlow REST API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	limiter    Limiter
+
+	mu    sync.RWMutex
+	token string
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL sends requests to baseURL instead of DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) { c.baseURL = strings.TrimSuffix(baseURL, "/") }
+}
+
+// WithHTTPClient sends requests with hc instead of a client with a 30 second
+// timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithLimiter paces every request with l.
+func WithLimiter(l Limiter) Option {
+	return func(c *Client) { c.limiter = l }
+}
+
+// NewClient returns a client that authenticates with token.
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    DefaultBaseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		token:      token,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetToken changes the token used by subsequent requests, e.g. after an
+// OAuth refresh.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// StatusError is returned for a response with an HTTP status other than 200.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the server's Retry-After, or zero if it gave none.
+	RetryAfter time.Duration
+	// Body is the start of the response body.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed if retried later.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// APIError is returned when a 200 response reports a failure in its status
+// object, as WeatherFlow does for some unknown stations and devices.
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("weatherflow: status %d: %s", e.Code, e.Message)
+}
+
+// status is the status object included in every response.
+type status struct {
+	Status *struct {
+		Code    int    `json:"status_code"`
+		Message string `json:"status_message"`
+	} `json:"status"`
+}
+
+func (s status) err() error {
+	if s.Status == nil || s.Status.Code == 0 {
+		return nil
+	}
+	return &APIError{Code: s.Status.Code, Message: s.Status.Message}
+}
+
+// get sends an authenticated GET request for path with query and decodes the
+// JSON response into v. Non-200 responses are returned as *StatusError.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v any) error {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	c.mu.RLock()
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	c.mu.RUnlock()
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if c.limiter != nil {
+			c.limiter.Done(0, 0)
+		}
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if c.limiter != nil {
+		c.limiter.Done(resp.StatusCode, retryAfter)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return &StatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter, Body: string(body)}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	var st status
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	if err := st.err(); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds. HTTP dates
+// are not used by WeatherFlow and are treated as absent.
+func parseRetryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,149 @@
+package weatherflow_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow/weatherflowtest"
+)
+
+const testToken = "test-token"
+
+// newTestClient starts a fake API with one station and returns a client for it.
+func newTestClient(t *testing.T, opts ...weatherflow.Option) (*weatherflow.Client, *weatherflowtest.Server) {
+	t.Helper()
+	srv := weatherflowtest.NewServer(testToken)
+	t.Cleanup(srv.Close)
+	srv.AddStation(weatherflow.Station{
+		StationID:   12345,
+		Name:        "backyard",
+		Latitude:    40.0,
+		Longitude:   -111.0,
+		Timezone:    "America/Denver",
+		StationMeta: weatherflow.StationMeta{Elevation: 1400},
+		Devices: []weatherflow.Device{
+			{DeviceID: 100, DeviceType: "HB", SerialNumber: "HB-00000001"},
+			{DeviceID: 54321, DeviceType: "ST", SerialNumber: "ST-00000001"},
+		},
+	})
+	opts = append([]weatherflow.Option{weatherflow.WithBaseURL(srv.URL + "/")}, opts...)
+	return weatherflow.NewClient(testToken, opts...), srv
+}
+
+func TestClient_StatusError(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.FailNext(1, http.StatusTooManyRequests, 30*time.Second)
+
+	_, err := c.Stations(context.Background())
+	var se *weatherflow.StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("error = %v, want *StatusError", err)
+	}
+	if se.StatusCode != http.StatusTooManyRequests || se.RetryAfter != 30*time.Second || !se.Temporary() {
+		t.Errorf("StatusError = %+v, want temporary 429 with 30s Retry-After", se)
+	}
+
+	// The failure was used up.
+	if _, err := c.Stations(context.Background()); err != nil {
+		t.Fatalf("Stations() after failure: %v", err)
+	}
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	c, _ := newTestClient(t)
+	c.SetToken("supersecrettoken")
+
+	_, err := c.Stations(context.Background())
+	var se *weatherflow.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized || se.Temporary() {
+		t.Fatalf("error = %v, want permanent 401 StatusError", err)
+	}
+	if strings.Contains(err.Error(), "supersecrettoken") {
+		t.Errorf("token leaked in error: %v", err)
+	}
+}
+
+func TestClient_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":{"status_code":404,"status_message":"NOT FOUND"}}`))
+	}))
+	defer srv.Close()
+
+	c := weatherflow.NewClient(testToken, weatherflow.WithBaseURL(srv.URL))
+	_, err := c.Station(context.Background(), 1)
+	var ae *weatherflow.APIError
+	if !errors.As(err, &ae) || ae.Code != 404 || ae.Message != "NOT FOUND" {
+		t.Fatalf("error = %v, want APIError 404", err)
+	}
+}
+
+func TestClient_ContextCanceled(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Stations(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+}
+
+// recordingLimiter records the statuses its client reports.
+type recordingLimiter struct {
+	mu       sync.Mutex
+	waits    int
+	statuses []int
+	retry    []time.Duration
+	err      error
+}
+
+func (l *recordingLimiter) Wait(context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits++
+	return l.err
+}
+
+func (l *recordingLimiter) Done(statusCode int, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statuses = append(l.statuses, statusCode)
+	l.retry = append(l.retry, retryAfter)
+}
+
+func TestClient_Limiter(t *testing.T) {
+	lim := &recordingLimiter{}
+	c, srv := newTestClient(t, weatherflow.WithLimiter(lim))
+	srv.FailNext(1, http.StatusTooManyRequests, 7*time.Second)
+
+	_, _ = c.Stations(context.Background())
+	_, _ = c.Stations(context.Background())
+
+	if lim.waits != 2 {
+		t.Errorf("waits = %d, want 2", lim.waits)
+	}
+	if len(lim.statuses) != 2 || lim.statuses[0] != 429 || lim.statuses[1] != 200 {
+		t.Errorf("statuses = %v, want [429 200]", lim.statuses)
+	}
+	if lim.retry[0] != 7*time.Second {
+		t.Errorf("retryAfter = %v, want 7s", lim.retry[0])
+	}
+}
+
+func TestClient_LimiterErrorSkipsRequest(t *testing.T) {
+	errBudget := errors.New("out of budget")
+	c, srv := newTestClient(t, weatherflow.WithLimiter(&recordingLimiter{err: errBudget}))
+
+	if _, err := c.Stations(context.Background()); !errors.Is(err, errBudget) {
+		t.Fatalf("error = %v, want the limiter's error", err)
+	}
+	if got := srv.Requests(); len(got) != 0 {
+		t.Errorf("requests = %v, want none", got)
+	}
+}
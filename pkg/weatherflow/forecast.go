@@ -0,0 +1,119 @@
+package weatherflow
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// metricUnits asks better_forecast for the units Observation uses.
+var metricUnits = url.Values{
+	"units_temp":     {"c"},
+	"units_wind":     {"mps"},
+	"units_pressure": {"mb"},
+	"units_precip":   {"mm"},
+	"units_distance": {"km"},
+}
+
+// Forecast is a station's better_forecast: current conditions from the
+// station's own sensors plus WeatherFlow's daily and hourly forecast, in
+// metric units.
+type Forecast struct {
+	Latitude          float64           `json:"latitude"`
+	Longitude         float64           `json:"longitude"`
+	Timezone          string            `json:"timezone"`
+	TimezoneOffset    int               `json:"timezone_offset_minutes"`
+	CurrentConditions CurrentConditions `json:"current_conditions"`
+	Forecast          ForecastPeriods   `json:"forecast"`
+	Units             Units             `json:"units"`
+}
+
+// ForecastPeriods are the daily and hourly forecasts, soonest first.
+type ForecastPeriods struct {
+	Daily  []DailyForecast  `json:"daily"`
+	Hourly []HourlyForecast `json:"hourly"`
+}
+
+// CurrentConditions are the latest values better_forecast reports for a
+// station.
+type CurrentConditions struct {
+	Time                       int64   `json:"time"` // Unix seconds
+	Conditions                 string  `json:"conditions"`
+	Icon                       string  `json:"icon"`
+	AirTemperature             float64 `json:"air_temperature"`
+	FeelsLike                  float64 `json:"feels_like"`
+	DewPoint                   float64 `json:"dew_point"`
+	RelativeHumidity           float64 `json:"relative_humidity"`
+	StationPressure            float64 `json:"station_pressure"`
+	SeaLevelPressure           float64 `json:"sea_level_pressure"`
+	PressureTrend              string  `json:"pressure_trend"`
+	WindAvg                    float64 `json:"wind_avg"`
+	WindGust                   float64 `json:"wind_gust"`
+	WindDirection              float64 `json:"wind_direction"`
+	WindDirectionCardinal      string  `json:"wind_direction_cardinal"`
+	SolarRadiation             float64 `json:"solar_radiation"`
+	UV                         float64 `json:"uv"`
+	Brightness                 float64 `json:"brightness"`
+	PrecipAccumLocalDay        float64 `json:"precip_accum_local_day"`
+	PrecipAccumLocalYesterday  float64 `json:"precip_accum_local_yesterday"`
+	PrecipProbability          float64 `json:"precip_probability"`
+	LightningStrikeCountLast1h float64 `json:"lightning_strike_count_last_1hr"`
+	LightningStrikeCountLast3h float64 `json:"lightning_strike_count_last_3hr"`
+}
+
+// DailyForecast is the forecast for one local day.
+type DailyForecast struct {
+	DayStartLocal     int64   `json:"day_start_local"` // Unix seconds
+	DayNum            int     `json:"day_num"`
+	MonthNum          int     `json:"month_num"`
+	Conditions        string  `json:"conditions"`
+	Icon              string  `json:"icon"`
+	SunriseTime       int64   `json:"sunrise"`
+	SunsetTime        int64   `json:"sunset"`
+	AirTempHigh       float64 `json:"air_temp_high"`
+	AirTempLow        float64 `json:"air_temp_low"`
+	PrecipProbability float64 `json:"precip_probability"`
+	PrecipIcon        string  `json:"precip_icon"`
+	PrecipType        string  `json:"precip_type"`
+}
+
+// HourlyForecast is the forecast for one hour.
+type HourlyForecast struct {
+	Time                  int64   `json:"time"` // Unix seconds
+	Conditions            string  `json:"conditions"`
+	Icon                  string  `json:"icon"`
+	AirTemperature        float64 `json:"air_temperature"`
+	FeelsLike             float64 `json:"feels_like"`
+	RelativeHumidity      float64 `json:"relative_humidity"`
+	SeaLevelPressure      float64 `json:"sea_level_pressure"`
+	Precip                float64 `json:"precip"`
+	PrecipProbability     float64 `json:"precip_probability"`
+	PrecipType            string  `json:"precip_type"`
+	WindAvg               float64 `json:"wind_avg"`
+	WindGust              float64 `json:"wind_gust"`
+	WindDirection         float64 `json:"wind_direction"`
+	WindDirectionCardinal string  `json:"wind_direction_cardinal"`
+	UV                    float64 `json:"uv"`
+}
+
+// Units are the units a Forecast is given in.
+type Units struct {
+	Temp     string `json:"units_temp"`
+	Wind     string `json:"units_wind"`
+	Pressure string `json:"units_pressure"`
+	Precip   string `json:"units_precip"`
+	Distance string `json:"units_distance"`
+}
+
+// BetterForecast returns a station's forecast in metric units.
+func (c *Client) BetterForecast(ctx context.Context, stationID int) (*Forecast, error) {
+	query := url.Values{"station_id": {strconv.Itoa(stationID)}}
+	for k, v := range metricUnits {
+		query[k] = v
+	}
+	var resp Forecast
+	if err := c.get(ctx, "/better_forecast", query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
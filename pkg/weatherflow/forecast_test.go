@@ -0,0 +1,40 @@
+package weatherflow_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func TestClient_BetterForecast(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.SetForecast(12345, weatherflow.Forecast{
+		Timezone:          "America/Denver",
+		CurrentConditions: weatherflow.CurrentConditions{AirTemperature: 12.5, Conditions: "Clear"},
+		Forecast: weatherflow.ForecastPeriods{
+			Daily:  []weatherflow.DailyForecast{{DayNum: 1, AirTempHigh: 20, AirTempLow: 5}},
+			Hourly: []weatherflow.HourlyForecast{{Time: 1700000000, PrecipProbability: 30}},
+		},
+		Units: weatherflow.Units{Temp: "c"},
+	})
+
+	f, err := c.BetterForecast(context.Background(), 12345)
+	if err != nil {
+		t.Fatalf("BetterForecast() error: %v", err)
+	}
+	if f.CurrentConditions.AirTemperature != 12.5 || f.Forecast.Daily[0].AirTempHigh != 20 ||
+		f.Forecast.Hourly[0].PrecipProbability != 30 || f.Units.Temp != "c" {
+		t.Errorf("BetterForecast() = %+v", f)
+	}
+
+	req := srv.Requests()[0]
+	path, rawQuery, _ := strings.Cut(req, "?")
+	q, _ := url.ParseQuery(rawQuery)
+	if path != "/better_forecast" || q.Get("station_id") != "12345" ||
+		q.Get("units_temp") != "c" || q.Get("units_wind") != "mps" || q.Get("units_pressure") != "mb" {
+		t.Errorf("request = %s, want station 12345 in metric units", req)
+	}
+}
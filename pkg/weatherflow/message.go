@@ -0,0 +1,257 @@
+package weatherflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// An Event is a typed update decoded from a device message: an Observation,
+// RapidWind, Strike, PrecipStart or DeviceStatus.
+type Event interface {
+	// Time is when the device recorded the event.
+	Time() time.Time
+}
+
+// Time returns the observation's timestamp.
+func (o Observation) Time() time.Time { return time.Unix(o.Timestamp, 0) }
+
+// RapidWind is a 3-second wind sample from a rapid_wind message.
+type RapidWind struct {
+	Timestamp int64   `json:"timestamp"`
+	Speed     float64 `json:"wind_speed"`     // m/s
+	Direction float64 `json:"wind_direction"` // degrees
+}
+
+// Time returns the sample's timestamp.
+func (r RapidWind) Time() time.Time { return time.Unix(r.Timestamp, 0) }
+
+// Strike is a lightning strike from an evt_strike message.
+type Strike struct {
+	Timestamp int64   `json:"timestamp"`
+	Distance  float64 `json:"distance"` // km
+	Energy    float64 `json:"energy"`
+}
+
+// Time returns the strike's timestamp.
+func (s Strike) Time() time.Time { return time.Unix(s.Timestamp, 0) }
+
+// PrecipStart is a rain start event from an evt_precip message.
+type PrecipStart struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Time returns when rain started.
+func (p PrecipStart) Time() time.Time { return time.Unix(p.Timestamp, 0) }
+
+// DeviceStatus reports a device coming online or going offline
+// (evt_device_online, evt_device_offline), or its health from a
+// device_status message. Only device_status sets the health fields.
+type DeviceStatus struct {
+	Timestamp        int64   `json:"timestamp"`
+	Online           bool    `json:"online"`
+	Uptime           float64 `json:"uptime,omitempty"`  // seconds
+	Voltage          float64 `json:"voltage,omitempty"` // volts
+	FirmwareRevision int     `json:"firmware_revision,omitempty"`
+	RSSI             float64 `json:"rssi,omitempty"`     // dBm
+	HubRSSI          float64 `json:"hub_rssi,omitempty"` // dBm
+	SensorStatus     int64   `json:"sensor_status,omitempty"`
+}
+
+// Time returns the status timestamp.
+func (d DeviceStatus) Time() time.Time { return time.Unix(d.Timestamp, 0) }
+
+// Message is a decoded stream message.
+type Message struct {
+	// Type is the message's type field, e.g. "obs_st" or "ack".
+	Type string
+	// ID is the id of an ack, which echoes the request it acknowledges.
+	ID string
+	// Event is nil for control messages, unknown types and events without
+	// usable data, such as a strike with no distance.
+	Event Event
+}
+
+// Parse failure stages: the envelope wasn't JSON with a type, the message
+// didn't decode into its type, or it decoded but its fields were missing or
+// invalid.
+const (
+	StageEnvelope = "envelope"
+	StageMessage  = "message"
+	StageFields   = "fields"
+)
+
+// ParseError is returned by ParseMessage for a message that could not be
+// decoded.
+type ParseError struct {
+	Stage string
+	// Type is the message type, or "" if the envelope was invalid.
+	Type string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("parsing message: %v", e.Err)
+	}
+	return fmt.Sprintf("parsing %s: %v", e.Type, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ParseMessage decodes a WebSocket or UDP message. Errors are *ParseError;
+// unless the envelope was invalid, the returned Message carries the type.
+func ParseMessage(data []byte) (Message, error) {
+	var envelope struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Message{}, &ParseError{Stage: StageEnvelope, Err: err}
+	}
+	msg := Message{Type: envelope.Type, ID: envelope.ID}
+
+	var (
+		ev  Event
+		err error
+	)
+	switch envelope.Type {
+	case "obs_st":
+		ev, err = parseObsST(data)
+	case "evt_strike":
+		ev, err = parseStrike(data)
+	case "evt_precip":
+		ev, err = parsePrecip(data)
+	case "rapid_wind":
+		ev, err = parseRapidWind(data)
+	case "evt_device_online", "evt_device_offline":
+		ev, err = parseDeviceOnline(data, envelope.Type == "evt_device_online")
+	case "device_status":
+		ev, err = parseDeviceStatus(data)
+	}
+	if err != nil {
+		var pe *ParseError
+		if errors.As(err, &pe) {
+			pe.Type = envelope.Type
+		}
+		return msg, err
+	}
+	msg.Event = ev
+	return msg, nil
+}
+
+// messageError and fieldsError build the errors of the parse functions;
+// ParseMessage fills in the type.
+func messageError(err error) error { return &ParseError{Stage: StageMessage, Err: err} }
+
+func fieldsError(format string, args ...any) error {
+	return &ParseError{Stage: StageFields, Err: fmt.Errorf(format, args...)}
+}
+
+func parseObsST(data []byte) (Event, error) {
+	var msg struct {
+		Obs [][]any `json:"obs"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, messageError(err)
+	}
+	if len(msg.Obs) == 0 {
+		return nil, fieldsError("empty obs array")
+	}
+	obs, err := ParseObservation(msg.Obs[0])
+	if err != nil {
+		return nil, fieldsError("%w", err)
+	}
+	return obs, nil
+}
+
+// evt decodes the evt array of an event message, requiring at least n
+// elements.
+func evt(data []byte, n int) ([]any, error) {
+	var msg struct {
+		Evt []any `json:"evt"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, messageError(err)
+	}
+	if len(msg.Evt) < n {
+		if len(msg.Evt) == 0 {
+			return nil, fieldsError("empty evt array")
+		}
+		return nil, fieldsError("evt has %d fields, want %d", len(msg.Evt), n)
+	}
+	return msg.Evt, nil
+}
+
+func parseStrike(data []byte) (Event, error) {
+	e, err := evt(data, 3)
+	if err != nil {
+		return nil, err
+	}
+	dist := Float(e[1])
+	if math.IsNaN(dist) {
+		return nil, nil
+	}
+	ts, _ := Int64(e[0])
+	return Strike{Timestamp: ts, Distance: dist, Energy: Float(e[2])}, nil
+}
+
+func parsePrecip(data []byte) (Event, error) {
+	e, err := evt(data, 1)
+	if err != nil {
+		return nil, err
+	}
+	epoch := Float(e[0])
+	if math.IsNaN(epoch) {
+		return nil, nil
+	}
+	return PrecipStart{Timestamp: int64(epoch)}, nil
+}
+
+func parseRapidWind(data []byte) (Event, error) {
+	var msg struct {
+		Ob []any `json:"ob"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, messageError(err)
+	}
+	if len(msg.Ob) < 3 {
+		return nil, fieldsError("ob has %d fields, want 3", len(msg.Ob))
+	}
+	ts, err := Int64(msg.Ob[0])
+	if err != nil {
+		return nil, fieldsError("timestamp: %w", err)
+	}
+	return RapidWind{Timestamp: ts, Speed: Float(msg.Ob[1]), Direction: Float(msg.Ob[2])}, nil
+}
+
+func parseDeviceOnline(data []byte, online bool) (Event, error) {
+	e, err := evt(data, 1)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := Int64(e[0])
+	if err != nil {
+		return nil, fieldsError("timestamp: %w", err)
+	}
+	return DeviceStatus{Timestamp: ts, Online: online}, nil
+}
+
+func parseDeviceStatus(data []byte) (Event, error) {
+	var msg struct {
+		Timestamp *int64 `json:"timestamp"`
+		DeviceStatus
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, messageError(err)
+	}
+	if msg.Timestamp == nil {
+		return nil, fieldsError("missing timestamp")
+	}
+	status := msg.DeviceStatus
+	status.Timestamp = *msg.Timestamp
+	status.Online = true
+	return status, nil
+}
@@ -0,0 +1,90 @@
+package weatherflow_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want weatherflow.Event
+	}{
+		{"rapid wind", `{"type":"rapid_wind","ob":[1700000000,2.5,270]}`,
+			weatherflow.RapidWind{Timestamp: 1700000000, Speed: 2.5, Direction: 270}},
+		{"strike", `{"type":"evt_strike","evt":[1700000000,12,3000]}`,
+			weatherflow.Strike{Timestamp: 1700000000, Distance: 12, Energy: 3000}},
+		{"strike without distance", `{"type":"evt_strike","evt":[1700000000,null,3000]}`, nil},
+		{"rain start", `{"type":"evt_precip","evt":[1700000000]}`,
+			weatherflow.PrecipStart{Timestamp: 1700000000}},
+		{"device online", `{"type":"evt_device_online","device_id":1,"evt":[1700000000]}`,
+			weatherflow.DeviceStatus{Timestamp: 1700000000, Online: true}},
+		{"device offline", `{"type":"evt_device_offline","device_id":1,"evt":[1700000000]}`,
+			weatherflow.DeviceStatus{Timestamp: 1700000000}},
+		{"device status", `{"type":"device_status","timestamp":1700000000,"uptime":2189,"voltage":2.65,"firmware_revision":171,"rssi":-17,"hub_rssi":-87,"sensor_status":4}`,
+			weatherflow.DeviceStatus{Timestamp: 1700000000, Online: true, Uptime: 2189, Voltage: 2.65,
+				FirmwareRevision: 171, RSSI: -17, HubRSSI: -87, SensorStatus: 4}},
+		{"ack", `{"type":"ack","id":"x"}`, nil},
+		{"unknown", `{"type":"hub_status"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := weatherflow.ParseMessage([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseMessage() error: %v", err)
+			}
+			if msg.Event != tt.want {
+				t.Errorf("Event = %#v, want %#v", msg.Event, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessage_Observation(t *testing.T) {
+	msg, err := weatherflow.ParseMessage([]byte(`{"type":"obs_st","device_id":1,"obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,null,300,0.1,1,10,2,2.65,1]]}`))
+	if err != nil {
+		t.Fatalf("ParseMessage() error: %v", err)
+	}
+	obs, ok := msg.Event.(weatherflow.Observation)
+	if !ok {
+		t.Fatalf("Event = %T, want Observation", msg.Event)
+	}
+	if obs.AirTemperature != 22.5 || !math.IsNaN(obs.UV) || !obs.Time().Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("observation = %+v", obs)
+	}
+}
+
+func TestParseMessage_Errors(t *testing.T) {
+	tests := []struct {
+		data      string
+		stage     string
+		errorType string
+	}{
+		{`not json`, weatherflow.StageEnvelope, ""},
+		{`{"type":"obs_st","obs":{}}`, weatherflow.StageMessage, "obs_st"},
+		{`{"type":"obs_st","obs":[]}`, weatherflow.StageFields, "obs_st"},
+		{`{"type":"obs_st","obs":[[1700000000,0.5]]}`, weatherflow.StageFields, "obs_st"},
+		{`{"type":"evt_strike","evt":[1700000000]}`, weatherflow.StageFields, "evt_strike"},
+		{`{"type":"evt_precip","evt":[]}`, weatherflow.StageFields, "evt_precip"},
+		{`{"type":"rapid_wind","ob":[null,1,2]}`, weatherflow.StageFields, "rapid_wind"},
+		{`{"type":"evt_device_online","evt":["x"]}`, weatherflow.StageFields, "evt_device_online"},
+		{`{"type":"device_status"}`, weatherflow.StageFields, "device_status"},
+	}
+	for _, tt := range tests {
+		msg, err := weatherflow.ParseMessage([]byte(tt.data))
+		var pe *weatherflow.ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("ParseMessage(%s) error = %v, want *ParseError", tt.data, err)
+			continue
+		}
+		if pe.Stage != tt.stage || pe.Type != tt.errorType || msg.Type != tt.errorType {
+			t.Errorf("ParseMessage(%s) = stage %q type %q (message type %q), want %q %q",
+				tt.data, pe.Stage, pe.Type, msg.Type, tt.stage, tt.errorType)
+		}
+	}
+}
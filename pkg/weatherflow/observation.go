@@ -0,0 +1,109 @@
+package weatherflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Observation is a Tempest obs_st observation in metric units. Fields that
+// were null in the source data are math.NaN.
+type Observation struct {
+	Timestamp              int64   // Unix seconds
+	WindLull               float64 // m/s
+	WindAvg                float64 // m/s
+	WindGust               float64 // m/s
+	WindDirection          float64 // degrees
+	WindSampleInterval     float64 // seconds
+	StationPressure        float64 // mb
+	AirTemperature         float64 // °C
+	RelativeHumidity       float64 // %
+	Illuminance            float64 // lux
+	UV                     float64 // index
+	SolarRadiation         float64 // W/m²
+	RainAccumulated        float64 // mm over the report interval
+	PrecipitationType      float64 // 0 none, 1 rain, 2 hail, 3 rain and hail
+	LightningStrikeAvgDist float64 // km
+	LightningStrikeCount   float64
+	Battery                float64 // volts
+	ReportInterval         float64 // minutes
+}
+
+// obsSTFieldCount is the number of obs_st fields Observation holds; newer
+// firmware appends more, which are ignored.
+const obsSTFieldCount = 18
+
+// ParseObservation extracts an Observation from an obs_st row, as found in
+// device observations and WebSocket obs_st messages. Only the timestamp is
+// required to be a number.
+func ParseObservation(row []any) (Observation, error) {
+	if len(row) < obsSTFieldCount {
+		return Observation{}, fmt.Errorf("obs_st array too short: got %d, want %d", len(row), obsSTFieldCount)
+	}
+
+	ts, err := Int64(row[0])
+	if err != nil {
+		return Observation{}, fmt.Errorf("parsing timestamp: %w", err)
+	}
+
+	return Observation{
+		Timestamp:              ts,
+		WindLull:               Float(row[1]),
+		WindAvg:                Float(row[2]),
+		WindGust:               Float(row[3]),
+		WindDirection:          Float(row[4]),
+		WindSampleInterval:     Float(row[5]),
+		StationPressure:        Float(row[6]),
+		AirTemperature:         Float(row[7]),
+		RelativeHumidity:       Float(row[8]),
+		Illuminance:            Float(row[9]),
+		UV:                     Float(row[10]),
+		SolarRadiation:         Float(row[11]),
+		RainAccumulated:        Float(row[12]),
+		PrecipitationType:      Float(row[13]),
+		LightningStrikeAvgDist: Float(row[14]),
+		LightningStrikeCount:   Float(row[15]),
+		Battery:                Float(row[16]),
+		ReportInterval:         Float(row[17]),
+	}, nil
+}
+
+// Float converts a decoded JSON number (float64 or json.Number) to float64.
+// Null and anything else become math.NaN.
+func Float(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	default:
+		return math.NaN()
+	}
+}
+
+// Int64 converts a decoded JSON number (float64 or json.Number) to int64,
+// for timestamps. Null, out-of-range values and other types are errors.
+func Int64(v any) (int64, error) {
+	if v == nil {
+		return 0, fmt.Errorf("nil timestamp")
+	}
+	switch n := v.(type) {
+	case float64:
+		if n < math.MinInt64 || n > math.MaxInt64 || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("timestamp out of int64 range: %v", n)
+		}
+		return int64(n), nil
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp number: %w", err)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("invalid timestamp type")
+	}
+}
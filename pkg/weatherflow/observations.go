@@ -0,0 +1,116 @@
+package weatherflow
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HistoryPage is the longest range DeviceHistory requests at once; the API
+// returns longer ranges at reduced resolution.
+const HistoryPage = 24 * time.Hour
+
+// StationObservations is the latest observation of a station's outdoor
+// devices, with the derived values WeatherFlow computes.
+type StationObservations struct {
+	StationID   int                  `json:"station_id"`
+	StationName string               `json:"station_name"`
+	PublicName  string               `json:"public_name"`
+	Latitude    float64              `json:"latitude"`
+	Longitude   float64              `json:"longitude"`
+	Timezone    string               `json:"timezone"`
+	Elevation   float64              `json:"elevation"`
+	Units       map[string]string    `json:"station_units"`
+	Obs         []StationObservation `json:"obs"`
+}
+
+// StationObservation is one named-field observation. Nil fields were null
+// or missing in the response.
+type StationObservation struct {
+	Timestamp              *float64 `json:"timestamp"`
+	WindLull               *float64 `json:"wind_lull"`
+	WindAvg                *float64 `json:"wind_avg"`
+	WindGust               *float64 `json:"wind_gust"`
+	WindDirection          *float64 `json:"wind_direction"`
+	StationPressure        *float64 `json:"station_pressure"`
+	SeaLevelPressure       *float64 `json:"sea_level_pressure"`
+	AirTemperature         *float64 `json:"air_temperature"`
+	RelativeHumidity       *float64 `json:"relative_humidity"`
+	Illuminance            *float64 `json:"illuminance"`
+	UV                     *float64 `json:"uv"`
+	SolarRadiation         *float64 `json:"solar_radiation"`
+	RainAccumulated        *float64 `json:"rain_accumulated"`
+	PrecipitationType      *float64 `json:"precip_type"`
+	LightningStrikeAvgDist *float64 `json:"lightning_strike_avg_distance"`
+	LightningStrikeCount   *float64 `json:"lightning_strike_count"`
+	Battery                *float64 `json:"battery"`
+	ReportInterval         *float64 `json:"report_interval"`
+	FeelsLike              *float64 `json:"feels_like"`
+	DewPoint               *float64 `json:"dew_point"`
+	HeatIndex              *float64 `json:"heat_index"`
+	WindChill              *float64 `json:"wind_chill"`
+}
+
+// StationObservation returns a station's latest observation.
+func (c *Client) StationObservation(ctx context.Context, stationID int) (*StationObservations, error) {
+	var resp StationObservations
+	if err := c.get(ctx, "/observations/station/"+strconv.Itoa(stationID), nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Obs) == 0 {
+		return nil, fmt.Errorf("no observations in response")
+	}
+	return &resp, nil
+}
+
+type deviceObservationsResponse struct {
+	DeviceID int     `json:"device_id"`
+	Type     string  `json:"type"`
+	Obs      [][]any `json:"obs"`
+}
+
+// DeviceObservations returns a Tempest device's obs_st history between
+// start and end, inclusive, oldest first, in a single request. Ranges longer
+// than HistoryPage come back at reduced resolution; use DeviceHistory for
+// full resolution. Rows that fail to parse are skipped.
+func (c *Client) DeviceObservations(ctx context.Context, deviceID int, start, end time.Time) ([]Observation, error) {
+	query := url.Values{
+		"time_start": {strconv.FormatInt(start.Unix(), 10)},
+		"time_end":   {strconv.FormatInt(end.Unix(), 10)},
+	}
+	var resp deviceObservationsResponse
+	if err := c.get(ctx, "/observations/device/"+strconv.Itoa(deviceID), query, &resp); err != nil {
+		return nil, err
+	}
+
+	out := make([]Observation, 0, len(resp.Obs))
+	for _, row := range resp.Obs {
+		obs, err := ParseObservation(row)
+		if err != nil {
+			continue
+		}
+		out = append(out, obs)
+	}
+	return out, nil
+}
+
+// DeviceHistory pages through a device's history between start and end,
+// inclusive, one HistoryPage at a time, oldest first. Each page is fetched
+// when the loop asks for it; an error ends the sequence.
+func (c *Client) DeviceHistory(ctx context.Context, deviceID int, start, end time.Time) iter.Seq2[[]Observation, error] {
+	return func(yield func([]Observation, error) bool) {
+		for from := start; !from.After(end); from = from.Add(HistoryPage) {
+			to := from.Add(HistoryPage - time.Second)
+			if to.After(end) {
+				to = end
+			}
+			page, err := c.DeviceObservations(ctx, deviceID, from, to)
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
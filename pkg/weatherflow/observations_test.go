@@ -0,0 +1,145 @@
+package weatherflow_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func TestClient_StationObservation(t *testing.T) {
+	c, srv := newTestClient(t)
+	ts, temp := 1700000000.0, 22.5
+	srv.SetStationObservation(12345, weatherflow.StationObservation{Timestamp: &ts, AirTemperature: &temp})
+
+	resp, err := c.StationObservation(context.Background(), 12345)
+	if err != nil {
+		t.Fatalf("StationObservation() error: %v", err)
+	}
+	if resp.StationName != "backyard" || resp.Elevation != 1400 {
+		t.Errorf("response = %+v", resp)
+	}
+	obs := resp.Obs[0]
+	if *obs.Timestamp != ts || *obs.AirTemperature != temp || obs.WindAvg != nil {
+		t.Errorf("observation = %+v, want timestamp and temperature only", obs)
+	}
+}
+
+func TestClient_StationObservation_Empty(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	if _, err := c.StationObservation(context.Background(), 12345); err == nil {
+		t.Fatal("expected an error for a response without observations")
+	}
+}
+
+// minuteObs returns one observation a minute from start for n minutes.
+func minuteObs(start int64, n int) []weatherflow.Observation {
+	out := make([]weatherflow.Observation, n)
+	for i := range out {
+		out[i] = weatherflow.Observation{
+			Timestamp:      start + int64(i)*60,
+			AirTemperature: float64(i),
+			UV:             math.NaN(),
+		}
+	}
+	return out
+}
+
+func TestClient_DeviceObservations(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.AddObservations(54321, minuteObs(1700000000, 5)...)
+
+	got, err := c.DeviceObservations(context.Background(), 54321, time.Unix(1700000060, 0), time.Unix(1700000180, 0))
+	if err != nil {
+		t.Fatalf("DeviceObservations() error: %v", err)
+	}
+	if len(got) != 3 || got[0].Timestamp != 1700000060 || got[2].Timestamp != 1700000180 {
+		t.Fatalf("DeviceObservations() = %+v, want minutes 1-3", got)
+	}
+	if got[1].AirTemperature != 2 || !math.IsNaN(got[1].UV) {
+		t.Errorf("observation = %+v, want temperature 2 and NaN UV", got[1])
+	}
+	want := "/observations/device/54321?time_end=1700000180&time_start=1700000060"
+	if reqs := srv.Requests(); len(reqs) != 1 || reqs[0] != want {
+		t.Errorf("requests = %v, want [%s]", reqs, want)
+	}
+}
+
+func TestClient_DeviceHistory(t *testing.T) {
+	c, srv := newTestClient(t)
+	start := time.Unix(1700000000, 0)
+	// Two and a half days of hourly observations.
+	for i := range 60 {
+		srv.AddObservations(54321, weatherflow.Observation{Timestamp: start.Add(time.Duration(i) * time.Hour).Unix()})
+	}
+	end := start.Add(59 * time.Hour)
+
+	var pages, total int
+	var last int64
+	for page, err := range c.DeviceHistory(context.Background(), 54321, start, end) {
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		pages++
+		for _, obs := range page {
+			if obs.Timestamp <= last {
+				t.Fatalf("timestamp %d after %d: pages overlap or are out of order", obs.Timestamp, last)
+			}
+			last = obs.Timestamp
+		}
+		total += len(page)
+	}
+	if pages != 3 || total != 60 {
+		t.Errorf("got %d observations in %d pages, want 60 in 3", total, pages)
+	}
+}
+
+func TestClient_DeviceHistory_StopsEarly(t *testing.T) {
+	c, srv := newTestClient(t)
+	start := time.Unix(1700000000, 0)
+
+	for range c.DeviceHistory(context.Background(), 54321, start, start.Add(10*weatherflow.HistoryPage)) {
+		break
+	}
+	if reqs := srv.Requests(); len(reqs) != 1 {
+		t.Errorf("requests = %d, want 1 after breaking out of the loop", len(reqs))
+	}
+}
+
+func TestClient_DeviceHistory_Error(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.FailNext(1, http.StatusServiceUnavailable, 0)
+	start := time.Unix(1700000000, 0)
+
+	var errs []error
+	for _, err := range c.DeviceHistory(context.Background(), 54321, start, start.Add(3*weatherflow.HistoryPage)) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("errors = %v, want the sequence to end with one error", errs)
+	}
+}
+
+func TestParseObservation(t *testing.T) {
+	row := make([]any, 18)
+	row[0] = 1700000000.0
+	row[7] = 22.5
+	obs, err := weatherflow.ParseObservation(row)
+	if err != nil {
+		t.Fatalf("ParseObservation() error: %v", err)
+	}
+	if obs.Timestamp != 1700000000 || obs.AirTemperature != 22.5 || !math.IsNaN(obs.UV) {
+		t.Errorf("ParseObservation() = %+v", obs)
+	}
+
+	for _, bad := range [][]any{row[:17], append([]any{"x"}, row[1:]...), append([]any{nil}, row[1:]...)} {
+		if _, err := weatherflow.ParseObservation(bad); err == nil {
+			t.Errorf("ParseObservation(%v) succeeded, want error", fmt.Sprint(bad[:1]))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package weatherflow
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Station is a station and its devices.
+type Station struct {
+	StationID   int         `json:"station_id"`
+	Name        string      `json:"name"`
+	PublicName  string      `json:"public_name"`
+	Latitude    float64     `json:"latitude"`
+	Longitude   float64     `json:"longitude"`
+	Timezone    string      `json:"timezone"`
+	StationMeta StationMeta `json:"station_meta"`
+	Devices     []Device    `json:"devices"`
+}
+
+// StationMeta holds a station's siting.
+type StationMeta struct {
+	// Elevation is in meters above sea level.
+	Elevation float64 `json:"elevation"`
+}
+
+// Device is a Tempest, hub or older AIR/SKY unit of a station.
+type Device struct {
+	DeviceID         int        `json:"device_id"`
+	SerialNumber     string     `json:"serial_number"`
+	DeviceType       string     `json:"device_type"` // ST (Tempest), HB (hub), AR (AIR), SK (SKY)
+	HardwareRevision string     `json:"hardware_revision"`
+	FirmwareRevision string     `json:"firmware_revision"`
+	DeviceMeta       DeviceMeta `json:"device_meta"`
+}
+
+// DeviceMeta holds a device's name and siting.
+type DeviceMeta struct {
+	Name        string  `json:"name"`
+	Environment string  `json:"environment"`
+	AGL         float64 `json:"agl"` // height above ground, meters
+}
+
+// Device returns the station's first device of deviceType, e.g. "ST" for
+// the Tempest itself.
+func (s *Station) Device(deviceType string) (Device, bool) {
+	for _, d := range s.Devices {
+		if d.DeviceType == deviceType {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+type stationsResponse struct {
+	Stations []Station `json:"stations"`
+}
+
+// Stations returns every station the token can access.
+func (c *Client) Stations(ctx context.Context) ([]Station, error) {
+	var resp stationsResponse
+	if err := c.get(ctx, "/stations", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Stations, nil
+}
+
+// Station returns one station.
+func (c *Client) Station(ctx context.Context, stationID int) (*Station, error) {
+	var resp stationsResponse
+	if err := c.get(ctx, "/stations/"+strconv.Itoa(stationID), nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Stations) == 0 {
+		return nil, fmt.Errorf("no stations in response")
+	}
+	return &resp.Stations[0], nil
+}
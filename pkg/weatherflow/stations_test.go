@@ -0,0 +1,51 @@
+package weatherflow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func TestClient_Stations(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.AddStation(weatherflow.Station{StationID: 99999, Name: "cabin"})
+
+	stations, err := c.Stations(context.Background())
+	if err != nil {
+		t.Fatalf("Stations() error: %v", err)
+	}
+	if len(stations) != 2 || stations[0].Name != "backyard" || stations[1].Name != "cabin" {
+		t.Fatalf("Stations() = %+v, want backyard and cabin", stations)
+	}
+}
+
+func TestClient_Station(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	st, err := c.Station(context.Background(), 12345)
+	if err != nil {
+		t.Fatalf("Station() error: %v", err)
+	}
+	if st.Name != "backyard" || st.StationMeta.Elevation != 1400 || st.Timezone != "America/Denver" {
+		t.Errorf("Station() = %+v", st)
+	}
+	dev, ok := st.Device("ST")
+	if !ok || dev.DeviceID != 54321 {
+		t.Errorf("Device(ST) = %+v, %v; want device 54321", dev, ok)
+	}
+	if _, ok := st.Device("AR"); ok {
+		t.Error("Device(AR) found, want none")
+	}
+}
+
+func TestClient_Station_NotFound(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.Station(context.Background(), 999)
+	var se *weatherflow.StatusError
+	if !errors.As(err, &se) || se.StatusCode != 404 {
+		t.Fatalf("error = %v, want 404 StatusError", err)
+	}
+}
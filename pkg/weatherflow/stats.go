@@ -0,0 +1,119 @@
+package weatherflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Stats are a station's daily, weekly, monthly, yearly and all-time summary
+// rows. Each row's values follow the API's positional stats layout.
+type Stats struct {
+	StationID       int         `json:"station_id"`
+	FirstObDayLocal string      `json:"first_ob_day_local"`
+	LastObDayLocal  string      `json:"last_ob_day_local"`
+	Day             []StatsRow  `json:"stats_day"`
+	Week            []StatsRow  `json:"stats_week"`
+	Month           []StatsRow  `json:"stats_month"`
+	Year            []StatsRow  `json:"stats_year"`
+	AllTime         StatsValues `json:"stats_alltime"`
+}
+
+// StatsRow is one period's summary. The API sends it as an array whose first
+// element names the period ("2024-05-01", or a number for weeks and years).
+type StatsRow struct {
+	Period string
+	Values StatsValues
+}
+
+// UnmarshalJSON decodes a positional stats row.
+func (r *StatsRow) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return fmt.Errorf("empty stats row")
+	}
+	var period any
+	if err := json.Unmarshal(raw[0], &period); err != nil {
+		return err
+	}
+	switch p := period.(type) {
+	case string:
+		r.Period = p
+	case float64:
+		r.Period = strconv.FormatFloat(p, 'f', -1, 64)
+	default:
+		return fmt.Errorf("invalid stats period %s", raw[0])
+	}
+	r.Values = make(StatsValues, len(raw)-1)
+	for i, v := range raw[1:] {
+		var f *float64
+		if err := json.Unmarshal(v, &f); err != nil {
+			return fmt.Errorf("stats value %d: %w", i+1, err)
+		}
+		r.Values[i] = math.NaN()
+		if f != nil {
+			r.Values[i] = *f
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes r in the API's positional layout.
+func (r StatsRow) MarshalJSON() ([]byte, error) {
+	values, err := r.Values.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	period, err := json.Marshal(r.Period)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Values) == 0 {
+		return []byte("[" + string(period) + "]"), nil
+	}
+	return append([]byte("["+string(period)+","), values[1:]...), nil
+}
+
+// StatsValues are positional summary values; null values are math.NaN.
+type StatsValues []float64
+
+// UnmarshalJSON decodes an array of numbers and nulls.
+func (v *StatsValues) UnmarshalJSON(data []byte) error {
+	var raw []*float64
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*v = make(StatsValues, len(raw))
+	for i, f := range raw {
+		(*v)[i] = math.NaN()
+		if f != nil {
+			(*v)[i] = *f
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes NaN values as null.
+func (v StatsValues) MarshalJSON() ([]byte, error) {
+	raw := make([]*float64, len(v))
+	for i := range v {
+		if !math.IsNaN(v[i]) {
+			raw[i] = &v[i]
+		}
+	}
+	return json.Marshal(raw)
+}
+
+// StationStats returns a station's summary statistics.
+func (c *Client) StationStats(ctx context.Context, stationID int) (*Stats, error) {
+	var resp Stats
+	if err := c.get(ctx, "/stats/station/"+strconv.Itoa(stationID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,78 @@
+package weatherflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+const statsJSON = `{
+	"station_id": 12345,
+	"first_ob_day_local": "2023-01-01",
+	"last_ob_day_local": "2024-05-02",
+	"stats_day": [["2024-05-01", 850.5, null, 3]],
+	"stats_year": [[2023, 851.2, 1.5]],
+	"stats_alltime": [851.0, null],
+	"status": {"status_code": 0, "status_message": "SUCCESS"}
+}`
+
+func TestStats_UnmarshalJSON(t *testing.T) {
+	var st weatherflow.Stats
+	if err := json.Unmarshal([]byte(statsJSON), &st); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	day := st.Day[0]
+	if day.Period != "2024-05-01" || len(day.Values) != 3 || day.Values[0] != 850.5 ||
+		!math.IsNaN(day.Values[1]) || day.Values[2] != 3 {
+		t.Errorf("day row = %+v", day)
+	}
+	if st.Year[0].Period != "2023" {
+		t.Errorf("year period = %q, want 2023", st.Year[0].Period)
+	}
+	if len(st.AllTime) != 2 || !math.IsNaN(st.AllTime[1]) {
+		t.Errorf("all time = %v", st.AllTime)
+	}
+
+	for _, bad := range []string{`[]`, `[{}]`, `["2024", "x"]`} {
+		var row weatherflow.StatsRow
+		if err := json.Unmarshal([]byte(bad), &row); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestStatsRow_MarshalJSON(t *testing.T) {
+	row := weatherflow.StatsRow{Period: "2024-05-01", Values: weatherflow.StatsValues{1.5, math.NaN()}}
+	data, err := json.Marshal(row)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(data) != `["2024-05-01",1.5,null]` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	data, _ = json.Marshal(weatherflow.StatsRow{Period: "2024"})
+	if string(data) != `["2024"]` {
+		t.Errorf("Marshal(empty) = %s", data)
+	}
+}
+
+func TestClient_StationStats(t *testing.T) {
+	c, srv := newTestClient(t)
+	var want weatherflow.Stats
+	if err := json.Unmarshal([]byte(statsJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetStats(12345, want)
+
+	got, err := c.StationStats(context.Background(), 12345)
+	if err != nil {
+		t.Fatalf("StationStats() error: %v", err)
+	}
+	if got.FirstObDayLocal != "2023-01-01" || got.Day[0].Values[0] != 850.5 || !math.IsNaN(got.Day[0].Values[1]) {
+		t.Errorf("StationStats() = %+v", got)
+	}
+}
@@ -0,0 +1,546 @@
+package weatherflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// DefaultStreamURL is the WeatherFlow WebSocket API.
+const DefaultStreamURL = "wss://ws.weatherflow.com/swd/data"
+
+const (
+	// defaultStreamReadTimeout bounds the wait for a single message; obs_st
+	// arrives every minute.
+	defaultStreamReadTimeout = 5 * time.Minute
+	defaultMinReconnect      = time.Second
+	defaultMaxReconnect      = time.Minute
+)
+
+var (
+	// ErrDial is wrapped by the error of a connection that could not be
+	// opened. A rejected handshake also wraps a *StatusError.
+	ErrDial = errors.New("websocket dial failed")
+	// ErrReadTimeout is wrapped by the error of a connection on which no
+	// message arrived within the read timeout.
+	ErrReadTimeout = errors.New("read timeout")
+	// ErrReconfigured ends a connection whose settings were changed by
+	// Reconfigure.
+	ErrReconfigured = errors.New("stream reconfigured")
+	// ErrInvalidDeviceID is returned without connecting when the device ID
+	// is not a positive number.
+	ErrInvalidDeviceID = errors.New("invalid device ID")
+)
+
+// Disconnect describes how a connection attempt ended.
+type Disconnect struct {
+	// Err is why it ended: an error wrapping ErrDial, ErrReadTimeout or
+	// ErrInvalidDeviceID, ErrReconfigured, the cause given to Conn.Close,
+	// or a read error.
+	Err error
+	// Received reports whether the connection delivered an event.
+	Received bool
+	// Uptime is how long the connection was open; zero if it never opened.
+	Uptime time.Duration
+}
+
+// A ReconnectPolicy decides how long Run waits after a connection ends
+// before connecting again. A negative delay waits until Reconfigure is
+// called, and an error stops Run, which returns it. Run calls the policy
+// from its own goroutine.
+type ReconnectPolicy func(d Disconnect) (delay time.Duration, err error)
+
+// Stream is a WebSocket client for a device's live messages. It delivers
+// typed events to callbacks registered with Subscribe and to channels from
+// Events, reconnecting until its context is cancelled.
+type Stream struct {
+	url        string
+	httpClient *http.Client
+	// tokenInHeader sends the token in an Authorization header instead of
+	// the documented token query parameter.
+	tokenInHeader bool
+	// subscriptionID is the id of listen_start, echoed by its ack; empty
+	// uses the request type.
+	subscriptionID string
+
+	readTimeout  time.Duration
+	minReconnect time.Duration
+	maxReconnect time.Duration
+	policy       ReconnectPolicy
+
+	mu sync.Mutex
+	// token, deviceID and rapidWind may change with Reconfigure, which ends
+	// the current connection through cancelConn and wakes Run.
+	token      string
+	deviceID   int
+	rapidWind  bool
+	cancelConn context.CancelCauseFunc
+	wake       chan struct{}
+
+	handlers     []func(Event)
+	onError      []func(error)
+	onMessage    []func(*Conn, []byte, Message, error)
+	onConnect    []func(*Conn)
+	onDisconnect []func(*Conn, error)
+	subs         map[chan Event]struct{}
+}
+
+// A StreamOption configures a Stream.
+type StreamOption func(*Stream)
+
+// WithStreamURL connects to u instead of DefaultStreamURL.
+func WithStreamURL(u string) StreamOption {
+	return func(s *Stream) { s.url = u }
+}
+
+// WithStreamHTTPClient performs the WebSocket handshake with hc.
+func WithStreamHTTPClient(hc *http.Client) StreamOption {
+	return func(s *Stream) { s.httpClient = hc }
+}
+
+// WithRapidWind also subscribes to 3-second rapid_wind samples.
+func WithRapidWind() StreamOption {
+	return func(s *Stream) { s.rapidWind = true }
+}
+
+// WithTokenInHeader sends the token in an Authorization header instead of
+// the token query parameter, which is the only form WeatherFlow documents
+// for the WebSocket. Use it only with endpoints known to accept the header;
+// it keeps the token out of their access logs.
+func WithTokenInHeader() StreamOption {
+	return func(s *Stream) { s.tokenInHeader = true }
+}
+
+// WithSubscriptionID sends id as the id of listen_start, and id + "-rapid"
+// as that of listen_rapid_start, so their acks can be told apart from
+// other clients'. By default the request type is used.
+func WithSubscriptionID(id string) StreamOption {
+	return func(s *Stream) { s.subscriptionID = id }
+}
+
+// WithReadTimeout reconnects when no message arrives for d instead of five
+// minutes.
+func WithReadTimeout(d time.Duration) StreamOption {
+	return func(s *Stream) { s.readTimeout = d }
+}
+
+// WithReconnectBackoff bounds the jittered exponential delay between
+// reconnects, one second to one minute by default.
+func WithReconnectBackoff(min, max time.Duration) StreamOption {
+	return func(s *Stream) { s.minReconnect, s.maxReconnect = min, max }
+}
+
+// WithReconnectPolicy replaces the default policy, which waits a jittered
+// exponential backoff that starts over once a connection has delivered an
+// event, honours Retry-After, and stops on a handshake rejected in a way
+// retrying can't fix.
+func WithReconnectPolicy(p ReconnectPolicy) StreamOption {
+	return func(s *Stream) { s.policy = p }
+}
+
+// NewStream returns a stream of deviceID's messages that authenticates with
+// token. Call Run to connect.
+func NewStream(token string, deviceID int, opts ...StreamOption) *Stream {
+	s := &Stream{
+		token:        token,
+		deviceID:     deviceID,
+		url:          DefaultStreamURL,
+		httpClient:   http.DefaultClient,
+		readTimeout:  defaultStreamReadTimeout,
+		minReconnect: defaultMinReconnect,
+		maxReconnect: defaultMaxReconnect,
+		wake:         make(chan struct{}, 1),
+		subs:         make(map[chan Event]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Subscribe calls fn with every event, in order, on the goroutine running
+// Run. fn must not block.
+func (s *Stream) Subscribe(fn func(Event)) {
+	s.mu.Lock()
+	s.handlers = append(s.handlers, fn)
+	s.mu.Unlock()
+}
+
+// Events returns a channel that receives every event and a function that
+// unsubscribes and closes it. Events are dropped while the channel's buffer
+// is full, so a slow reader never holds up the stream.
+func (s *Stream) Events(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subs, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// OnError calls fn with every connection error and every message that could
+// not be parsed (a *ParseError). fn must not block.
+func (s *Stream) OnError(fn func(error)) {
+	s.mu.Lock()
+	s.onError = append(s.onError, fn)
+	s.mu.Unlock()
+}
+
+// OnMessage calls fn with every message read from a connection or passed to
+// Dispatch, before its event is delivered: the connection (nil for
+// Dispatch), the raw bytes, which must not be modified, and the result of
+// ParseMessage. Acks and other control messages only reach OnMessage.
+// fn must not block.
+func (s *Stream) OnMessage(fn func(c *Conn, data []byte, msg Message, err error)) {
+	s.mu.Lock()
+	s.onMessage = append(s.onMessage, fn)
+	s.mu.Unlock()
+}
+
+// OnConnect calls fn when a connection opens, before the subscription is
+// sent. fn must not block; it may start goroutines that watch the
+// connection until c.Done.
+func (s *Stream) OnConnect(fn func(c *Conn)) {
+	s.mu.Lock()
+	s.onConnect = append(s.onConnect, fn)
+	s.mu.Unlock()
+}
+
+// OnDisconnect calls fn with every connection that OnConnect saw, once it
+// has ended, and why. It runs before the reconnect policy. fn must not
+// block.
+func (s *Stream) OnDisconnect(fn func(c *Conn, err error)) {
+	s.mu.Lock()
+	s.onDisconnect = append(s.onDisconnect, fn)
+	s.mu.Unlock()
+}
+
+// Reconfigure changes the token, device and rapid wind subscription. If
+// anything changed, the current connection ends with ErrReconfigured and
+// Run connects again without waiting. It reports whether anything changed
+// and is safe to call while Run is running.
+func (s *Stream) Reconfigure(token string, deviceID int, rapidWind bool) bool {
+	s.mu.Lock()
+	changed := token != s.token || deviceID != s.deviceID || rapidWind != s.rapidWind
+	s.token, s.deviceID, s.rapidWind = token, deviceID, rapidWind
+	cancel := s.cancelConn
+	s.mu.Unlock()
+	if !changed {
+		return false
+	}
+	if cancel != nil {
+		cancel(ErrReconfigured)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Dispatch handles data as if it had been read from a connection, for
+// messages from another source such as a recording or the UDP broadcast.
+func (s *Stream) Dispatch(data []byte) {
+	s.handle(nil, data)
+}
+
+// handle parses one message, passes it to the OnMessage hooks and delivers
+// its event, reporting whether there was one.
+func (s *Stream) handle(c *Conn, data []byte) bool {
+	msg, err := ParseMessage(data)
+	s.mu.Lock()
+	hooks := s.onMessage
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn(c, data, msg, err)
+	}
+	if err != nil {
+		s.reportError(err)
+		return false
+	}
+	if msg.Event == nil {
+		return false
+	}
+	s.publish(msg.Event)
+	return true
+}
+
+func (s *Stream) publish(ev Event) {
+	s.mu.Lock()
+	handlers := s.handlers
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	for _, fn := range handlers {
+		fn(ev)
+	}
+}
+
+func (s *Stream) reportError(err error) {
+	s.mu.Lock()
+	handlers := s.onError
+	s.mu.Unlock()
+	for _, fn := range handlers {
+		fn(err)
+	}
+}
+
+// Run connects, subscribes and delivers events until ctx is done,
+// reconnecting after the delay the reconnect policy gives. It returns ctx's
+// error or the policy's; with the default policy, that is a *StatusError if
+// the handshake was rejected in a way retrying can't fix, such as a 401 for
+// a bad token.
+func (s *Stream) Run(ctx context.Context) error {
+	policy := s.policy
+	if policy == nil {
+		policy = s.defaultPolicy()
+	}
+	for {
+		// A Reconfigure before this connection has nothing left to cut
+		// short; connect picks up its settings.
+		select {
+		case <-s.wake:
+		default:
+		}
+		d := s.connect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.reportError(d.Err)
+
+		delay, err := policy(d)
+		if err != nil {
+			return err
+		}
+		var wait <-chan time.Time
+		if delay >= 0 {
+			wait = time.After(delay)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		case <-s.wake:
+		}
+	}
+}
+
+// RunOnce makes a single connection and delivers events until it ends,
+// returning why. Run calls it in a loop.
+func (s *Stream) RunOnce(ctx context.Context) error {
+	return s.connect(ctx).Err
+}
+
+func (s *Stream) defaultPolicy() ReconnectPolicy {
+	bo := NewBackoff(s.minReconnect, s.maxReconnect)
+	return func(d Disconnect) (time.Duration, error) {
+		if d.Received {
+			bo.Reset()
+		}
+		delay := bo.Next()
+		var se *StatusError
+		if errors.As(d.Err, &se) {
+			if !se.Temporary() {
+				return 0, d.Err
+			}
+			delay = max(delay, se.RetryAfter)
+		}
+		return delay, nil
+	}
+}
+
+// connect runs one connection until it fails.
+func (s *Stream) connect(ctx context.Context) Disconnect {
+	// Register the cancel func before reading the settings, so a
+	// Reconfigure in between ends this attempt instead of being missed.
+	connCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	s.mu.Lock()
+	s.cancelConn = cancel
+	token, deviceID, rapidWind := s.token, s.deviceID, s.rapidWind
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancelConn = nil
+		s.mu.Unlock()
+	}()
+
+	if deviceID <= 0 {
+		return Disconnect{Err: fmt.Errorf("%w %d", ErrInvalidDeviceID, deviceID)}
+	}
+
+	ws, err := s.dial(connCtx, token)
+	if err != nil {
+		if cause := context.Cause(connCtx); errors.Is(cause, ErrReconfigured) {
+			err = cause
+		}
+		return Disconnect{Err: err}
+	}
+	defer func() { _ = ws.CloseNow() }()
+
+	c := &Conn{
+		ws:             ws,
+		ctx:            connCtx,
+		cancel:         cancel,
+		opened:         time.Now(),
+		deviceID:       deviceID,
+		rapidWind:      rapidWind,
+		subscriptionID: s.subscriptionID,
+	}
+	s.mu.Lock()
+	onConnect, onDisconnect := s.onConnect, s.onDisconnect
+	s.mu.Unlock()
+	for _, fn := range onConnect {
+		fn(c)
+	}
+
+	received, err := s.read(c)
+	cancel(err)
+	for _, fn := range onDisconnect {
+		fn(c, err)
+	}
+	return Disconnect{Err: err, Received: received, Uptime: time.Since(c.opened)}
+}
+
+// dial opens a connection authenticated with token.
+func (s *Stream) dial(ctx context.Context, token string) (*websocket.Conn, error) {
+	opts := &websocket.DialOptions{HTTPClient: s.httpClient}
+	dialURL := s.url
+	if s.tokenInHeader {
+		opts.HTTPHeader = http.Header{"Authorization": {"Bearer " + token}}
+	} else {
+		dialURL += "?token=" + url.QueryEscape(token)
+	}
+
+	ws, resp, err := websocket.Dial(ctx, dialURL, opts)
+	if err == nil {
+		return ws, nil
+	}
+	if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, fmt.Errorf("%w: %w", ErrDial, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Body:       redactToken(strings.TrimSpace(string(body)), token),
+		})
+	}
+	// The error may contain the URL, and with it the token.
+	return nil, fmt.Errorf("%w: %s", ErrDial, redactToken(err.Error(), token))
+}
+
+// read subscribes and delivers c's messages until it fails. received
+// reports whether it delivered an event.
+func (s *Stream) read(c *Conn) (received bool, err error) {
+	if err := c.Subscribe(); err != nil {
+		return false, c.closeErr(err)
+	}
+	for {
+		readCtx, cancel := context.WithTimeout(c.ctx, s.readTimeout)
+		_, data, err := c.ws.Read(readCtx)
+		timedOut := errors.Is(readCtx.Err(), context.DeadlineExceeded) && c.ctx.Err() == nil
+		cancel()
+		if err != nil {
+			if timedOut {
+				return received, fmt.Errorf("%w after %s: %w", ErrReadTimeout, s.readTimeout, err)
+			}
+			return received, c.closeErr(fmt.Errorf("reading: %w", err))
+		}
+		if s.handle(c, data) {
+			received = true
+		}
+	}
+}
+
+// redactToken masks token, raw or query-escaped, in s.
+func redactToken(s, token string) string {
+	if token == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, url.QueryEscape(token), "[REDACTED]")
+	return strings.ReplaceAll(s, token, "[REDACTED]")
+}
+
+// Conn is an open stream connection, passed to the OnConnect, OnDisconnect
+// and OnMessage hooks.
+type Conn struct {
+	ws             *websocket.Conn
+	ctx            context.Context
+	cancel         context.CancelCauseFunc
+	opened         time.Time
+	deviceID       int
+	rapidWind      bool
+	subscriptionID string
+}
+
+// Opened returns when the connection opened.
+func (c *Conn) Opened() time.Time { return c.opened }
+
+// DeviceID returns the device the connection subscribes to.
+func (c *Conn) DeviceID() int { return c.deviceID }
+
+// Done returns a channel that is closed when the connection ends.
+func (c *Conn) Done() <-chan struct{} { return c.ctx.Done() }
+
+// Close ends the connection; cause becomes its Disconnect.Err.
+func (c *Conn) Close(cause error) { c.cancel(cause) }
+
+// Subscribe sends listen_start, and listen_rapid_start if enabled. It is
+// sent when the connection opens and may be sent again, for example when
+// its ack doesn't arrive.
+func (c *Conn) Subscribe() error {
+	types := []string{"listen_start"}
+	if c.rapidWind {
+		types = append(types, "listen_rapid_start")
+	}
+	for _, typ := range types {
+		id := typ
+		if c.subscriptionID != "" {
+			id = c.subscriptionID
+			if typ == "listen_rapid_start" {
+				id += "-rapid"
+			}
+		}
+		data, err := json.Marshal(map[string]any{
+			"type":      typ,
+			"device_id": c.deviceID,
+			"id":        id,
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.ws.Write(c.ctx, websocket.MessageText, data); err != nil {
+			return fmt.Errorf("sending %s: %w", typ, err)
+		}
+	}
+	return nil
+}
+
+// closeErr returns the cause given to Close or Reconfigure instead of err,
+// the read or write error it provoked.
+func (c *Conn) closeErr(err error) error {
+	if cause := context.Cause(c.ctx); cause != nil && c.ctx.Err() != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,323 @@
+package weatherflow_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow/weatherflowtest"
+)
+
+const obsSTMessage = `{"type":"obs_st","device_id":12345,"obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,1]]}`
+
+// receive returns the next event from events, failing the test after a second.
+func receive(t *testing.T, events <-chan weatherflow.Event) weatherflow.Event {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event within 1s")
+		return nil
+	}
+}
+
+func TestStream_DeliversEvents(t *testing.T) {
+	srv := weatherflowtest.NewStreamServer(testToken)
+	defer srv.Close()
+	srv.Send(obsSTMessage,
+		`not json`,
+		`{"type":"rapid_wind","device_id":12345,"ob":[1700000003,2.5,270]}`,
+		`{"type":"evt_strike","device_id":12345,"evt":[1700000004,12,3000]}`,
+	)
+
+	s := weatherflow.NewStream(testToken, 12345, weatherflow.WithStreamURL(srv.WebSocketURL()), weatherflow.WithRapidWind())
+	events, unsubscribe := s.Events(10)
+	defer unsubscribe()
+	var (
+		mu        sync.Mutex
+		callbacks []weatherflow.Event
+		errs      []error
+	)
+	s.Subscribe(func(ev weatherflow.Event) {
+		mu.Lock()
+		callbacks = append(callbacks, ev)
+		mu.Unlock()
+	})
+	s.OnError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	if obs, ok := receive(t, events).(weatherflow.Observation); !ok || obs.AirTemperature != 22.5 {
+		t.Errorf("first event = %#v, want the observation", obs)
+	}
+	if rw, ok := receive(t, events).(weatherflow.RapidWind); !ok || rw.Speed != 2.5 {
+		t.Errorf("second event = %#v, want rapid wind", rw)
+	}
+	if st, ok := receive(t, events).(weatherflow.Strike); !ok || st.Distance != 12 {
+		t.Errorf("third event = %#v, want a strike", st)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(callbacks) != 3 {
+		t.Errorf("callbacks got %d events, want 3", len(callbacks))
+	}
+	var pe *weatherflow.ParseError
+	if len(errs) == 0 || !errors.As(errs[0], &pe) || pe.Stage != weatherflow.StageEnvelope {
+		t.Errorf("errors = %v, want an envelope ParseError first", errs)
+	}
+	if got := srv.Subscriptions(); !slices.Equal(got, []string{"listen_start", "listen_rapid_start"}) {
+		t.Errorf("subscriptions = %v, want listen_start and listen_rapid_start", got)
+	}
+}
+
+func TestStream_Reconnects(t *testing.T) {
+	srv := weatherflowtest.NewStreamServer(testToken)
+	defer srv.Close()
+
+	s := weatherflow.NewStream(testToken, 12345,
+		weatherflow.WithStreamURL(srv.WebSocketURL()),
+		weatherflow.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+	)
+	events, unsubscribe := s.Events(10)
+	defer unsubscribe()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = s.Run(ctx) }()
+
+	if err := srv.WaitSubscriptions(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	srv.DropConnections()
+	if err := srv.WaitSubscriptions(ctx, 2); err != nil {
+		t.Fatalf("no resubscription after the connection dropped: %v", err)
+	}
+	srv.Send(obsSTMessage)
+	if _, ok := receive(t, events).(weatherflow.Observation); !ok {
+		t.Error("no observation after reconnecting")
+	}
+}
+
+func TestStream_RejectedToken(t *testing.T) {
+	srv := weatherflowtest.NewStreamServer(testToken)
+	defer srv.Close()
+
+	for _, opt := range []weatherflow.StreamOption{func(*weatherflow.Stream) {}, weatherflow.WithTokenInHeader()} {
+		s := weatherflow.NewStream("supersecrettoken", 12345, weatherflow.WithStreamURL(srv.WebSocketURL()), opt)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.Run(ctx)
+		cancel()
+
+		var se *weatherflow.StatusError
+		if !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Run() = %v, want a 401 StatusError", err)
+		}
+		if strings.Contains(err.Error(), "supersecrettoken") {
+			t.Errorf("token leaked in error: %v", err)
+		}
+	}
+}
+
+func TestStream_TokenInHeader(t *testing.T) {
+	srv := weatherflowtest.NewStreamServer(testToken)
+	defer srv.Close()
+	srv.Send(obsSTMessage)
+
+	s := weatherflow.NewStream(testToken, 12345, weatherflow.WithStreamURL(srv.WebSocketURL()), weatherflow.WithTokenInHeader())
+	events, unsubscribe := s.Events(1)
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = s.Run(ctx) }()
+
+	if _, ok := receive(t, events).(weatherflow.Observation); !ok {
+		t.Error("no observation with the token in the header")
+	}
+}
+
+func TestStream_Hooks(t *testing.T) {
+	srv := weatherflowtest.NewStreamServer(testToken)
+	defer srv.Close()
+
+	s := weatherflow.NewStream(testToken, 12345,
+		weatherflow.WithStreamURL(srv.WebSocketURL()),
+		weatherflow.WithSubscriptionID("exporter"),
+		weatherflow.WithRapidWind(),
+	)
+	var (
+		mu           sync.Mutex
+		connected    *weatherflow.Conn
+		disconnected error
+		acks         []string
+	)
+	errDone := errors.New("both acks received")
+	s.OnConnect(func(c *weatherflow.Conn) {
+		mu.Lock()
+		connected = c
+		mu.Unlock()
+	})
+	s.OnDisconnect(func(c *weatherflow.Conn, err error) {
+		mu.Lock()
+		if c != connected {
+			t.Error("OnDisconnect got a different connection than OnConnect")
+		}
+		disconnected = err
+		mu.Unlock()
+	})
+	s.OnMessage(func(c *weatherflow.Conn, data []byte, msg weatherflow.Message, err error) {
+		if c == nil || err != nil {
+			t.Errorf("OnMessage(%v, %s, %v)", c, data, err)
+			return
+		}
+		if msg.Type != "ack" {
+			return
+		}
+		mu.Lock()
+		acks = append(acks, msg.ID)
+		done := len(acks) == 2
+		mu.Unlock()
+		if done {
+			c.Close(errDone)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.RunOnce(ctx); !errors.Is(err, errDone) {
+		t.Fatalf("RunOnce() = %v, want the cause given to Close", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if connected == nil || connected.DeviceID() != 12345 || connected.Opened().IsZero() {
+		t.Errorf("OnConnect got %+v", connected)
+	}
+	if !errors.Is(disconnected, errDone) {
+		t.Errorf("OnDisconnect got %v, want the cause given to Close", disconnected)
+	}
+	if !slices.Equal(acks, []string{"exporter", "exporter-rapid"}) {
+		t.Errorf("acks = %v, want the subscription IDs", acks)
+	}
+}
+
+func TestStream_Reconfigure(t *testing.T) {
+	srv := weatherflowtest.NewStreamServer(testToken)
+	defer srv.Close()
+
+	disconnects := make(chan error, 4)
+	s := weatherflow.NewStream(testToken, 12345,
+		weatherflow.WithStreamURL(srv.WebSocketURL()),
+		weatherflow.WithReconnectPolicy(func(d weatherflow.Disconnect) (time.Duration, error) {
+			disconnects <- d.Err
+			// Only Reconfigure may start the next connection.
+			return -1, nil
+		}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = s.Run(ctx) }()
+
+	if err := srv.WaitSubscriptions(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if s.Reconfigure(testToken, 12345, false) {
+		t.Error("Reconfigure with unchanged settings reported a change")
+	}
+	if !s.Reconfigure(testToken, 12345, true) {
+		t.Error("Reconfigure with rapid wind reported no change")
+	}
+	if err := <-disconnects; !errors.Is(err, weatherflow.ErrReconfigured) {
+		t.Errorf("disconnect = %v, want ErrReconfigured", err)
+	}
+	if err := srv.WaitSubscriptions(ctx, 3); err != nil {
+		t.Fatalf("no resubscription after Reconfigure: %v", err)
+	}
+
+	// A dropped connection waits for the next Reconfigure.
+	srv.DropConnections()
+	<-disconnects
+	s.Reconfigure(testToken, 12345, false)
+	if err := srv.WaitSubscriptions(ctx, 4); err != nil {
+		t.Fatalf("Reconfigure did not end the wait: %v", err)
+	}
+	want := []string{"listen_start", "listen_start", "listen_rapid_start", "listen_start"}
+	if got := srv.Subscriptions(); !slices.Equal(got, want) {
+		t.Errorf("subscriptions = %v, want %v", got, want)
+	}
+}
+
+func TestStream_PolicyErrorStopsRun(t *testing.T) {
+	errStop := errors.New("stop")
+	s := weatherflow.NewStream(testToken, 12345,
+		weatherflow.WithStreamURL("ws://127.0.0.1:1"),
+		weatherflow.WithReconnectPolicy(func(weatherflow.Disconnect) (time.Duration, error) {
+			return 0, errStop
+		}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Run(ctx); !errors.Is(err, errStop) {
+		t.Errorf("Run() = %v, want the policy's error", err)
+	}
+}
+
+func TestStream_DialErrorRedactsToken(t *testing.T) {
+	s := weatherflow.NewStream("supersecrettoken", 12345, weatherflow.WithStreamURL("ws://127.0.0.1:1"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.RunOnce(ctx)
+	if !errors.Is(err, weatherflow.ErrDial) {
+		t.Fatalf("RunOnce() = %v, want ErrDial", err)
+	}
+	if strings.Contains(err.Error(), "supersecrettoken") {
+		t.Errorf("token leaked in error: %v", err)
+	}
+}
+
+func TestStream_InvalidDeviceID(t *testing.T) {
+	s := weatherflow.NewStream(testToken, 0, weatherflow.WithStreamURL("ws://127.0.0.1:1"))
+	s.OnConnect(func(*weatherflow.Conn) { t.Error("connected with an invalid device ID") })
+	if err := s.RunOnce(context.Background()); !errors.Is(err, weatherflow.ErrInvalidDeviceID) {
+		t.Errorf("RunOnce() = %v, want ErrInvalidDeviceID", err)
+	}
+}
+
+func TestStream_Dispatch(t *testing.T) {
+	s := weatherflow.NewStream(testToken, 12345)
+	events, unsubscribe := s.Events(1)
+	defer unsubscribe()
+	var raw []string
+	s.OnMessage(func(c *weatherflow.Conn, data []byte, _ weatherflow.Message, _ error) {
+		if c != nil {
+			t.Error("OnMessage got a connection for a dispatched message")
+		}
+		raw = append(raw, string(data))
+	})
+
+	s.Dispatch([]byte(obsSTMessage))
+	if _, ok := receive(t, events).(weatherflow.Observation); !ok {
+		t.Error("no observation from Dispatch")
+	}
+	if !slices.Equal(raw, []string{obsSTMessage}) {
+		t.Errorf("OnMessage got %q", raw)
+	}
+}
@@ -0,0 +1,316 @@
+// Package weatherflowtest provides a local fake of the WeatherFlow REST API
+// for testing code that uses the weatherflow package.
+package weatherflowtest
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+// Server is a fake WeatherFlow REST API. Point a client at it with
+// weatherflow.WithBaseURL(srv.URL). Requests must carry the server's token.
+type Server struct {
+	*httptest.Server
+
+	token string
+
+	mu         sync.Mutex
+	stations   map[int]weatherflow.Station
+	stationObs map[int]weatherflow.StationObservation
+	deviceObs  map[int][]weatherflow.Observation
+	forecasts  map[int]weatherflow.Forecast
+	stats      map[int]weatherflow.Stats
+	failures   []failure
+	requests   []string
+}
+
+type failure struct {
+	status     int
+	retryAfter time.Duration
+}
+
+// NewServer starts a server that accepts token. Close it when done.
+func NewServer(token string) *Server {
+	s := &Server{
+		token:      token,
+		stations:   make(map[int]weatherflow.Station),
+		stationObs: make(map[int]weatherflow.StationObservation),
+		deviceObs:  make(map[int][]weatherflow.Observation),
+		forecasts:  make(map[int]weatherflow.Forecast),
+		stats:      make(map[int]weatherflow.Stats),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stations", s.handleStations)
+	mux.HandleFunc("GET /stations/{id}", s.handleStation)
+	mux.HandleFunc("GET /observations/station/{id}", s.handleStationObservation)
+	mux.HandleFunc("GET /observations/device/{id}", s.handleDeviceObservations)
+	mux.HandleFunc("GET /better_forecast", s.handleForecast)
+	mux.HandleFunc("GET /stats/station/{id}", s.handleStats)
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// AddStation adds or replaces a station.
+func (s *Server) AddStation(st weatherflow.Station) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stations[st.StationID] = st
+}
+
+// SetStationObservation sets a station's latest observation.
+func (s *Server) SetStationObservation(stationID int, obs weatherflow.StationObservation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stationObs[stationID] = obs
+}
+
+// AddObservations adds to a device's history. Device requests return the
+// observations within the requested range, oldest first.
+func (s *Server) AddObservations(deviceID int, obs ...weatherflow.Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := append(s.deviceObs[deviceID], obs...)
+	slices.SortFunc(all, func(a, b weatherflow.Observation) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+	s.deviceObs[deviceID] = all
+}
+
+// SetForecast sets a station's better_forecast response.
+func (s *Server) SetForecast(stationID int, f weatherflow.Forecast) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forecasts[stationID] = f
+}
+
+// SetStats sets a station's stats response.
+func (s *Server) SetStats(stationID int, st weatherflow.Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats[stationID] = st
+}
+
+// FailNext answers the next n requests with status, and a Retry-After
+// header if retryAfter is positive.
+func (s *Server) FailNext(n, status int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.failures = append(s.failures, failure{status: status, retryAfter: retryAfter})
+	}
+}
+
+// Requests returns the path and query of every request received, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// middleware records the request, then applies queued failures and the
+// token check.
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.RequestURI())
+		var fail *failure
+		if len(s.failures) > 0 {
+			fail = &s.failures[0]
+			s.failures = s.failures[1:]
+		}
+		s.mu.Unlock()
+
+		if fail != nil {
+			if fail.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(fail.retryAfter.Seconds())))
+			}
+			writeStatus(w, fail.status, http.StatusText(fail.status))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+s.token {
+			writeStatus(w, http.StatusUnauthorized, "UNAUTHORIZED")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStations(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	ids := make([]int, 0, len(s.stations))
+	for id := range s.stations {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	stations := make([]weatherflow.Station, 0, len(ids))
+	for _, id := range ids {
+		stations = append(stations, s.stations[id])
+	}
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"stations": stations})
+}
+
+func (s *Server) handleStation(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	st, found := s.stations[id]
+	s.mu.Unlock()
+	if !found {
+		writeStatus(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+	writeOK(w, map[string]any{"stations": []weatherflow.Station{st}})
+}
+
+func (s *Server) handleStationObservation(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	st, found := s.stations[id]
+	obs, hasObs := s.stationObs[id]
+	s.mu.Unlock()
+	if !found {
+		writeStatus(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+	resp := weatherflow.StationObservations{
+		StationID:   st.StationID,
+		StationName: st.Name,
+		PublicName:  st.PublicName,
+		Latitude:    st.Latitude,
+		Longitude:   st.Longitude,
+		Timezone:    st.Timezone,
+		Elevation:   st.StationMeta.Elevation,
+		Obs:         []weatherflow.StationObservation{},
+	}
+	if hasObs {
+		resp.Obs = append(resp.Obs, obs)
+	}
+	writeOK(w, resp)
+}
+
+func (s *Server) handleDeviceObservations(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	start, err1 := strconv.ParseInt(q.Get("time_start"), 10, 64)
+	end, err2 := strconv.ParseInt(q.Get("time_end"), 10, 64)
+	if err1 != nil || err2 != nil {
+		writeStatus(w, http.StatusBadRequest, "time_start and time_end are required")
+		return
+	}
+
+	s.mu.Lock()
+	rows := [][]*float64{}
+	for _, obs := range s.deviceObs[id] {
+		if obs.Timestamp >= start && obs.Timestamp <= end {
+			rows = append(rows, obsRow(obs))
+		}
+	}
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"device_id": id, "type": "obs_st", "obs": rows})
+}
+
+func (s *Server) handleForecast(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("station_id"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "station_id is required")
+		return
+	}
+	s.mu.Lock()
+	f, found := s.forecasts[id]
+	s.mu.Unlock()
+	if !found {
+		writeStatus(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+	writeOK(w, f)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	st, found := s.stats[id]
+	s.mu.Unlock()
+	if !found {
+		writeStatus(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+	writeOK(w, st)
+}
+
+// pathID parses the {id} path value, answering 400 if it isn't a number.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// obsRow encodes obs as an obs_st row with NaN as null.
+func obsRow(obs weatherflow.Observation) []*float64 {
+	ts := float64(obs.Timestamp)
+	values := []float64{
+		obs.WindLull, obs.WindAvg, obs.WindGust, obs.WindDirection,
+		obs.WindSampleInterval, obs.StationPressure, obs.AirTemperature,
+		obs.RelativeHumidity, obs.Illuminance, obs.UV, obs.SolarRadiation,
+		obs.RainAccumulated, obs.PrecipitationType, obs.LightningStrikeAvgDist,
+		obs.LightningStrikeCount, obs.Battery, obs.ReportInterval,
+	}
+	row := []*float64{&ts}
+	for i := range values {
+		if math.IsNaN(values[i]) {
+			row = append(row, nil)
+		} else {
+			row = append(row, &values[i])
+		}
+	}
+	return row
+}
+
+// writeOK writes v with a successful status object merged in.
+func writeOK(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body["status"] = json.RawMessage(`{"status_code":0,"status_message":"SUCCESS"}`)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeStatus writes an error response in the API's format.
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status": map[string]any{"status_code": code, "status_message": message},
+	})
+}
@@ -0,0 +1,83 @@
+package weatherflowtest
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func get(t *testing.T, url, token string) (*http.Response, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(resp.Body)
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return resp, body
+}
+
+func TestServer_RejectsWrongToken(t *testing.T) {
+	srv := NewServer("good")
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/stations", "bad")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+	if st := body["status"].(map[string]any); st["status_code"] != 401.0 {
+		t.Errorf("status object = %v", st)
+	}
+}
+
+func TestServer_DeviceObservationsEncodeNaNAsNull(t *testing.T) {
+	srv := NewServer("good")
+	defer srv.Close()
+	srv.AddObservations(1, weatherflow.Observation{Timestamp: 120, AirTemperature: 20},
+		weatherflow.Observation{Timestamp: 60, AirTemperature: nan()})
+
+	_, body := get(t, srv.URL+"/observations/device/1?time_start=0&time_end=200", "good")
+	rows := body["obs"].([]any)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %v, want 2", rows)
+	}
+	first := rows[0].([]any)
+	if first[0] != 60.0 || first[7] != nil {
+		t.Errorf("first row = %v, want timestamp 60 with null temperature", first)
+	}
+	if len(first) != 18 {
+		t.Errorf("row has %d fields, want 18", len(first))
+	}
+}
+
+func TestServer_FailNext(t *testing.T) {
+	srv := NewServer("good")
+	defer srv.Close()
+	srv.FailNext(2, http.StatusTooManyRequests, 5*time.Second)
+
+	for i := range 2 {
+		resp, _ := get(t, srv.URL+"/stations", "good")
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "5" {
+			t.Errorf("request %d: status %d, Retry-After %q", i, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	if resp, _ := get(t, srv.URL+"/stations", "good"); resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d after failures, want 200", resp.StatusCode)
+	}
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+func nan() float64 { return math.NaN() }
@@ -0,0 +1,184 @@
+package weatherflowtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// StreamServer is a fake WeatherFlow WebSocket API. It acknowledges
+// listen_start and listen_rapid_start and delivers messages given to Send.
+// Connections must carry the server's token in an Authorization header or
+// the token query parameter.
+type StreamServer struct {
+	*httptest.Server
+
+	token string
+
+	mu            sync.Mutex
+	conns         map[*websocket.Conn]struct{}
+	subscribed    map[*websocket.Conn]chan string
+	pending       []string
+	subscriptions []string
+	notify        chan struct{}
+}
+
+// NewStreamServer starts a server that accepts token. Close it when done.
+func NewStreamServer(token string) *StreamServer {
+	s := &StreamServer{
+		token:      token,
+		conns:      make(map[*websocket.Conn]struct{}),
+		subscribed: make(map[*websocket.Conn]chan string),
+		notify:     make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// WebSocketURL returns the ws:// URL of the server.
+func (s *StreamServer) WebSocketURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// Send delivers raw JSON messages, in order, to every connection that has
+// subscribed. Messages sent before any connection subscribed go to the first
+// one that does.
+func (s *StreamServer) Send(messages ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscribed) == 0 {
+		s.pending = append(s.pending, messages...)
+		return
+	}
+	for _, out := range s.subscribed {
+		for _, m := range messages {
+			out <- m
+		}
+	}
+}
+
+// DropConnections closes every connection without a close frame, as a
+// network failure would.
+func (s *StreamServer) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.CloseNow()
+	}
+}
+
+// Close drops every connection and shuts the server down.
+func (s *StreamServer) Close() {
+	s.DropConnections()
+	s.Server.Close()
+}
+
+// Subscriptions returns the type of every subscription request received, in
+// order, e.g. "listen_start".
+func (s *StreamServer) Subscriptions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.subscriptions)
+}
+
+// WaitSubscriptions blocks until n subscription requests have arrived or ctx
+// is done.
+func (s *StreamServer) WaitSubscriptions(ctx context.Context, n int) error {
+	for {
+		s.mu.Lock()
+		got, notify := len(s.subscriptions), s.notify
+		s.mu.Unlock()
+		if got >= n {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func (s *StreamServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.token && r.URL.Query().Get("token") != s.token {
+		writeStatus(w, http.StatusUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	ctx := r.Context()
+	out := make(chan string, 256)
+	out <- `{"type":"connection_opened"}`
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		s.readRequests(ctx, conn, out)
+	}()
+	defer func() {
+		// Once the reader is done the connection can't subscribe again.
+		_ = conn.CloseNow()
+		<-readerDone
+		s.mu.Lock()
+		delete(s.conns, conn)
+		delete(s.subscribed, conn)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-out:
+			if err := conn.Write(ctx, websocket.MessageText, []byte(m)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readRequests acknowledges subscription requests. The first one subscribes
+// the connection to Send.
+func (s *StreamServer) readRequests(ctx context.Context, conn *websocket.Conn, out chan string) {
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			_ = conn.CloseNow()
+			return
+		}
+		var req struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if json.Unmarshal(data, &req) != nil || !strings.HasPrefix(req.Type, "listen_") {
+			continue
+		}
+		ack, _ := json.Marshal(map[string]string{"type": "ack", "id": req.ID})
+
+		s.mu.Lock()
+		s.subscriptions = append(s.subscriptions, req.Type)
+		close(s.notify)
+		s.notify = make(chan struct{})
+		out <- string(ack)
+		if _, ok := s.subscribed[conn]; !ok {
+			s.subscribed[conn] = out
+			for _, m := range s.pending {
+				out <- m
+			}
+			s.pending = nil
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// recordedMessage is one line of a recording. Data holds the message as
+// received when it is valid JSON; otherwise Raw holds it as a string.
+type recordedMessage struct {
+	Received time.Time       `json:"received"`
+	Type     string          `json:"type,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Raw      string          `json:"raw,omitempty"`
+}
+
+// Recorder appends every upstream message to a JSONL file, rotating it when
+// it reaches maxSize. Rotated files are named path.1 (newest) to path.N.
+type Recorder struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+}
+
+// NewRecorder opens path for appending. maxFiles is the number of rotated
+// files kept in addition to path.
+func NewRecorder(path string, maxSize int64, maxFiles int) (*Recorder, error) {
+	r := &Recorder{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening recording: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("opening recording: %w", err)
+	}
+	r.file = f
+	r.buf = bufio.NewWriter(f)
+	r.size = info.Size()
+	return nil
+}
+
+// Attach records every message the client receives, including ones that are
+// not valid JSON.
+func (r *Recorder) Attach(c *Client) {
+	c.OnMessage(func(msgType string, data []byte) {
+		r.Record(time.Now(), msgType, data)
+	})
+	c.OnParseError(func(msgType string, data []byte, _ error) {
+		// Messages with a valid envelope were already recorded by OnMessage.
+		if msgType == "" {
+			r.Record(time.Now(), "", data)
+		}
+	})
+}
+
+// Record writes one message. Errors are logged rather than returned so a
+// full disk never interrupts ingestion.
+func (r *Recorder) Record(received time.Time, msgType string, data []byte) {
+	m := recordedMessage{Received: received.UTC(), Type: msgType}
+	if json.Valid(data) {
+		m.Data = data
+	} else {
+		m.Raw = string(data)
+	}
+	line, err := json.Marshal(m)
+	if err != nil {
+		slog.Error("recording failed", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			slog.Error("recording rotation failed", "error", err)
+			return
+		}
+	}
+	n, err := r.buf.Write(line)
+	r.size += int64(n)
+	if err == nil {
+		// Flush per message so a crash loses nothing; messages arrive at
+		// most every few seconds.
+		err = r.buf.Flush()
+	}
+	if err != nil {
+		slog.Error("recording failed", "error", err)
+	}
+}
+
+// rotate shifts path.N-1 to path.N, ..., path to path.1 and reopens path.
+func (r *Recorder) rotate() error {
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	if r.maxFiles > 0 {
+		for i := r.maxFiles - 1; i >= 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Close flushes and closes the recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.buf.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	return err
+}
+
+// Replay reads a recording and passes each message to dispatch, keeping the
+// original spacing divided by speed. A speed of 0 replays without delay.
+// It returns the number of messages replayed.
+func Replay(ctx context.Context, rd io.Reader, speed float64, dispatch func([]byte)) (int, error) {
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var prev time.Time
+	n := 0
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var m recordedMessage
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if speed > 0 && !prev.IsZero() && m.Received.After(prev) {
+			wait := time.Duration(float64(m.Received.Sub(prev)) / speed)
+			if err := sleepContext(ctx, wait); err != nil {
+				return n, err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		prev = m.Received
+
+		if m.Data != nil {
+			dispatch(m.Data)
+		} else {
+			dispatch([]byte(m.Raw))
+		}
+		n++
+	}
+	return n, sc.Err()
+}
+
+// ReplayFiles replays recordings in order, for example path.2 path.1 path.
+func ReplayFiles(ctx context.Context, paths []string, speed float64, dispatch func([]byte)) (int, error) {
+	total := 0
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return total, err
+		}
+		n, err := Replay(ctx, f, speed, dispatch)
+		_ = f.Close()
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", path, err)
+		}
+		slog.Info("replayed recording", "path", path, "messages", n)
+	}
+	return total, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder_WritesJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.jsonl")
+	r, err := NewRecorder(path, 1<<20, 2)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	at := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	r.Record(at, "obs_st", []byte(`{"type":"obs_st","obs":[]}`))
+	r.Record(at.Add(time.Second), "", []byte("not json"))
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	want := `{"received":"2023-11-14T22:13:20Z","type":"obs_st","data":{"type":"obs_st","obs":[]}}`
+	if lines[0] != want {
+		t.Errorf("line 1 = %s\nwant     %s", lines[0], want)
+	}
+	var m recordedMessage
+	if err := json.Unmarshal([]byte(lines[1]), &m); err != nil || m.Raw != "not json" || m.Data != nil {
+		t.Errorf("invalid frame recorded as %s", lines[1])
+	}
+}
+
+func TestRecorder_Rotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rec.jsonl")
+	r, err := NewRecorder(path, 200, 2)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	msg := []byte(`{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5]]}`)
+	for i := 0; i < 10; i++ {
+		r.Record(time.Unix(1700000000+int64(i), 0), "obs_st", msg)
+	}
+	_ = r.Close()
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "rec.jsonl,rec.jsonl.1,rec.jsonl.2" {
+		t.Errorf("files = %v, want current plus 2 rotated", names)
+	}
+	for _, name := range names {
+		info, _ := os.Stat(filepath.Join(dir, name))
+		if info.Size() > 200 {
+			t.Errorf("%s is %d bytes, want at most 200", name, info.Size())
+		}
+	}
+
+	// The newest message is in the current file.
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "22:13:29Z") {
+		t.Errorf("current file lacks the last message:\n%s", data)
+	}
+}
+
+func TestRecorder_AttachRecordsClientMessages(t *testing.T) {
+	srv := mockWSServer(t, []string{
+		`{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,60]]}`,
+		`garbage`,
+	})
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "rec.jsonl")
+	r, err := NewRecorder(path, 1<<20, 0)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	client := NewClient("test-token", "12345", NewCollector("12345", "backyard"))
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	r.Attach(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = connectOnce(ctx, client)
+	_ = r.Close()
+
+	f, _ := os.Open(path)
+	defer func() { _ = f.Close() }()
+	var types []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var m recordedMessage
+		_ = json.Unmarshal(sc.Bytes(), &m)
+		types = append(types, m.Type+"|"+m.Raw)
+	}
+	// The mock server sends an ack before the test messages.
+	if strings.Join(types, ",") != "ack|,obs_st|,|garbage" {
+		t.Errorf("recorded %v", types)
+	}
+}
+
+func TestReplay_ThroughClientHandlers(t *testing.T) {
+	collector := NewCollector("12345", "backyard")
+	client := NewClient("", "12345", collector)
+	bus := NewEventBus()
+	client.SetEventBus(bus)
+	events, unsubscribe := bus.Subscribe(16)
+	defer unsubscribe()
+	var parseErrors int
+	client.OnParseError(func(string, []byte, error) { parseErrors++ })
+
+	n, err := ReplayFiles(context.Background(), []string{"testdata/recording.jsonl"}, 0, client.dispatch)
+	if err != nil {
+		t.Fatalf("ReplayFiles: %v", err)
+	}
+	if n != 7 {
+		t.Errorf("replayed %d messages, want 7", n)
+	}
+
+	st := collector.State()
+	if st.Observation.Timestamp != 1700000060 || st.Observation.AirTemperature != 22.8 {
+		t.Errorf("observation = %+v, want the last recorded one", st.Observation)
+	}
+	if st.RainStart != 1700000040 {
+		t.Errorf("RainStart = %v, want 1700000040", st.RainStart)
+	}
+	if parseErrors != 1 {
+		t.Errorf("parse errors = %d, want 1 for the truncated frame", parseErrors)
+	}
+	if e := <-events; e.Type != EventStrike {
+		t.Errorf("first event = %s, want strike", e.Type)
+	}
+}
+
+func TestReplay_Speed(t *testing.T) {
+	rec := `{"received":"2023-11-14T22:13:00Z","raw":"a"}
+{"received":"2023-11-14T22:13:01Z","raw":"b"}
+{"received":"2023-11-14T22:13:02Z","raw":"c"}
+`
+	var got []string
+	start := time.Now()
+	n, err := Replay(context.Background(), strings.NewReader(rec), 20, func(b []byte) { got = append(got, string(b)) })
+	elapsed := time.Since(start)
+	if err != nil || n != 3 || strings.Join(got, "") != "abc" {
+		t.Fatalf("Replay = %d, %v, %v", n, got, err)
+	}
+	// 2s of recording at 20x is 100ms.
+	if elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("replay took %v, want about 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Replay(ctx, strings.NewReader(rec), 1, func([]byte) {}); err == nil {
+		t.Error("cancelled replay should return an error")
+	}
+}
+
+func TestReplay_BadLine(t *testing.T) {
+	_, err := Replay(context.Background(), strings.NewReader("{}\nnot json\n"), 0, func([]byte) {})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("error = %v, want line 2", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// minSecretLen is the length below which a configured value is not treated
+// as a secret, so short placeholders aren't masked throughout the logs.
+const minSecretLen = 4
+
+// credentialPattern matches tokens in URLs and Authorization headers, so
+// credentials that were never configured, such as ones echoed back by a
+// server, are masked as well.
+var credentialPattern = regexp.MustCompile(`(?i)(token=|bearer\s+)[^\s&"',;]+`)
+
+// secretSet holds the secrets the log handler masks. Secrets are only ever
+// added, so a credential that was rotated out stays masked.
+type secretSet struct {
+	mu     sync.RWMutex
+	values map[string]bool
+}
+
+// logSecrets is masked in every log record; see redactHandler.
+var logSecrets secretSet
+
+// Add registers secrets to be masked. Empty and short values are ignored.
+func (s *secretSet) Add(secrets ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range secrets {
+		if len(v) < minSecretLen {
+			continue
+		}
+		if s.values == nil {
+			s.values = make(map[string]bool)
+		}
+		s.values[v] = true
+	}
+}
+
+// Redact replaces every registered secret and credential-looking token in
+// str with [REDACTED].
+func (s *secretSet) Redact(str string) string {
+	s.mu.RLock()
+	for v := range s.values {
+		str = strings.ReplaceAll(str, v, redacted)
+	}
+	s.mu.RUnlock()
+	return credentialPattern.ReplaceAllString(str, "${1}"+redacted)
+}
+
+// redactHandler masks secrets in the message and string-like attributes of
+// every record before passing it on, so no log path can leak a credential.
+type redactHandler struct {
+	next    slog.Handler
+	secrets *secretSet
+}
+
+func newRedactHandler(next slog.Handler, secrets *secretSet) *redactHandler {
+	return &redactHandler{next: next, secrets: secrets}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.secrets.Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = h.redactAttr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(redactedAttrs), secrets: h.secrets}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), secrets: h.secrets}
+}
+
+// redactAttr masks secrets in a, descending into groups. Values other than
+// strings are left as they are unless their formatted form contains a
+// secret, in which case they are replaced by the redacted string.
+func (h *redactHandler) redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.secrets.Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		attrs := make([]any, len(group))
+		for i, ga := range group {
+			attrs[i] = h.redactAttr(ga)
+		}
+		return slog.Group(a.Key, attrs...)
+	case slog.KindAny:
+		var s string
+		if err, ok := v.Any().(error); ok {
+			s = err.Error()
+		} else {
+			s = fmt.Sprint(v.Any())
+		}
+		if r := h.secrets.Redact(s); r != s {
+			return slog.String(a.Key, r)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSecretSet_Redact(t *testing.T) {
+	var s secretSet
+	s.Add("abcd1234", "-1", "")
+	tests := []struct{ in, want string }{
+		{"token abcd1234 rejected", "token [REDACTED] rejected"},
+		{"passcode -1", "passcode -1"},
+		{"GET /swd/data?token=unknown-secret&x=1", "GET /swd/data?token=[REDACTED]&x=1"},
+		{"Authorization: Bearer other-secret", "Authorization: Bearer [REDACTED]"},
+		{"nothing to see", "nothing to see"},
+	}
+	for _, tt := range tests {
+		if got := s.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// Rotated secrets stay masked.
+	s.Add("new-secret")
+	if got := s.Redact("abcd1234 new-secret"); got != "[REDACTED] [REDACTED]" {
+		t.Errorf("after rotation: %q", got)
+	}
+}
+
+func TestRedactHandler(t *testing.T) {
+	var s secretSet
+	s.Add("hunter22")
+	var buf bytes.Buffer
+	logger := slog.New(newRedactHandler(slog.NewJSONHandler(&buf, nil), &s))
+
+	logger.With("url", "wss://host/?token=hunter22").WithGroup("req").Info("using hunter22",
+		"error", errors.New("dial failed: hunter22"),
+		"count", 3,
+		"list", []string{"a", "hunter22"},
+		slog.Group("auth", "token", "hunter22"),
+	)
+	out := buf.String()
+	if strings.Contains(out, "hunter22") {
+		t.Errorf("secret leaked: %s", out)
+	}
+	for _, want := range []string{`"msg":"using [REDACTED]"`, `"count":3`, `"token":"[REDACTED]"`, `"error":"dial failed: [REDACTED]"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %s missing %s", out, want)
+		}
+	}
+
+	// Values without secrets keep their type.
+	buf.Reset()
+	logger.Info("ok", "changed", []string{"log.format"})
+	if !strings.Contains(buf.String(), `"changed":["log.format"]`) {
+		t.Errorf("non-secret value altered: %s", buf.String())
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadable lists the settings a reload applies to the running exporter.
+// Other changes are logged and take effect at the next restart.
+var reloadable = map[string]bool{
+	"tempest.token":         true,
+	"tempest.token_file":    true,
+	"tempest.device_id":     true,
+	"tempest.station_id":    true,
+	"tempest.station_name":  true,
+	"tempest.rapid_wind":    true,
+	"log.format":            true,
+	"reload.watch_interval": true,
+}
+
+// Reloader reloads the configuration on SIGHUP or when a watched file
+// changes, and passes valid new configurations to apply.
+type Reloader struct {
+	load  func() (*Config, error)
+	apply func(*Config)
+
+	mu      sync.Mutex
+	current *Config
+	sums    map[string][sha256.Size]byte
+}
+
+// NewReloader creates a reloader for the running configuration cfg. load
+// builds a new configuration the same way cfg was built.
+func NewReloader(cfg *Config, load func() (*Config, error), apply func(*Config)) *Reloader {
+	r := &Reloader{load: load, apply: apply, current: cfg}
+	r.sums = fileSums(cfg)
+	return r
+}
+
+// watchedFiles returns the files whose changes trigger a reload: the config
+// file, the secret files and the OAuth token store.
+func watchedFiles(cfg *Config) []string {
+	candidates := []string{cfg.source, cfg.OAuth.TokenPath}
+	for _, f := range cfg.secretFiles() {
+		candidates = append(candidates, *f.path)
+	}
+	var files []string
+	for _, f := range candidates {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// fileSums hashes the watched files' contents. Unreadable files are left
+// out, so they count as changed once readable again.
+func fileSums(cfg *Config) map[string][sha256.Size]byte {
+	sums := make(map[string][sha256.Size]byte)
+	for _, f := range watchedFiles(cfg) {
+		if data, err := os.ReadFile(f); err == nil {
+			sums[f] = sha256.Sum256(data)
+		}
+	}
+	return sums
+}
+
+// changedSettings returns the keys of the settings that differ.
+func changedSettings(old, cur *Config) []string {
+	oldValues, curValues := old.values(), cur.values()
+	var changed []string
+	for _, s := range settings {
+		if oldValues[s.key].String() != curValues[s.key].String() {
+			changed = append(changed, s.key)
+		}
+	}
+	return changed
+}
+
+// Reload loads and validates the configuration and applies it if anything
+// changed. An invalid configuration is rejected and the running one kept.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	// Record the files as seen even if invalid, so a bad edit is reported
+	// once rather than on every check.
+	r.sums = fileSums(r.current)
+	if err != nil {
+		return fmt.Errorf("keeping the running configuration: %w", err)
+	}
+	r.sums = fileSums(cfg)
+
+	changed := changedSettings(r.current, cfg)
+	if len(changed) == 0 {
+		slog.Info("configuration reloaded, nothing changed")
+		return nil
+	}
+	var restart []string
+	for _, key := range changed {
+		if !reloadable[key] {
+			restart = append(restart, key)
+		}
+	}
+	r.apply(cfg)
+	r.current = cfg
+	slog.Info("configuration reloaded", "changed", changed)
+	if len(restart) > 0 {
+		slog.Warn("some changed settings take effect only after a restart", "settings", restart)
+	}
+	return nil
+}
+
+// filesChanged reports whether any watched file's contents changed.
+func (r *Reloader) filesChanged() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sums := fileSums(r.current)
+	if len(sums) != len(r.sums) {
+		return true
+	}
+	for f, sum := range sums {
+		if r.sums[f] != sum {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) watchInterval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current.Reload.WatchInterval
+}
+
+// Run reloads on every value from hup and, if the watch interval is set,
+// whenever a watched file changes. It blocks until the context is cancelled.
+func (r *Reloader) Run(ctx context.Context, hup <-chan os.Signal) {
+	for {
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if d := r.watchInterval(); d > 0 {
+			timer = time.NewTimer(d)
+			tick = timer.C
+		}
+
+		reason := ""
+		select {
+		case <-ctx.Done():
+		case <-hup:
+			reason = "SIGHUP"
+		case <-tick:
+			if r.filesChanged() {
+				reason = "file changed"
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if reason == "" {
+			continue
+		}
+		slog.Info("reloading configuration", "reason", reason)
+		if err := r.Reload(); err != nil {
+			slog.Error("configuration reload failed", "error", err)
+		}
+	}
+}
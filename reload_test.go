@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reloadFixture writes a config file and token file and returns a reloader
+// whose applied configurations are sent on the returned channel.
+func reloadFixture(t *testing.T, extra string) (r *Reloader, configPath, tokenPath string, applied chan *Config) {
+	t.Helper()
+	dir := t.TempDir()
+	tokenPath = filepath.Join(dir, "token")
+	configPath = filepath.Join(dir, "config.yaml")
+	writeFile(t, tokenPath, "token-1\n")
+	writeFile(t, configPath, "tempest:\n  token_file: "+tokenPath+"\n  device_id: \"1\"\n  station_id: \"2\"\n"+extra)
+
+	load := func() (*Config, error) { return LoadConfig(configPath, noEnv, nil) }
+	cfg, err := load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Tempest.Token != "token-1" {
+		t.Fatalf("token = %q, want the token file's contents", cfg.Tempest.Token)
+	}
+	applied = make(chan *Config, 4)
+	return NewReloader(cfg, load, func(c *Config) { applied <- c }), configPath, tokenPath, applied
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader_TokenFileChange(t *testing.T) {
+	r, _, tokenPath, applied := reloadFixture(t, "")
+	if r.filesChanged() {
+		t.Fatal("files reported changed before any change")
+	}
+
+	writeFile(t, tokenPath, "token-2\n")
+	if !r.filesChanged() {
+		t.Fatal("token file change not detected")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	select {
+	case c := <-applied:
+		if c.Tempest.Token != "token-2" {
+			t.Errorf("applied token = %q, want token-2", c.Tempest.Token)
+		}
+	default:
+		t.Fatal("new configuration not applied")
+	}
+	if r.filesChanged() {
+		t.Error("files still reported changed after reload")
+	}
+
+	// Reloading unchanged files applies nothing.
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Error("unchanged configuration was applied")
+	}
+}
+
+func TestReloader_InvalidConfigKept(t *testing.T) {
+	r, configPath, _, applied := reloadFixture(t, "")
+	writeFile(t, configPath, "tempest:\n  device_id: abc\n")
+
+	err := r.Reload()
+	if err == nil || !strings.Contains(err.Error(), "tempest.device_id") {
+		t.Fatalf("Reload error = %v, want a validation error", err)
+	}
+	if len(applied) != 0 {
+		t.Error("invalid configuration was applied")
+	}
+	if r.current.Tempest.DeviceID != "1" {
+		t.Errorf("running device_id = %q, want 1", r.current.Tempest.DeviceID)
+	}
+	if r.filesChanged() {
+		t.Error("a rejected edit should not be retried until the file changes again")
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	old := validConfig()
+	cur := validConfig()
+	cur.Tempest.Token = "other"
+	cur.Server.ListenAddr = ":9999"
+	lat := 1.0
+	cur.CWOP.Latitude = &lat
+
+	got := changedSettings(old, cur)
+	want := []string{"tempest.token", "server.listen_addr", "cwop.latitude"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changed = %v, want %v", got, want)
+	}
+	if reloadable["server.listen_addr"] || !reloadable["tempest.token"] {
+		t.Error("unexpected reloadable settings")
+	}
+}
+
+func TestReloader_Run(t *testing.T) {
+	r, configPath, _, applied := reloadFixture(t, "reload:\n  watch_interval: 10ms\n")
+	hup := make(chan os.Signal, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.Run(ctx, hup)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	wait := func(what string) *Config {
+		t.Helper()
+		select {
+		case c := <-applied:
+			return c
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no reload after %s", what)
+			return nil
+		}
+	}
+
+	// A file change is picked up by the watcher.
+	data, _ := os.ReadFile(configPath)
+	writeFile(t, configPath, strings.Replace(string(data), `station_id: "2"`, `station_id: "3"`, 1))
+	if c := wait("file change"); c.Tempest.StationID != "3" {
+		t.Errorf("station_id = %q, want 3", c.Tempest.StationID)
+	}
+
+	// SIGHUP reloads even with the watcher off.
+	data, _ = os.ReadFile(configPath)
+	writeFile(t, configPath, strings.Replace(string(data), "watch_interval: 10ms", "watch_interval: 0s", 1))
+	wait("disabling the watcher")
+	data, _ = os.ReadFile(configPath)
+	writeFile(t, configPath, strings.Replace(string(data), `device_id: "1"`, `device_id: "4"`, 1))
+	select {
+	case <-applied:
+		t.Fatal("reloaded with the watcher disabled")
+	case <-time.After(100 * time.Millisecond):
+	}
+	hup <- os.Interrupt
+	if c := wait("SIGHUP"); c.Tempest.DeviceID != "4" {
+		t.Errorf("device_id = %q, want 4", c.Tempest.DeviceID)
+	}
+}
+
+func TestWatchedFiles(t *testing.T) {
+	c := defaultConfig()
+	c.source = "config.yaml"
+	c.CWOP.PasscodeFile = "passcode"
+	c.OAuth.TokenPath = "oauth.json"
+	got := watchedFiles(c)
+	want := []string{"config.yaml", "oauth.json", "passcode"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("watchedFiles = %v, want %v", got, want)
+	}
+}
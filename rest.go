@@ -3,27 +3,34 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
 )
 
-const defaultBaseURL = "https://swd.weatherflow.com/swd/rest"
+const defaultBaseURL = weatherflow.DefaultBaseURL
 
 // maxResponseBytes is the maximum size of a REST API response body (1 MB).
 const maxResponseBytes = 1 << 20
 
 // RESTClient polls the Tempest REST API as a fallback when the WebSocket is disconnected.
+// Every request it sends draws on budget.
 type RESTClient struct {
 	httpClient *http.Client
-	token      string
-	stationID  string
 	baseURL    string
 	collector  *Collector
+	budget     *requestBudget
+
+	// mu guards token and stationID, which SetCredentials may change at runtime.
+	mu        sync.RWMutex
+	token     string
+	stationID string
 }
 
 // NewRESTClient creates a new REST API client.
@@ -41,12 +48,61 @@ func NewRESTClient(token, stationID string, collector *Collector) *RESTClient {
 		stationID: stationID,
 		baseURL:   defaultBaseURL,
 		collector: collector,
+		budget:    newRequestBudget(defaultRESTRequestsPerMinute, defaultRESTBurst),
+	}
+}
+
+// SetCredentials changes the token and station used by subsequent requests.
+func (r *RESTClient) SetCredentials(token, stationID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.token, r.stationID = token, stationID
+}
+
+func (r *RESTClient) credentials() (token, stationID string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.token, r.stationID
+}
+
+// api returns a weatherflow client for the current base URL and token whose
+// requests draw on the budget.
+func (r *RESTClient) api(token string) *weatherflow.Client {
+	return weatherflow.NewClient(token,
+		weatherflow.WithBaseURL(r.baseURL),
+		weatherflow.WithHTTPClient(r.httpClient),
+		weatherflow.WithLimiter(restLimiter{r}),
+	)
+}
+
+// restLimiter paces weatherflow requests with the client's budget. A 429
+// pauses the budget for every caller.
+type restLimiter struct{ r *RESTClient }
+
+func (l restLimiter) Wait(ctx context.Context) error {
+	waited, err := l.r.budget.Wait(ctx)
+	if waited {
+		l.r.throttled("budget")
+	}
+	return err
+}
+
+func (l restLimiter) Done(statusCode int, retryAfter time.Duration) {
+	switch statusCode {
+	case http.StatusOK:
+		l.r.budget.Succeeded()
+	case http.StatusTooManyRequests:
+		pause := l.r.budget.RateLimited(retryAfter)
+		l.r.throttled("rate_limited")
+		slog.Warn("REST API rate limit reached, pausing requests", "pause", pause.Round(time.Second))
 	}
 }
 
-// restResponse is the top-level REST API response for station observations.
-type restResponse struct {
-	Obs []restObs `json:"obs"`
+// throttled counts a request held back for reason, if there is a collector.
+func (r *RESTClient) throttled(reason string) {
+	if r.collector != nil {
+		r.collector.IncrRESTThrottled(reason)
+	}
 }
 
 // restObs is a single observation from the REST API.
@@ -72,38 +128,145 @@ type restObs struct {
 
 // FetchObservation retrieves the latest observation from the REST API.
 func (r *RESTClient) FetchObservation(ctx context.Context) (*Observation, error) {
-	url := fmt.Sprintf("%s/observations/station/%s?token=%s", r.baseURL, r.stationID, r.token)
+	token, stationID := r.credentials()
+	id, err := strconv.Atoi(stationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid station ID %q", stationID)
+	}
+
+	result, err := r.api(token).StationObservation(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching observations: %w", err)
+	}
+
+	obs := stationObsToObservation(result.Obs[0])
+	return &obs, nil
+}
+
+// StationInfo is the subset of station metadata used by the exporter.
+type StationInfo struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+	Elevation float64 // meters above sea level
+	Timezone  string
+}
+
+// FetchStation retrieves station metadata (name, position, elevation) from the REST API.
+func (r *RESTClient) FetchStation(ctx context.Context) (*StationInfo, error) {
+	token, stationID := r.credentials()
+	id, err := strconv.Atoi(stationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid station ID %q", stationID)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	st, err := r.api(token).Station(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("fetching station: %w", err)
+	}
+	return &StationInfo{
+		Name:      st.Name,
+		Latitude:  st.Latitude,
+		Longitude: st.Longitude,
+		Elevation: st.StationMeta.Elevation,
+		Timezone:  st.Timezone,
+	}, nil
+}
+
+// stationZone is the station's time zone, whose midnight resets the rain
+// since midnight reported by the JSON API, the dashboard and CWOP. It is
+// set from config or looked up once from the station's metadata.
+type stationZone struct {
+	lookup func(ctx context.Context) (*StationInfo, error)
+
+	mu  sync.Mutex
+	loc *time.Location // nil until resolved
+}
+
+// newStationZone returns loc, or when it is nil the zone lookup reports.
+func newStationZone(loc *time.Location, lookup func(ctx context.Context) (*StationInfo, error)) *stationZone {
+	return &stationZone{lookup: lookup, loc: loc}
+}
+
+// Resolve looks the zone up unless it is already known. A station without a
+// known zone resolves to the local one; a failed lookup returns an error
+// and is tried again on the next call.
+func (z *stationZone) Resolve(ctx context.Context) error {
+	z.mu.Lock()
+	known := z.loc != nil
+	z.mu.Unlock()
+	if known {
+		return nil
 	}
 
-	resp, err := r.httpClient.Do(req)
+	st, err := z.lookup(ctx)
 	if err != nil {
-		// Redact the token from HTTP client error messages (may contain the URL).
-		return nil, fmt.Errorf("fetching observations: %s", redactToken(err.Error(), r.token))
+		return fmt.Errorf("resolving station time zone: %w", err)
+	}
+	z.setFrom(st)
+	return nil
+}
+
+// setFrom sets the zone from station metadata fetched for another purpose,
+// unless it is already known.
+func (z *stationZone) setFrom(st *StationInfo) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.loc != nil {
+		return
+	}
+	loc, err := time.LoadLocation(st.Timezone)
+	if err != nil || st.Timezone == "" {
+		slog.Warn("station time zone unknown, using the local time zone", "timezone", st.Timezone, "local", time.Local.String())
+		loc = time.Local
+	}
+	z.loc = loc
+	slog.Info("station time zone resolved", "timezone", loc.String())
+}
+
+// Location returns the station's zone, or the local zone until Resolve has
+// succeeded. A nil zone is the local zone.
+func (z *stationZone) Location() *time.Location {
+	if z == nil {
+		return time.Local
 	}
-	defer func() { _ = resp.Body.Close() }()
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.loc == nil {
+		return time.Local
+	}
+	return z.loc
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+// FetchDeviceObservations retrieves a device's obs_st history between start
+// and end (Unix seconds, inclusive), oldest first. Rows that fail to parse are skipped.
+func (r *RESTClient) FetchDeviceObservations(ctx context.Context, deviceID string, start, end int64) ([]Observation, error) {
+	token, _ := r.credentials()
+	id, err := strconv.Atoi(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device ID %q", deviceID)
 	}
 
-	// Limit response body size to prevent memory exhaustion from oversized responses.
-	limitedBody := io.LimitReader(resp.Body, maxResponseBytes)
-	var result restResponse
-	if err := json.NewDecoder(limitedBody).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
+	out, err := r.api(token).DeviceObservations(ctx, id, time.Unix(start, 0), time.Unix(end, 0))
+	if err != nil {
+		return nil, fmt.Errorf("fetching device observations: %w", err)
 	}
+	return out, nil
+}
 
-	if len(result.Obs) == 0 {
-		return nil, fmt.Errorf("no observations in response")
+// FetchForecast retrieves the station's better_forecast in metric units.
+func (r *RESTClient) FetchForecast(ctx context.Context) (*weatherflow.Forecast, error) {
+	token, stationID := r.credentials()
+	id, err := strconv.Atoi(stationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid station ID %q", stationID)
 	}
 
-	obs := restObsToObservation(result.Obs[0])
-	return &obs, nil
+	f, err := r.api(token).BetterForecast(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching forecast: %w", err)
+	}
+	return f, nil
 }
 
 func deref(p *float64) float64 {
@@ -113,27 +276,29 @@ func deref(p *float64) float64 {
 	return *p
 }
 
-func restObsToObservation(ro restObs) Observation {
+// stationObsToObservation converts a named-field station observation;
+// missing fields become 0.
+func stationObsToObservation(so weatherflow.StationObservation) Observation {
 	obs := Observation{
-		WindLull:               deref(ro.WindLull),
-		WindAvg:                deref(ro.WindAvg),
-		WindGust:               deref(ro.WindGust),
-		WindDirection:          deref(ro.WindDirection),
-		StationPressure:        deref(ro.StationPressure),
-		AirTemperature:         deref(ro.AirTemperature),
-		RelativeHumidity:       deref(ro.RelativeHumidity),
-		Illuminance:            deref(ro.Illuminance),
-		UV:                     deref(ro.UV),
-		SolarRadiation:         deref(ro.SolarRadiation),
-		RainAccumulated:        deref(ro.RainAccumulated),
-		PrecipitationType:      deref(ro.PrecipitationType),
-		LightningStrikeAvgDist: deref(ro.LightningStrikeAvgDist),
-		LightningStrikeCount:   deref(ro.LightningStrikeCount),
-		Battery:                deref(ro.Battery),
-		ReportInterval:         deref(ro.ReportInterval),
-	}
-	if ro.Timestamp != nil {
-		ts := *ro.Timestamp
+		WindLull:               deref(so.WindLull),
+		WindAvg:                deref(so.WindAvg),
+		WindGust:               deref(so.WindGust),
+		WindDirection:          deref(so.WindDirection),
+		StationPressure:        deref(so.StationPressure),
+		AirTemperature:         deref(so.AirTemperature),
+		RelativeHumidity:       deref(so.RelativeHumidity),
+		Illuminance:            deref(so.Illuminance),
+		UV:                     deref(so.UV),
+		SolarRadiation:         deref(so.SolarRadiation),
+		RainAccumulated:        deref(so.RainAccumulated),
+		PrecipitationType:      deref(so.PrecipitationType),
+		LightningStrikeAvgDist: deref(so.LightningStrikeAvgDist),
+		LightningStrikeCount:   deref(so.LightningStrikeCount),
+		Battery:                deref(so.Battery),
+		ReportInterval:         deref(so.ReportInterval),
+	}
+	if so.Timestamp != nil {
+		ts := *so.Timestamp
 		if ts >= 0 && ts <= float64(math.MaxInt64) {
 			obs.Timestamp = int64(ts)
 		}
@@ -142,7 +307,8 @@ func restObsToObservation(ro restObs) Observation {
 }
 
 // RunFallback polls the REST API when the WebSocket has been disconnected
-// for longer than the fallback threshold. It blocks until context cancellation.
+// for longer than the fallback threshold, or at once while the WebSocket
+// circuit breaker is open. It blocks until context cancellation.
 func (r *RESTClient) RunFallback(ctx context.Context, disconnectThreshold time.Duration, pollInterval time.Duration) {
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
@@ -163,10 +329,18 @@ func (r *RESTClient) RunFallback(ctx context.Context, disconnectThreshold time.D
 			now := time.Now()
 			if disconnectedSince == nil {
 				disconnectedSince = &now
+			}
+
+			// An open circuit breaker means the WebSocket keeps failing;
+			// don't wait out the threshold.
+			if time.Since(*disconnectedSince) < disconnectThreshold && !r.collector.CircuitOpen() {
 				continue
 			}
 
-			if time.Since(*disconnectedSince) < disconnectThreshold {
+			// The REST API would reject the same token; polling it would
+			// only use up the rate limit.
+			if class, _ := r.collector.WebSocketFailure(); class == errAuth.String() {
+				slog.Warn("REST fallback paused while the token is rejected")
 				continue
 			}
 
@@ -178,7 +352,7 @@ func (r *RESTClient) RunFallback(ctx context.Context, disconnectThreshold time.D
 				continue
 			}
 
-			r.collector.UpdateObservation(*obs)
+			r.collector.UpdateObservationFrom(*obs, SourceREST)
 			slog.Info("REST fallback: observation updated",
 				"air_temp_c", obs.AirTemperature,
 			)
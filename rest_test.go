@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 const fixtureJSON = `{
@@ -36,8 +41,11 @@ func TestRESTClient_FetchObservation(t *testing.T) {
 		if r.URL.Path != "/observations/station/99999" {
 			t.Errorf("unexpected path: %s", r.URL.Path)
 		}
-		if r.URL.Query().Get("token") != "test-token" {
-			t.Errorf("unexpected token: %s", r.URL.Query().Get("token"))
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q, want Bearer test-token", got)
+		}
+		if r.URL.RawQuery != "" {
+			t.Errorf("unexpected query, the token belongs in the header: %s", r.URL.RawQuery)
 		}
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write([]byte(fixtureJSON))
@@ -239,6 +247,103 @@ func TestRunFallback_SkipsWhenConnected(t *testing.T) {
 	}
 }
 
+func TestRunFallback_CircuitOpenSkipsThreshold(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(fixtureJSON))
+	}))
+	defer srv.Close()
+
+	c := NewCollector("99999", "test")
+	c.SetCircuitOpen(true)
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		rc.RunFallback(ctx, time.Hour, 50*time.Millisecond)
+		close(done)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	if requests.Load() == 0 {
+		t.Error("RunFallback did not poll while the circuit breaker was open")
+	}
+}
+
+func TestRESTClient_RateLimitPausesEveryCaller(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := NewCollector("99999", "test")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+	c.SetRESTBudget(rc.budget)
+
+	_, err := rc.FetchObservation(context.Background())
+	var se *weatherflow.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("error = %v, want a 429 StatusError", err)
+	}
+
+	// The station lookup shares the budget and waits out Retry-After.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := rc.FetchStation(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FetchStation during the pause: error = %v, want the context deadline", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests sent, want 1", n)
+	}
+
+	expected := `
+# HELP tempest_rest_budget_remaining REST requests that may be sent now without waiting for the shared rate limit budget
+# TYPE tempest_rest_budget_remaining gauge
+tempest_rest_budget_remaining{station_id="99999",station_name="test"} 0
+# HELP tempest_rest_throttled_requests_total Total REST requests held back, by reason: budget (waited for the local budget) or rate_limited (answered with 429)
+# TYPE tempest_rest_throttled_requests_total counter
+tempest_rest_throttled_requests_total{reason="budget",station_id="99999",station_name="test"} 1
+tempest_rest_throttled_requests_total{reason="rate_limited",station_id="99999",station_name="test"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"tempest_rest_budget_remaining", "tempest_rest_throttled_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRESTClient_BudgetSpacesRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(fixtureJSON))
+	}))
+	defer srv.Close()
+
+	rc := NewRESTClient("test-token", "99999", nil)
+	rc.baseURL = srv.URL
+	rc.budget = newRequestBudget(600, 1) // one request per 100ms
+
+	start := time.Now()
+	for range 3 {
+		if _, err := rc.FetchObservation(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 2 intervals of 100ms", elapsed)
+	}
+}
+
 func TestRunFallback_CancelsCleanly(t *testing.T) {
 	c := NewCollector("99999", "test")
 	rc := NewRESTClient("test-token", "99999", c)
@@ -277,3 +382,121 @@ func TestIsConnected(t *testing.T) {
 		t.Error("isConnected should be false after SetConnected(false)")
 	}
 }
+
+func TestRESTClient_FetchStation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stations/99999" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"stations":[{"name":"Backyard","latitude":40.7608,"longitude":-111.891,
+			"timezone":"America/Denver","station_meta":{"elevation":1288.5}}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewCollector("99999", "test")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+
+	st, err := rc.FetchStation(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.Latitude != 40.7608 || st.Longitude != -111.891 {
+		t.Errorf("position = %v,%v, want 40.7608,-111.891", st.Latitude, st.Longitude)
+	}
+	if st.Elevation != 1288.5 {
+		t.Errorf("Elevation = %v, want 1288.5", st.Elevation)
+	}
+	if st.Timezone != "America/Denver" {
+		t.Errorf("Timezone = %q, want America/Denver", st.Timezone)
+	}
+}
+
+func TestRESTClient_SetCredentials(t *testing.T) {
+	var gotPath, gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotToken = r.URL.Path, r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"stations":[{"name":"Roof"}]}`))
+	}))
+	defer srv.Close()
+
+	rc := NewRESTClient("old-token", "99999", nil)
+	rc.baseURL = srv.URL
+	rc.SetCredentials("new-token", "11111")
+
+	if _, err := rc.FetchStation(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotPath != "/stations/11111" || gotToken != "Bearer new-token" {
+		t.Errorf("request = %s with token %q, want the new station and token", gotPath, gotToken)
+	}
+}
+
+func TestRESTClient_FetchStation_Empty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stations":[]}`))
+	}))
+	defer srv.Close()
+
+	c := NewCollector("99999", "test")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+
+	if _, err := rc.FetchStation(context.Background()); err == nil {
+		t.Fatal("expected error for empty stations")
+	}
+}
+
+func TestRESTClient_FetchDeviceObservations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/observations/device/54321" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("time_start") != "1700000000" || q.Get("time_end") != "1700000120" {
+			t.Errorf("unexpected range: %s-%s", q.Get("time_start"), q.Get("time_end"))
+		}
+		_, _ = w.Write([]byte(`{"obs":[
+			[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,1,null,null,0,0],
+			["bad"],
+			[1700000060,0.5,1.2,2.3,180,3,1013.25,23.0,65,50000,3.5,300,0,1,10,2,2.65,1,null,null,0,0]
+		]}`))
+	}))
+	defer srv.Close()
+
+	c := NewCollector("99999", "test")
+	rc := NewRESTClient("test-token", "99999", c)
+	rc.baseURL = srv.URL
+
+	got, err := rc.FetchDeviceObservations(context.Background(), "54321", 1700000000, 1700000120)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d observations, want 2 (bad row skipped)", len(got))
+	}
+	if got[1].Timestamp != 1700000060 || got[1].AirTemperature != 23.0 {
+		t.Errorf("second observation = %+v", got[1])
+	}
+}
+
+func TestRESTClient_FetchDeviceObservations_RateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	rc := NewRESTClient("test-token", "99999", nil)
+	rc.baseURL = srv.URL
+
+	_, err := rc.FetchDeviceObservations(context.Background(), "54321", 0, 60)
+	var se *weatherflow.StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("error = %v, want *weatherflow.StatusError", err)
+	}
+	if !se.Temporary() || se.RetryAfter != 30*time.Second {
+		t.Errorf("StatusError = %+v, want temporary with 30s Retry-After", se)
+	}
+}
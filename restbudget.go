@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+const (
+	// defaultRESTRequestsPerMinute is WeatherFlow's per-account REST limit.
+	defaultRESTRequestsPerMinute = 100
+	// defaultRESTBurst is how many requests may be sent back to back after
+	// an idle period. Keeping it well below the per-minute rate stops a
+	// burst plus a minute of refills from exceeding the limit.
+	defaultRESTBurst = 10
+	// rateLimitBackoff is the ceiling of the first pause after a 429 without
+	// Retry-After; it doubles per consecutive 429 up to maxRateLimitPause.
+	rateLimitBackoff  = 30 * time.Second
+	maxRateLimitPause = 5 * time.Minute
+)
+
+// requestBudget is a token bucket shared by every REST request the exporter
+// makes, so fallback polling, station lookups and backfill together stay
+// within the account's rate limit. A 429 response pauses every caller.
+type requestBudget struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	// pausedUntil is set by a 429; no request is sent before it.
+	pausedUntil time.Time
+	backoff     *weatherflow.Backoff
+
+	// sleep waits for d or until ctx is done; replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newRequestBudget allows perMinute requests a minute, up to burst at once.
+// The bucket starts full.
+func newRequestBudget(perMinute, burst int) *requestBudget {
+	return &requestBudget{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+		backoff: weatherflow.NewBackoff(rateLimitBackoff, maxRateLimitPause),
+		sleep:   sleepContext,
+	}
+}
+
+// take takes a token at now if one is available and the budget isn't
+// paused. Otherwise it returns how long to wait before trying again.
+func (b *requestBudget) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if now.Before(b.pausedUntil) {
+		return b.pausedUntil.Sub(now)
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *requestBudget) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done. waited reports
+// whether the request was held back.
+func (b *requestBudget) Wait(ctx context.Context) (waited bool, err error) {
+	for {
+		d := b.take(time.Now())
+		if d == 0 {
+			return waited, nil
+		}
+		waited = true
+		if err := b.sleep(ctx, d); err != nil {
+			return waited, err
+		}
+	}
+}
+
+// RateLimited pauses every caller after a 429: for retryAfter if the server
+// gave one, otherwise for a jittered backoff that grows with consecutive
+// 429s. It returns the pause.
+func (b *requestBudget) RateLimited(retryAfter time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pause := retryAfter
+	if pause <= 0 {
+		pause = b.backoff.Next()
+	}
+	if until := time.Now().Add(pause); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	// The server counts differently; don't burst as soon as it relents.
+	b.tokens = 0
+	return pause
+}
+
+// Succeeded resets the 429 backoff after a request went through.
+func (b *requestBudget) Succeeded() {
+	b.mu.Lock()
+	b.backoff.Reset()
+	b.mu.Unlock()
+}
+
+// Remaining returns how many requests may be sent now without waiting.
+func (b *requestBudget) Remaining() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.refill(now)
+	if now.Before(b.pausedUntil) {
+		return 0
+	}
+	return b.tokens
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestBudget_Take(t *testing.T) {
+	b := newRequestBudget(60, 2)
+	now := b.last
+
+	for i := range 2 {
+		if d := b.take(now); d != 0 {
+			t.Fatalf("request %d of the burst waited %s", i+1, d)
+		}
+	}
+	if d := b.take(now); d != time.Second {
+		t.Errorf("after the burst: wait %s, want 1s at 60/min", d)
+	}
+	if d := b.take(now.Add(500 * time.Millisecond)); d != 500*time.Millisecond {
+		t.Errorf("half refilled: wait %s, want 500ms", d)
+	}
+	if d := b.take(now.Add(time.Second)); d != 0 {
+		t.Errorf("refilled: wait %s, want 0", d)
+	}
+	// The bucket never holds more than the burst.
+	later := now.Add(time.Hour)
+	for range 2 {
+		b.take(later)
+	}
+	if d := b.take(later); d == 0 {
+		t.Error("took more than the burst after an idle hour")
+	}
+}
+
+func TestRequestBudget_RateLimited(t *testing.T) {
+	b := newRequestBudget(100, 10)
+
+	if pause := b.RateLimited(30 * time.Second); pause != 30*time.Second {
+		t.Errorf("pause = %s, want Retry-After of 30s", pause)
+	}
+	if d := b.take(time.Now()); d < 29*time.Second || d > 30*time.Second {
+		t.Errorf("wait after 429 = %s, want about 30s", d)
+	}
+	if r := b.Remaining(); r != 0 {
+		t.Errorf("Remaining() = %g while paused, want 0", r)
+	}
+
+	// Without Retry-After the pause is jittered below a growing ceiling.
+	var ceilings []time.Duration
+	b.backoff.Rand = func(n int64) int64 {
+		ceilings = append(ceilings, time.Duration(n))
+		return n / 2
+	}
+	b.RateLimited(0)
+	b.RateLimited(0)
+	b.Succeeded()
+	b.RateLimited(0)
+	want := []time.Duration{rateLimitBackoff, 2 * rateLimitBackoff, rateLimitBackoff}
+	for i, w := range want {
+		if ceilings[i] != w {
+			t.Errorf("429 %d: ceiling %s, want %s", i+1, ceilings[i], w)
+		}
+	}
+}
+
+func TestRequestBudget_Wait(t *testing.T) {
+	b := newRequestBudget(60, 1)
+	var slept []time.Duration
+	b.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		b.mu.Lock()
+		b.tokens = 1
+		b.mu.Unlock()
+		return nil
+	}
+
+	if waited, err := b.Wait(context.Background()); waited || err != nil {
+		t.Fatalf("first Wait = %v, %v; want no wait", waited, err)
+	}
+	if waited, err := b.Wait(context.Background()); !waited || err != nil {
+		t.Fatalf("second Wait = %v, %v; want a wait", waited, err)
+	}
+	if len(slept) != 1 || slept[0] <= 0 || slept[0] > time.Second {
+		t.Errorf("slept %v, want one wait of up to 1s", slept)
+	}
+
+	b.sleep = sleepContext
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b.Wait(ctx); err == nil {
+		t.Error("Wait with an empty bucket and a cancelled context returned nil")
+	}
+}
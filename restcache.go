@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// restCacheSize is the number of recent observations kept for device history
+// queries: 24 hours at the Tempest's 1-minute report interval.
+const restCacheSize = 24 * 60
+
+// RESTCache serves WeatherFlow-compatible REST observation endpoints from the
+// exporter's own data, so local scripts don't spend the account's REST quota.
+type RESTCache struct {
+	collector *Collector
+	// history answers device history queries: the history store once
+	// UseStore is called, otherwise the in-memory ring.
+	history func(start, end int64) ([]Observation, error)
+
+	// mu guards the station and device, which SetStation may change, and
+	// the ring buffer.
+	mu          sync.RWMutex
+	stationID   string
+	stationName string
+	deviceID    string
+
+	recent []Observation // ring buffer, oldest at next once full
+	next   int
+	full   bool
+}
+
+// NewRESTCache creates the cache and subscribes it to the collector's observations.
+func NewRESTCache(collector *Collector, stationID, stationName, deviceID string) *RESTCache {
+	rc := &RESTCache{
+		collector:   collector,
+		stationID:   stationID,
+		stationName: stationName,
+		deviceID:    deviceID,
+		recent:      make([]Observation, restCacheSize),
+	}
+	rc.history = func(start, end int64) ([]Observation, error) {
+		return rc.Range(start, end), nil
+	}
+	collector.OnObservation(rc.add)
+	return rc
+}
+
+// UseStore answers device history queries from store, which keeps
+// observations across restarts and the minutes backfilled after a gap,
+// instead of the ring. It must be called before Register.
+func (rc *RESTCache) UseStore(store *HistoryStore) {
+	rc.history = store.Observations
+}
+
+// add appends an observation, ignoring repeats of the latest timestamp
+// (e.g. REST fallback re-polling an unchanged observation).
+func (rc *RESTCache) add(obs Observation) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if n := rc.len(); n > 0 && obs.Timestamp <= rc.at(n-1).Timestamp {
+		return
+	}
+	rc.recent[rc.next] = obs
+	rc.next = (rc.next + 1) % len(rc.recent)
+	if rc.next == 0 {
+		rc.full = true
+	}
+}
+
+// SetStation changes the station and device served. Cached observations are
+// dropped when the device changes.
+func (rc *RESTCache) SetStation(stationID, stationName, deviceID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if deviceID != rc.deviceID {
+		clear(rc.recent)
+		rc.next, rc.full = 0, false
+	}
+	rc.stationID, rc.stationName, rc.deviceID = stationID, stationName, deviceID
+}
+
+func (rc *RESTCache) ids() (stationID, stationName, deviceID string) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.stationID, rc.stationName, rc.deviceID
+}
+
+func (rc *RESTCache) len() int {
+	if rc.full {
+		return len(rc.recent)
+	}
+	return rc.next
+}
+
+// at returns the i-th oldest observation. Callers hold rc.mu.
+func (rc *RESTCache) at(i int) Observation {
+	if rc.full {
+		return rc.recent[(rc.next+i)%len(rc.recent)]
+	}
+	return rc.recent[i]
+}
+
+// Range returns cached observations with start <= Timestamp <= end, oldest first.
+func (rc *RESTCache) Range(start, end int64) []Observation {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	var out []Observation
+	for i := 0; i < rc.len(); i++ {
+		if obs := rc.at(i); obs.Timestamp >= start && obs.Timestamp <= end {
+			out = append(out, obs)
+		}
+	}
+	return out
+}
+
+// Register adds the cache endpoints to mux under the upstream /swd/rest paths.
+func (rc *RESTCache) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /swd/rest/observations/station/{id}", rc.handleStation)
+	mux.HandleFunc("GET /swd/rest/observations/device/{id}", rc.handleDevice)
+}
+
+// restStatus mirrors the status object included in every WeatherFlow REST response.
+type restStatus struct {
+	StatusCode    int    `json:"status_code"`
+	StatusMessage string `json:"status_message"`
+}
+
+var restStatusOK = restStatus{StatusCode: 0, StatusMessage: "SUCCESS"}
+
+// stationObs extends restObs with the derived fields the upstream API includes.
+type stationObs struct {
+	restObs
+	DewPoint  *float64 `json:"dew_point"`
+	FeelsLike *float64 `json:"feels_like"`
+}
+
+// stationObsResponse is the /observations/station/{id} response shape.
+type stationObsResponse struct {
+	StationID   int          `json:"station_id"`
+	StationName string       `json:"station_name"`
+	Obs         []stationObs `json:"obs"`
+	Status      restStatus   `json:"status"`
+}
+
+// deviceObsResponse is the /observations/device/{id} response shape.
+type deviceObsResponse struct {
+	DeviceID int          `json:"device_id"`
+	Type     string       `json:"type"`
+	Obs      [][]*float64 `json:"obs"`
+	Status   restStatus   `json:"status"`
+}
+
+func (rc *RESTCache) handleStation(w http.ResponseWriter, r *http.Request) {
+	stationID, stationName, _ := rc.ids()
+	if r.PathValue("id") != stationID {
+		writeRESTError(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+
+	id, _ := strconv.Atoi(stationID)
+	resp := stationObsResponse{
+		StationID:   id,
+		StationName: stationName,
+		Obs:         []stationObs{},
+		Status:      restStatusOK,
+	}
+	if obs, ok := rc.collector.Observation(); ok {
+		resp.Obs = append(resp.Obs, stationObs{
+			restObs:   observationToRESTObs(obs),
+			DewPoint:  ptr(DewPoint(obs.AirTemperature, obs.RelativeHumidity)),
+			FeelsLike: ptr(FeelsLike(obs.AirTemperature, obs.RelativeHumidity, obs.WindAvg)),
+		})
+	}
+	writeJSON(w, resp)
+}
+
+func (rc *RESTCache) handleDevice(w http.ResponseWriter, r *http.Request) {
+	_, _, deviceID := rc.ids()
+	if r.PathValue("id") != deviceID {
+		writeRESTError(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+
+	var observations []Observation
+	q := r.URL.Query()
+	if q.Has("time_start") || q.Has("time_end") {
+		start, err1 := strconv.ParseInt(q.Get("time_start"), 10, 64)
+		end, err2 := strconv.ParseInt(q.Get("time_end"), 10, 64)
+		if err1 != nil || err2 != nil || start < 0 || end < start {
+			writeRESTError(w, http.StatusBadRequest, "INVALID time_start/time_end")
+			return
+		}
+		var err error
+		observations, err = rc.history(start, end)
+		if err != nil {
+			slog.Error("device history query failed", "error", err)
+			writeRESTError(w, http.StatusInternalServerError, "INTERNAL ERROR")
+			return
+		}
+	} else if obs, ok := rc.collector.Observation(); ok {
+		observations = []Observation{obs}
+	}
+
+	id, _ := strconv.Atoi(deviceID)
+	resp := deviceObsResponse{
+		DeviceID: id,
+		Type:     "obs_st",
+		Obs:      make([][]*float64, 0, len(observations)),
+		Status:   restStatusOK,
+	}
+	for _, obs := range observations {
+		resp.Obs = append(resp.Obs, observationToArray(obs))
+	}
+	writeJSON(w, resp)
+}
+
+// observationToRESTObs is the inverse of stationObsToObservation; NaN becomes null.
+func observationToRESTObs(obs Observation) restObs {
+	ts := float64(obs.Timestamp)
+	return restObs{
+		Timestamp:              &ts,
+		WindLull:               ptr(obs.WindLull),
+		WindAvg:                ptr(obs.WindAvg),
+		WindGust:               ptr(obs.WindGust),
+		WindDirection:          ptr(obs.WindDirection),
+		StationPressure:        ptr(obs.StationPressure),
+		AirTemperature:         ptr(obs.AirTemperature),
+		RelativeHumidity:       ptr(obs.RelativeHumidity),
+		Illuminance:            ptr(obs.Illuminance),
+		UV:                     ptr(obs.UV),
+		SolarRadiation:         ptr(obs.SolarRadiation),
+		RainAccumulated:        ptr(obs.RainAccumulated),
+		PrecipitationType:      ptr(obs.PrecipitationType),
+		LightningStrikeAvgDist: ptr(obs.LightningStrikeAvgDist),
+		LightningStrikeCount:   ptr(obs.LightningStrikeCount),
+		Battery:                ptr(obs.Battery),
+		ReportInterval:         ptr(obs.ReportInterval),
+	}
+}
+
+// observationToArray is the inverse of ParseObservation: the 18-element obs_st
+// array with NaN as null.
+func observationToArray(obs Observation) []*float64 {
+	ts := float64(obs.Timestamp)
+	return []*float64{
+		&ts,
+		ptr(obs.WindLull),
+		ptr(obs.WindAvg),
+		ptr(obs.WindGust),
+		ptr(obs.WindDirection),
+		ptr(obs.WindSampleInterval),
+		ptr(obs.StationPressure),
+		ptr(obs.AirTemperature),
+		ptr(obs.RelativeHumidity),
+		ptr(obs.Illuminance),
+		ptr(obs.UV),
+		ptr(obs.SolarRadiation),
+		ptr(obs.RainAccumulated),
+		ptr(obs.PrecipitationType),
+		ptr(obs.LightningStrikeAvgDist),
+		ptr(obs.LightningStrikeCount),
+		ptr(obs.Battery),
+		ptr(obs.ReportInterval),
+	}
+}
+
+// ptr returns a pointer to v, or nil for NaN so it encodes as JSON null.
+func ptr(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeRESTError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Status restStatus `json:"status"`
+	}{restStatus{StatusCode: code, StatusMessage: msg}})
+}
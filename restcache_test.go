@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestRESTCache() (*RESTCache, *Collector, *http.ServeMux) {
+	c := NewCollector("99999", "backyard")
+	rc := NewRESTCache(c, "99999", "backyard", "12345")
+	mux := http.NewServeMux()
+	rc.Register(mux)
+	return rc, c, mux
+}
+
+func TestRESTCache_StationRoundTrip(t *testing.T) {
+	_, c, mux := newTestRESTCache()
+	obs := testObservation()
+	obs.UV = math.NaN()
+	c.UpdateObservation(obs)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// The existing REST client must be able to consume the cache unchanged.
+	rest := NewRESTClient("ignored", "99999", NewCollector("99999", "test"))
+	rest.baseURL = srv.URL + "/swd/rest"
+
+	got, err := rest.FetchObservation(context.Background())
+	if err != nil {
+		t.Fatalf("FetchObservation from cache: %v", err)
+	}
+	if got.Timestamp != obs.Timestamp || got.AirTemperature != obs.AirTemperature {
+		t.Errorf("got %+v, want %+v", *got, obs)
+	}
+	if got.UV != 0 {
+		t.Errorf("NaN UV should round-trip as null (0), got %v", got.UV)
+	}
+}
+
+func TestRESTCache_StationDerivedFields(t *testing.T) {
+	_, c, mux := newTestRESTCache()
+	c.UpdateObservation(testObservation())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swd/rest/observations/station/99999", nil))
+
+	var resp stationObsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StationID != 99999 || resp.StationName != "backyard" {
+		t.Errorf("station = %d/%q", resp.StationID, resp.StationName)
+	}
+	if len(resp.Obs) != 1 || resp.Obs[0].DewPoint == nil {
+		t.Fatalf("expected one obs with dew_point, got %s", w.Body.String())
+	}
+	if *resp.Obs[0].DewPoint != DewPoint(22.5, 65) {
+		t.Errorf("dew_point = %v", *resp.Obs[0].DewPoint)
+	}
+}
+
+func TestRESTCache_NoObservation(t *testing.T) {
+	_, _, mux := newTestRESTCache()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swd/rest/observations/station/99999", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp stationObsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Obs == nil || len(resp.Obs) != 0 {
+		t.Errorf("obs = %v, want empty array", resp.Obs)
+	}
+}
+
+func TestRESTCache_UnknownIDs(t *testing.T) {
+	_, _, mux := newTestRESTCache()
+
+	for _, path := range []string{
+		"/swd/rest/observations/station/11111",
+		"/swd/rest/observations/device/11111",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s status = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestRESTCache_SetStation(t *testing.T) {
+	rc, _, mux := newTestRESTCache()
+	rc.add(Observation{Timestamp: 1700000000})
+
+	rc.SetStation("11111", "roof", "22222")
+	for path, want := range map[string]int{
+		"/swd/rest/observations/station/99999": http.StatusNotFound,
+		"/swd/rest/observations/device/12345":  http.StatusNotFound,
+		"/swd/rest/observations/station/11111": http.StatusOK,
+		"/swd/rest/observations/device/22222":  http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s status = %d, want %d", path, w.Code, want)
+		}
+	}
+	if got := rc.Range(0, 1<<40); len(got) != 0 {
+		t.Errorf("kept %d observations from the previous device", len(got))
+	}
+}
+
+func TestRESTCache_DeviceHistory(t *testing.T) {
+	_, c, mux := newTestRESTCache()
+	for i := int64(0); i < 5; i++ {
+		obs := testObservation()
+		obs.Timestamp = 1700000000 + i*60
+		c.UpdateObservation(obs)
+	}
+	// Re-polled duplicate is not recorded twice.
+	c.UpdateObservation(Observation{Timestamp: 1700000240})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/swd/rest/observations/device/12345?time_start=1700000060&time_end=1700000180", nil))
+
+	var resp deviceObsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Type != "obs_st" || resp.DeviceID != 12345 {
+		t.Errorf("type/device = %q/%d", resp.Type, resp.DeviceID)
+	}
+	if len(resp.Obs) != 3 {
+		t.Fatalf("got %d observations, want 3", len(resp.Obs))
+	}
+
+	// Each row must parse back through the WebSocket obs_st parser.
+	row := make([]any, len(resp.Obs[0]))
+	for i, v := range resp.Obs[0] {
+		if v != nil {
+			row[i] = *v
+		}
+	}
+	obs, err := ParseObservation(row)
+	if err != nil {
+		t.Fatalf("ParseObservation: %v", err)
+	}
+	if obs.Timestamp != 1700000060 || obs.AirTemperature != 22.5 {
+		t.Errorf("parsed row = %+v", obs)
+	}
+}
+
+func TestRESTCache_DeviceLatestAndBadRange(t *testing.T) {
+	_, c, mux := newTestRESTCache()
+	c.UpdateObservation(testObservation())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swd/rest/observations/device/12345", nil))
+	var resp deviceObsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Obs) != 1 {
+		t.Errorf("got %d observations, want latest only", len(resp.Obs))
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/swd/rest/observations/device/12345?time_start=10&time_end=5", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("inverted range status = %d, want 400", w.Code)
+	}
+}
+
+func TestRESTCache_RingWraps(t *testing.T) {
+	rc, c, _ := newTestRESTCache()
+	for i := int64(0); i < restCacheSize+10; i++ {
+		c.UpdateObservation(Observation{Timestamp: i})
+	}
+	got := rc.Range(0, math.MaxInt64)
+	if len(got) != restCacheSize {
+		t.Fatalf("len = %d, want %d", len(got), restCacheSize)
+	}
+	if got[0].Timestamp != 10 || got[len(got)-1].Timestamp != restCacheSize+9 {
+		t.Errorf("range = %d..%d", got[0].Timestamp, got[len(got)-1].Timestamp)
+	}
+}
+
+func TestRESTCache_DeviceHistoryFromStore(t *testing.T) {
+	store := newTestHistoryStore(t)
+	c := NewCollector("99999", "backyard")
+	rc := NewRESTCache(c, "99999", "backyard", "12345")
+	rc.UseStore(store)
+	mux := http.NewServeMux()
+	rc.Register(mux)
+
+	// A live observation, then an older minute replayed by the backfiller
+	// straight into the store: the ring would drop it as out of order.
+	c.UpdateObservation(Observation{Timestamp: 1700000120, AirTemperature: 21})
+	for _, obs := range []Observation{
+		{Timestamp: 1700000060, AirTemperature: 20},
+		{Timestamp: 1700000120, AirTemperature: 21},
+	} {
+		if err := store.AddObservation(obs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/swd/rest/observations/device/12345?time_start=1700000000&time_end=1700000200", nil))
+	var resp deviceObsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Obs) != 2 || *resp.Obs[0][0] != 1700000060 {
+		t.Errorf("got %d observations, want both stored minutes oldest first", len(resp.Obs))
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/swd/rest/observations/device/12345?time_start=-1&time_end=5", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative time_start status = %d, want 400", w.Code)
+	}
+}
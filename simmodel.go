@@ -0,0 +1,209 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// weatherModel generates synthetic but plausible Tempest observations. Every
+// value is a pure function of the seed and the timestamp, so live data, REST
+// history and repeated runs agree without storing anything.
+type weatherModel struct {
+	seed uint64
+	// utcOffset shifts the diurnal cycle to the station's local time.
+	utcOffset int64
+	// stormChance is the probability of a storm in each 6-hour block.
+	stormChance float64
+}
+
+const (
+	stormBlock       = 6 * 3600
+	simStrikeMaxDist = 40.0 // km
+)
+
+func newWeatherModel(seed uint64, loc *time.Location, stormChance float64) *weatherModel {
+	_, offset := time.Now().In(loc).Zone()
+	return &weatherModel{seed: seed, utcOffset: int64(offset), stormChance: stormChance}
+}
+
+// Noise channels, so each quantity gets independent randomness.
+const (
+	chTemp uint64 = iota + 1
+	chHumidity
+	chPressure
+	chWind
+	chDirection
+	chCloud
+	chGust
+	chRain
+	chStrikes
+	chStrikeDist
+	chStormStart
+	chStormLength
+	chStormChance
+	chRapid
+)
+
+// hash01 returns a uniformly distributed value in [0, 1) for (seed, ch, i),
+// using the splitmix64 finalizer.
+func (m *weatherModel) hash01(ch uint64, i int64) float64 {
+	z := m.seed ^ ch*0x9e3779b97f4a7c15 ^ uint64(i)*0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11) / (1 << 53)
+}
+
+// noise is smooth value noise in [-1, 1] varying over roughly period seconds.
+func (m *weatherModel) noise(ch uint64, ts int64, period int64) float64 {
+	i := floorDiv(ts, period)
+	f := float64(ts-i*period) / float64(period)
+	f = f * f * (3 - 2*f) // smoothstep
+	a := m.hash01(ch, i)*2 - 1
+	b := m.hash01(ch, i+1)*2 - 1
+	return a + (b-a)*f
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// storm returns the storm intensity at ts, 0 outside storms and peaking at 1.
+// Each 6-hour block has at most one storm lasting 30 minutes to 2 hours.
+func (m *weatherModel) storm(ts int64) float64 {
+	block := floorDiv(ts, stormBlock)
+	for _, b := range []int64{block - 1, block} { // a storm may run past its block
+		if m.hash01(chStormChance, b) >= m.stormChance {
+			continue
+		}
+		start := b*stormBlock + int64(m.hash01(chStormStart, b)*4*3600)
+		length := int64(1800 + m.hash01(chStormLength, b)*5400)
+		if ts >= start && ts < start+length {
+			return math.Sin(math.Pi * float64(ts-start) / float64(length))
+		}
+	}
+	return 0
+}
+
+// sun returns the sun's height in [0, 1]: 0 at night, 1 at local noon.
+func (m *weatherModel) sun(ts int64) float64 {
+	hour := float64(((ts+m.utcOffset)%86400+86400)%86400) / 3600
+	return math.Max(0, math.Sin(math.Pi*(hour-6)/12))
+}
+
+// diurnal is -1 before dawn and +1 in mid-afternoon.
+func (m *weatherModel) diurnal(ts int64) float64 {
+	hour := float64(((ts+m.utcOffset)%86400+86400)%86400) / 3600
+	return math.Sin(2 * math.Pi * (hour - 9) / 24)
+}
+
+// rain returns the rain accumulation in mm over the minute containing ts.
+func (m *weatherModel) rain(ts int64) float64 {
+	s := m.storm(floorDiv(ts, 60) * 60)
+	if s < 0.2 {
+		return 0
+	}
+	mm := s * 1.2 * (0.5 + m.hash01(chRain, floorDiv(ts, 60)))
+	return math.Round(mm*100) / 100
+}
+
+// strikes returns the lightning strikes in the minute containing ts, as
+// distances in km.
+func (m *weatherModel) strikes(ts int64) []float64 {
+	minute := floorDiv(ts, 60)
+	s := m.storm(minute * 60)
+	if s < 0.5 {
+		return nil
+	}
+	n := int(m.hash01(chStrikes, minute) * s * 6)
+	dists := make([]float64, n)
+	for i := range dists {
+		// Strikes move closer as the storm peaks.
+		d := simStrikeMaxDist * (1.1 - s) * (0.5 + m.hash01(chStrikeDist, minute*8+int64(i)))
+		dists[i] = math.Round(math.Max(1, d))
+	}
+	return dists
+}
+
+// rainStarted reports whether rain begins in the minute containing ts.
+func (m *weatherModel) rainStarted(ts int64) bool {
+	return m.rain(ts) > 0 && m.rain(ts-60) == 0
+}
+
+// windAt is the average wind speed in m/s at ts.
+func (m *weatherModel) windAt(ts int64) float64 {
+	return math.Max(0, 2.5+1.5*m.sun(ts)+2*m.noise(chWind, ts, 1800)+8*m.storm(ts))
+}
+
+// directionAt is the wind direction in degrees at ts.
+func (m *weatherModel) directionAt(ts int64) float64 {
+	return math.Mod(220+120*m.noise(chDirection, ts, 6*3600)+360, 360)
+}
+
+// Observation returns the obs_st reading for ts.
+func (m *weatherModel) Observation(ts int64) Observation {
+	storm := m.storm(ts)
+	sun := m.sun(ts)
+	cloud := math.Min(1, math.Max(0, 0.3+0.4*m.noise(chCloud, ts, 2*3600)+storm))
+
+	wind := m.windAt(ts)
+	gust := wind * (1.3 + 0.4*m.hash01(chGust, floorDiv(ts, 60)))
+	illuminance := sun * 110000 * (1 - 0.8*cloud)
+
+	strikes := m.strikes(ts)
+	avgDist := 0.0
+	for _, d := range strikes {
+		avgDist += d / float64(len(strikes))
+	}
+	rain := m.rain(ts)
+	precipType := 0.0
+	if rain > 0 {
+		precipType = 1
+	}
+
+	round := func(v float64, digits int) float64 {
+		p := math.Pow(10, float64(digits))
+		return math.Round(v*p) / p
+	}
+	return Observation{
+		Timestamp:              ts,
+		WindLull:               round(wind*0.5, 2),
+		WindAvg:                round(wind, 2),
+		WindGust:               round(gust, 2),
+		WindDirection:          math.Round(m.directionAt(ts)),
+		WindSampleInterval:     3,
+		StationPressure:        round(1013+6*m.noise(chPressure, ts, 2*86400)-4*storm, 1),
+		AirTemperature:         round(12+8*m.diurnal(ts)+3*m.noise(chTemp, ts, 3*3600)-4*storm, 1),
+		RelativeHumidity:       math.Round(math.Min(100, math.Max(15, 65-20*m.diurnal(ts)+10*m.noise(chHumidity, ts, 3*3600)+30*storm))),
+		Illuminance:            math.Round(illuminance),
+		UV:                     round(sun*10*(1-0.7*cloud), 1),
+		SolarRadiation:         math.Round(illuminance / 120),
+		RainAccumulated:        rain,
+		PrecipitationType:      precipType,
+		LightningStrikeAvgDist: math.Round(avgDist),
+		LightningStrikeCount:   float64(len(strikes)),
+		Battery:                round(2.55+0.1*sun, 2),
+		ReportInterval:         1,
+	}
+}
+
+// Range returns one observation per minute with start <= Timestamp <= end,
+// matching the REST device history at full resolution.
+func (m *weatherModel) Range(start, end int64) []Observation {
+	var out []Observation
+	for ts := floorDiv(start+59, 60) * 60; ts <= end; ts += 60 {
+		out = append(out, m.Observation(ts))
+	}
+	return out
+}
+
+// RapidWind returns a 3-second wind sample with short-term gustiness.
+func (m *weatherModel) RapidWind(ts int64) RapidWind {
+	speed := m.windAt(ts) * (0.6 + 0.8*m.hash01(chRapid, ts))
+	dir := math.Mod(m.directionAt(ts)+30*(m.hash01(chRapid, ts+1)-0.5)+360, 360)
+	return RapidWind{Timestamp: ts, Speed: math.Round(speed*100) / 100, Direction: math.Round(dir)}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWeatherModel_Deterministic(t *testing.T) {
+	a := newWeatherModel(42, time.UTC, 0.5)
+	b := newWeatherModel(42, time.UTC, 0.5)
+	c := newWeatherModel(43, time.UTC, 0.5)
+
+	ts := int64(1700000000)
+	if a.Observation(ts) != b.Observation(ts) {
+		t.Error("same seed produced different observations")
+	}
+	same := true
+	for i := int64(0); i < 60; i++ {
+		if a.Observation(ts+i*600) != c.Observation(ts+i*600) {
+			same = false
+		}
+	}
+	if same {
+		t.Error("different seeds produced identical weather")
+	}
+}
+
+func TestWeatherModel_PlausibleRanges(t *testing.T) {
+	m := newWeatherModel(7, time.UTC, 0.5)
+	start := int64(1700000000)
+	for ts := start; ts < start+7*86400; ts += 300 {
+		o := m.Observation(ts)
+		switch {
+		case o.AirTemperature < -20 || o.AirTemperature > 45:
+			t.Fatalf("temperature %v at %d", o.AirTemperature, ts)
+		case o.RelativeHumidity < 0 || o.RelativeHumidity > 100:
+			t.Fatalf("humidity %v at %d", o.RelativeHumidity, ts)
+		case o.WindLull > o.WindAvg || o.WindAvg > o.WindGust:
+			t.Fatalf("wind lull/avg/gust %v/%v/%v at %d", o.WindLull, o.WindAvg, o.WindGust, ts)
+		case o.WindDirection < 0 || o.WindDirection > 360:
+			t.Fatalf("direction %v at %d", o.WindDirection, ts)
+		case o.RainAccumulated < 0 || o.Illuminance < 0 || o.UV < 0:
+			t.Fatalf("negative rain/light at %d: %+v", ts, o)
+		}
+	}
+}
+
+func TestWeatherModel_DiurnalCycle(t *testing.T) {
+	m := newWeatherModel(1, time.UTC, 0)
+	day := int64(1700006400) // a midnight UTC
+	if m.sun(day) != 0 {
+		t.Errorf("sun at midnight = %v, want 0", m.sun(day))
+	}
+	if got := m.sun(day + 12*3600); math.Abs(got-1) > 1e-9 {
+		t.Errorf("sun at noon = %v, want 1", got)
+	}
+	if m.Observation(day+12*3600).Illuminance <= m.Observation(day).Illuminance {
+		t.Error("illuminance at noon not above midnight")
+	}
+
+	// Averaged over a week, afternoons are warmer than pre-dawn.
+	var dawn, afternoon float64
+	for d := int64(0); d < 7; d++ {
+		dawn += m.Observation(day + d*86400 + 4*3600).AirTemperature
+		afternoon += m.Observation(day + d*86400 + 15*3600).AirTemperature
+	}
+	if afternoon <= dawn {
+		t.Errorf("afternoon total %v not above dawn total %v", afternoon, dawn)
+	}
+}
+
+func TestWeatherModel_StormsBringRainAndLightning(t *testing.T) {
+	calm := newWeatherModel(3, time.UTC, 0)
+	stormy := newWeatherModel(3, time.UTC, 1)
+	start := int64(1700000000)
+
+	var calmRain, stormRain float64
+	var strikes, rainStarts int
+	for ts := start; ts < start+2*86400; ts += 60 {
+		calmRain += calm.Observation(ts).RainAccumulated
+		o := stormy.Observation(ts)
+		stormRain += o.RainAccumulated
+		strikes += int(o.LightningStrikeCount)
+		if stormy.rainStarted(ts) {
+			rainStarts++
+		}
+	}
+	if calmRain != 0 {
+		t.Errorf("rain with storm chance 0 = %v", calmRain)
+	}
+	if stormRain == 0 || strikes == 0 || rainStarts == 0 {
+		t.Errorf("storms produced rain %v, strikes %d, rain starts %d", stormRain, strikes, rainStarts)
+	}
+}
+
+func TestWeatherModel_Range(t *testing.T) {
+	m := newWeatherModel(1, time.UTC, 0.25)
+	got := m.Range(1700000001, 1700000300)
+	if len(got) != 5 {
+		t.Fatalf("len = %d, want 5", len(got))
+	}
+	if got[0].Timestamp != 1700000040 || got[4].Timestamp != 1700000280 {
+		t.Errorf("timestamps %d..%d", got[0].Timestamp, got[4].Timestamp)
+	}
+	if got[1] != m.Observation(1700000100) {
+		t.Error("Range disagrees with Observation")
+	}
+}
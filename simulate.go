@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// rapidWindInterval matches the Tempest's rapid_wind cadence.
+	rapidWindInterval = 3 * time.Second
+	// defaultUDPPort is the port the Tempest hub broadcasts on.
+	defaultUDPPort = 50222
+)
+
+// outageWindow is a scripted outage relative to the simulator's start.
+type outageWindow struct {
+	start, length time.Duration
+}
+
+// parseOutages parses a comma-separated list of START+LENGTH durations, for
+// example "10m+2m,1h+6m".
+func parseOutages(s string) ([]outageWindow, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []outageWindow
+	for _, item := range strings.Split(s, ",") {
+		startStr, lengthStr, ok := strings.Cut(strings.TrimSpace(item), "+")
+		if !ok {
+			return nil, fmt.Errorf("outage %q: want START+LENGTH", item)
+		}
+		start, err := time.ParseDuration(startStr)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("outage %q: invalid start", item)
+		}
+		length, err := time.ParseDuration(lengthStr)
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("outage %q: invalid length", item)
+		}
+		out = append(out, outageWindow{start: start, length: length})
+	}
+	return out, nil
+}
+
+func inOutage(windows []outageWindow, elapsed time.Duration) bool {
+	for _, w := range windows {
+		if elapsed >= w.start && elapsed < w.start+w.length {
+			return true
+		}
+	}
+	return false
+}
+
+// simMessage is a WeatherFlow message as sent over the WebSocket (device_id)
+// or the local UDP broadcast (serial_number and hub_sn).
+type simMessage struct {
+	Type             string       `json:"type"`
+	DeviceID         int          `json:"device_id,omitempty"`
+	SerialNumber     string       `json:"serial_number,omitempty"`
+	HubSN            string       `json:"hub_sn,omitempty"`
+	Obs              [][]*float64 `json:"obs,omitempty"`
+	Ob               []float64    `json:"ob,omitempty"`
+	Evt              []float64    `json:"evt,omitempty"`
+	FirmwareRevision int          `json:"firmware_revision,omitempty"`
+}
+
+// Simulator emulates the WeatherFlow WebSocket, REST and local UDP interfaces
+// with synthetic weather from a weatherModel.
+type Simulator struct {
+	model       *weatherModel
+	deviceID    int
+	stationID   string
+	stationName string
+
+	collector *Collector
+	cache     *RESTCache
+	proxy     *WSProxy
+
+	udp     net.PacketConn
+	udpAddr net.Addr
+
+	wsOutages   []outageWindow
+	restOutages []outageWindow
+	start       time.Time
+
+	mu        sync.Mutex
+	wsDown    bool
+	lastEvent int64 // last minute whose events were emitted
+}
+
+// NewSimulator creates a simulator for one station and device.
+func NewSimulator(model *weatherModel, stationID, stationName string, deviceID int) *Simulator {
+	collector := NewCollector(stationID, stationName)
+	cache := NewRESTCache(collector, stationID, stationName, strconv.Itoa(deviceID))
+	cache.history = func(start, end int64) ([]Observation, error) {
+		return model.Range(start, end), nil
+	}
+	start := time.Now()
+	return &Simulator{
+		model:       model,
+		deviceID:    deviceID,
+		stationID:   stationID,
+		stationName: stationName,
+		collector:   collector,
+		cache:       cache,
+		proxy:       NewWSProxy(64),
+		start:       start,
+		lastEvent:   floorDiv(start.Unix(), 60) - 1,
+	}
+}
+
+// SetOutages scripts WebSocket and REST outages relative to the start.
+func (s *Simulator) SetOutages(ws, rest []outageWindow) {
+	s.wsOutages = ws
+	s.restOutages = rest
+}
+
+// EnableUDP broadcasts every message to addr in the local UDP format.
+func (s *Simulator) EnableUDP(addr string) error {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return fmt.Errorf("resolving UDP address: %w", err)
+	}
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return fmt.Errorf("opening UDP socket: %w", err)
+	}
+	s.udp = conn
+	s.udpAddr = raddr
+	return nil
+}
+
+// Handler serves the WebSocket at /swd/data and the REST API under /swd/rest.
+func (s *Simulator) Handler() http.Handler {
+	rest := http.NewServeMux()
+	s.cache.Register(rest)
+	rest.HandleFunc("GET /swd/rest/stations/{id}", s.handleStation)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(wsProxyPath, func(w http.ResponseWriter, r *http.Request) {
+		if inOutage(s.wsOutages, time.Since(s.start)) {
+			http.Error(w, "simulated outage", http.StatusServiceUnavailable)
+			return
+		}
+		s.proxy.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/swd/rest/", func(w http.ResponseWriter, r *http.Request) {
+		if inOutage(s.restOutages, time.Since(s.start)) {
+			writeRESTError(w, http.StatusServiceUnavailable, "SIMULATED OUTAGE")
+			return
+		}
+		rest.ServeHTTP(w, r)
+	})
+	return mux
+}
+
+func (s *Simulator) handleStation(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != s.stationID {
+		writeRESTError(w, http.StatusNotFound, "NOT FOUND")
+		return
+	}
+	id, _ := strconv.Atoi(s.stationID)
+	writeJSON(w, map[string]any{
+		"stations": []map[string]any{{
+			"station_id":   id,
+			"name":         s.stationName,
+			"latitude":     40.7608,
+			"longitude":    -111.891,
+			"timezone":     time.Local.String(),
+			"station_meta": map[string]any{"elevation": 1288.0},
+		}},
+		"status": restStatusOK,
+	})
+}
+
+// Run emits observations every interval and rapid wind every 3 seconds until
+// the context is cancelled.
+func (s *Simulator) Run(ctx context.Context, interval time.Duration) {
+	s.tickObservation(time.Now())
+
+	obsTicker := time.NewTicker(interval)
+	defer obsTicker.Stop()
+	rapidTicker := time.NewTicker(rapidWindInterval)
+	defer rapidTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-obsTicker.C:
+			s.tickObservation(now)
+		case now := <-rapidTicker.C:
+			s.checkOutage(now)
+			rw := s.model.RapidWind(now.Unix())
+			s.emit(simMessage{Type: "rapid_wind", Ob: []float64{float64(rw.Timestamp), rw.Speed, rw.Direction}})
+		}
+	}
+}
+
+// checkOutage drops WebSocket clients when a scripted outage begins.
+func (s *Simulator) checkOutage(now time.Time) {
+	down := inOutage(s.wsOutages, now.Sub(s.start))
+	s.mu.Lock()
+	changed := down != s.wsDown
+	s.wsDown = down
+	s.mu.Unlock()
+	if !changed {
+		return
+	}
+	if down {
+		slog.Warn("simulated WebSocket outage started")
+		s.proxy.DisconnectAll()
+	} else {
+		slog.Info("simulated WebSocket outage ended")
+	}
+}
+
+// tickObservation emits lightning and rain start events for the minutes
+// since the last tick, then the observation for now.
+func (s *Simulator) tickObservation(now time.Time) {
+	s.checkOutage(now)
+	ts := now.Unix()
+
+	s.mu.Lock()
+	from := s.lastEvent + 1
+	s.lastEvent = floorDiv(ts, 60)
+	to := s.lastEvent
+	s.mu.Unlock()
+
+	for minute := from; minute <= to; minute++ {
+		start := minute * 60
+		if s.model.rainStarted(start) {
+			s.emit(simMessage{Type: "evt_precip", Evt: []float64{float64(start)}})
+		}
+		strikes := s.model.strikes(start)
+		for i, dist := range strikes {
+			// Spread the minute's strikes evenly across it.
+			strikeTS := start + int64(i*60/len(strikes))
+			energy := float64(1000 + int(s.model.hash01(chStrikes, strikeTS)*9000))
+			s.emit(simMessage{Type: "evt_strike", Evt: []float64{float64(strikeTS), dist, energy}})
+		}
+	}
+
+	obs := s.model.Observation(ts)
+	s.collector.UpdateObservation(obs)
+	s.emit(simMessage{Type: "obs_st", Obs: [][]*float64{observationToArray(obs)}})
+}
+
+// emit sends a message to WebSocket subscribers and, if enabled, over UDP.
+func (s *Simulator) emit(m simMessage) {
+	s.mu.Lock()
+	down := s.wsDown
+	s.mu.Unlock()
+
+	if !down {
+		m.DeviceID = s.deviceID
+		if data, err := json.Marshal(m); err == nil {
+			s.proxy.Publish(m.Type, data)
+		}
+	}
+
+	if s.udp != nil {
+		m.DeviceID = 0
+		m.SerialNumber = fmt.Sprintf("ST-%08d", s.deviceID)
+		m.HubSN = fmt.Sprintf("HB-%08d", s.deviceID)
+		if m.Type == "obs_st" {
+			m.FirmwareRevision = 176
+		}
+		if data, err := json.Marshal(m); err == nil {
+			if _, err := s.udp.WriteTo(data, s.udpAddr); err != nil {
+				slog.Warn("UDP broadcast failed", "error", err)
+			}
+		}
+	}
+}
+
+// runSimulateCommand implements the simulate subcommand. It returns the
+// process exit code.
+func runSimulateCommand(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tempest-exporter simulate [flags]\n\n"+
+			"Serves a simulated WeatherFlow WebSocket (/swd/data) and REST API (/swd/rest)\n"+
+			"with synthetic weather. Point the exporter at it with\n"+
+			"TEMPEST_WS_URL=ws://HOST/swd/data and TEMPEST_REST_URL=http://HOST/swd/rest.\n\n")
+		fs.PrintDefaults()
+	}
+	listen := fs.String("listen", ":8081", "HTTP listen address")
+	deviceID := fs.Int("device-id", 12345, "simulated device ID")
+	stationID := fs.String("station-id", "67890", "simulated station ID")
+	stationName := fs.String("station-name", "simulator", "simulated station name")
+	interval := fs.Duration("interval", time.Minute, "time between obs_st messages")
+	seed := fs.Uint64("seed", 1, "random seed; the same seed produces the same weather")
+	stormChance := fs.Float64("storm-chance", 0.25, "probability of a storm in each 6-hour block")
+	wsOutagesFlag := fs.String("ws-outages", "", "WebSocket outages as START+LENGTH list, e.g. 10m+2m,1h+6m")
+	restOutagesFlag := fs.String("rest-outages", "", "REST outages as START+LENGTH list")
+	udpAddr := fs.String("udp", "", fmt.Sprintf("also broadcast the local UDP format to this address, e.g. 255.255.255.255:%d", defaultUDPPort))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *interval <= 0 || *stormChance < 0 || *stormChance > 1 {
+		slog.Error("-interval must be positive and -storm-chance between 0 and 1")
+		return 2
+	}
+	wsOutages, err := parseOutages(*wsOutagesFlag)
+	if err != nil {
+		slog.Error("invalid -ws-outages", "error", err)
+		return 2
+	}
+	restOutages, err := parseOutages(*restOutagesFlag)
+	if err != nil {
+		slog.Error("invalid -rest-outages", "error", err)
+		return 2
+	}
+
+	sim := NewSimulator(newWeatherModel(*seed, time.Local, *stormChance), *stationID, *stationName, *deviceID)
+	sim.SetOutages(wsOutages, restOutages)
+	if *udpAddr != "" {
+		if err := sim.EnableUDP(*udpAddr); err != nil {
+			slog.Error("UDP broadcast unavailable", "error", err)
+			return 1
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go sim.Run(ctx, *interval)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           sim.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("simulator listening",
+		"listen_addr", *listen,
+		"device_id", *deviceID,
+		"station_id", *stationID,
+		"interval", *interval,
+		"udp", *udpAddr,
+	)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("simulator server error", "error", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+func newTestSimulator(t *testing.T) (*Simulator, *httptest.Server) {
+	t.Helper()
+	sim := NewSimulator(newWeatherModel(1, time.UTC, 0.25), "67890", "sim", 12345)
+	srv := httptest.NewServer(sim.Handler())
+	t.Cleanup(srv.Close)
+	return sim, srv
+}
+
+func TestParseOutages(t *testing.T) {
+	got, err := parseOutages("10m+2m, 1h+30s")
+	if err != nil {
+		t.Fatalf("parseOutages: %v", err)
+	}
+	want := []outageWindow{{10 * time.Minute, 2 * time.Minute}, {time.Hour, 30 * time.Second}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !inOutage(got, 11*time.Minute) || inOutage(got, 12*time.Minute) {
+		t.Error("inOutage boundaries wrong")
+	}
+
+	for _, bad := range []string{"10m", "x+1m", "1m+0s", "-1m+1m"} {
+		if _, err := parseOutages(bad); err == nil {
+			t.Errorf("parseOutages(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSimulator_WebSocketClient(t *testing.T) {
+	sim, srv := newTestSimulator(t)
+	now := time.Now()
+	sim.tickObservation(now)
+
+	collector := NewCollector("67890", "sim")
+	client := NewClient("test-token", "12345", collector)
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http") + wsProxyPath
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !collector.HasObservation() {
+		if time.Now().After(deadline) {
+			t.Fatal("client received no observation from the simulator")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := collector.State().Observation, sim.model.Observation(now.Unix()); got != want {
+		t.Errorf("observation = %+v, want %+v", got, want)
+	}
+}
+
+func TestSimulator_RESTHistory(t *testing.T) {
+	sim, srv := newTestSimulator(t)
+	rest := NewRESTClient("test-token", "67890", nil)
+	rest.baseURL = srv.URL + "/swd/rest"
+
+	end := time.Now().Unix()
+	got, err := rest.FetchDeviceObservations(context.Background(), "12345", end-3600, end)
+	if err != nil {
+		t.Fatalf("FetchDeviceObservations: %v", err)
+	}
+	if len(got) != 60 {
+		t.Fatalf("got %d observations, want 60", len(got))
+	}
+	if got[10] != sim.model.Observation(got[10].Timestamp) {
+		t.Error("REST history disagrees with the model")
+	}
+
+	info, err := rest.FetchStation(context.Background())
+	if err != nil {
+		t.Fatalf("FetchStation: %v", err)
+	}
+	if info.Name != "sim" {
+		t.Errorf("station name = %q, want sim", info.Name)
+	}
+}
+
+func TestSimulator_Outages(t *testing.T) {
+	sim, srv := newTestSimulator(t)
+	sim.SetOutages([]outageWindow{{0, time.Hour}}, []outageWindow{{0, time.Hour}})
+
+	resp, err := http.Get(srv.URL + wsProxyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("WebSocket status = %d, want 503", resp.StatusCode)
+	}
+
+	rest := NewRESTClient("test-token", "67890", nil)
+	rest.baseURL = srv.URL + "/swd/rest"
+	_, err = rest.FetchDeviceObservations(context.Background(), "12345", 0, 60)
+	var se *weatherflow.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("REST error = %v, want 503", err)
+	}
+}
+
+func TestSimulator_OutageDisconnectsClients(t *testing.T) {
+	sim, srv := newTestSimulator(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn := dialProxy(t, ctx, srv)
+	waitForClients(t, sim.proxy, 1)
+
+	sim.SetOutages([]outageWindow{{0, time.Hour}}, nil)
+	sim.checkOutage(time.Now())
+	if _, _, err := conn.Read(ctx); err == nil {
+		t.Fatal("read succeeded after the outage began")
+	}
+	waitForClients(t, sim.proxy, 0)
+}
+
+func TestSimulator_UDPBroadcast(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	defer pc.Close()
+
+	sim := NewSimulator(newWeatherModel(1, time.UTC, 0), "67890", "sim", 12345)
+	if err := sim.EnableUDP(pc.LocalAddr().String()); err != nil {
+		t.Fatalf("EnableUDP: %v", err)
+	}
+	sim.tickObservation(time.Now())
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(buf[:n], &msg); err != nil {
+		t.Fatalf("unmarshal %s: %v", buf[:n], err)
+	}
+	if msg["type"] != "obs_st" || msg["serial_number"] != "ST-00012345" || msg["hub_sn"] != "HB-00012345" {
+		t.Errorf("UDP message = %s", buf[:n])
+	}
+	if _, ok := msg["device_id"]; ok {
+		t.Error("UDP message includes device_id")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateVersion is bumped when the state file format changes incompatibly.
+const stateVersion = 1
+
+// stateFile is the on-disk snapshot written by StateStore.
+type stateFile struct {
+	Version      int          `json:"version"`
+	SavedAt      int64        `json:"saved_at"`
+	StationID    string       `json:"station_id"`
+	Observation  []*float64   `json:"observation,omitempty"` // obs_st array order
+	Source       string       `json:"source,omitempty"`
+	RainStart    float64      `json:"rain_start"`
+	Reconnects   float64      `json:"reconnects"`
+	ScrapeErrors float64      `json:"scrape_errors"`
+	Rain         []rainSample `json:"rain,omitempty"`
+}
+
+// StateStore persists the collector's last observation, counters and the rain
+// accumulator to a JSON file so a restart doesn't reset them.
+type StateStore struct {
+	path      string
+	collector *Collector
+	rain      *rainAccumulator
+	// maxAge is the oldest observation that is restored as current.
+	maxAge time.Duration
+}
+
+// NewStateStore creates a state store writing to path.
+func NewStateStore(path string, collector *Collector, rain *rainAccumulator, maxAge time.Duration) *StateStore {
+	return &StateStore{
+		path:      path,
+		collector: collector,
+		rain:      rain,
+		maxAge:    maxAge,
+	}
+}
+
+// Load restores state from the file. A missing file is not an error. Counters
+// and rain samples are always restored; the observation only if it is newer
+// than maxAge, so /readyz doesn't report stale data as ready.
+func (s *StateStore) Load(now time.Time) error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading state file: %w", err)
+	}
+
+	var sf stateFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return fmt.Errorf("decoding state file: %w", err)
+	}
+	if sf.Version != stateVersion {
+		return fmt.Errorf("unsupported state file version %d", sf.Version)
+	}
+
+	current := s.collector.State()
+	if sf.StationID != current.StationID {
+		return fmt.Errorf("state file is for station %q, not %q", sf.StationID, current.StationID)
+	}
+
+	restored := CollectorState{
+		Reconnects:   sf.Reconnects,
+		ScrapeErrors: sf.ScrapeErrors,
+		RainStart:    sf.RainStart,
+		Source:       sf.Source,
+	}
+	if len(sf.Observation) == obsSTFieldCount && sf.Observation[0] != nil {
+		raw := make([]any, obsSTFieldCount)
+		for i, v := range sf.Observation {
+			if v != nil {
+				raw[i] = *v
+			}
+		}
+		obs, err := ParseObservation(raw)
+		if err == nil {
+			age := now.Sub(time.Unix(obs.Timestamp, 0))
+			if age <= s.maxAge {
+				restored.Observation = obs
+				restored.HasObs = true
+			} else {
+				slog.Info("not restoring stale observation", "age", age.Round(time.Second), "max_age", s.maxAge)
+			}
+		}
+	}
+	s.collector.Restore(restored)
+	if s.rain != nil {
+		s.rain.Restore(sf.Rain)
+	}
+
+	slog.Info("state restored",
+		"path", s.path,
+		"saved_at", time.Unix(sf.SavedAt, 0).UTC(),
+		"observation", restored.HasObs,
+		"reconnects", restored.Reconnects,
+	)
+	return nil
+}
+
+// Save writes the current state atomically (temp file and rename), so a crash
+// mid-write never leaves a truncated state file.
+func (s *StateStore) Save(now time.Time) error {
+	st := s.collector.State()
+	sf := stateFile{
+		Version:      stateVersion,
+		SavedAt:      now.Unix(),
+		StationID:    st.StationID,
+		Source:       st.Source,
+		RainStart:    st.RainStart,
+		Reconnects:   st.Reconnects,
+		ScrapeErrors: st.ScrapeErrors,
+	}
+	if st.HasObs {
+		sf.Observation = observationToArray(st.Observation)
+	}
+	if s.rain != nil {
+		sf.Rain = s.rain.Samples()
+	}
+
+	data, err := json.Marshal(sf)
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".state-*")
+	if err != nil {
+		return fmt.Errorf("creating temp state file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("syncing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replacing state file: %w", err)
+	}
+	return nil
+}
+
+// Run saves the state every interval until the context is cancelled. The
+// final snapshot at shutdown is taken by the caller with Save, after the
+// clients have stopped.
+func (s *StateStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.Save(now); err != nil {
+				slog.Error("failed to save state", "error", err)
+			}
+		}
+	}
+}
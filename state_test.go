@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateStore_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Unix(1700000030, 0)
+
+	c := NewCollector("12345", "backyard")
+	obs := testObservation()
+	obs.UV = math.NaN()
+	c.UpdateObservationFrom(obs, SourceREST)
+	c.SetRainStart(1699999000)
+	c.IncrReconnects()
+	c.IncrReconnects()
+	c.IncrScrapeErrors()
+	rain := &rainAccumulator{}
+	rain.Add(1699999940, 0.5)
+	rain.Add(1700000000, 0.25)
+
+	if err := NewStateStore(path, c, rain, 10*time.Minute).Save(now); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	restored := NewCollector("12345", "backyard")
+	restored.SetConnected(true)
+	restoredRain := &rainAccumulator{}
+	if err := NewStateStore(path, restored, restoredRain, 10*time.Minute).Load(now); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	st := restored.State()
+	if !st.HasObs || st.Observation.AirTemperature != 22.5 || st.Observation.Timestamp != 1700000000 {
+		t.Errorf("observation not restored: %+v", st.Observation)
+	}
+	if !math.IsNaN(st.Observation.UV) {
+		t.Errorf("UV = %v, want NaN", st.Observation.UV)
+	}
+	if st.Source != SourceREST {
+		t.Errorf("Source = %q, want %q", st.Source, SourceREST)
+	}
+	if st.Reconnects != 2 || st.ScrapeErrors != 1 || st.RainStart != 1699999000 {
+		t.Errorf("counters = %v/%v/%v", st.Reconnects, st.ScrapeErrors, st.RainStart)
+	}
+	if !st.Connected {
+		t.Error("Restore should not change the connection state")
+	}
+	if got := restoredRain.Samples(); len(got) != 2 || got[1].MM != 0.25 {
+		t.Errorf("rain samples = %+v", got)
+	}
+}
+
+func TestStateStore_StaleObservationNotRestored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	c := NewCollector("12345", "backyard")
+	c.UpdateObservation(testObservation())
+	c.IncrReconnects()
+	if err := NewStateStore(path, c, nil, time.Minute).Save(time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	restored := NewCollector("12345", "backyard")
+	if err := NewStateStore(path, restored, nil, time.Minute).Load(time.Unix(1700003600, 0)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if restored.HasObservation() {
+		t.Error("observation older than maxAge should not be restored")
+	}
+	if st := restored.State(); st.Reconnects != 1 {
+		t.Errorf("Reconnects = %v, want 1 even when observation is stale", st.Reconnects)
+	}
+}
+
+func TestStateStore_MissingFile(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	s := NewStateStore(filepath.Join(t.TempDir(), "absent.json"), c, nil, time.Minute)
+	if err := s.Load(time.Now()); err != nil {
+		t.Errorf("missing state file should not be an error, got %v", err)
+	}
+}
+
+func TestStateStore_RejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"corrupt":       `{not json`,
+		"version":       `{"version":99,"station_id":"12345"}`,
+		"other station": `{"version":1,"station_id":"99999","reconnects":5}`,
+	}
+	for name, content := range tests {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		c := NewCollector("12345", "backyard")
+		if err := NewStateStore(path, c, nil, time.Minute).Load(time.Now()); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if st := c.State(); st.Reconnects != 0 {
+			t.Errorf("%s: state applied despite error", name)
+		}
+	}
+}
+
+func TestStateStore_SaveLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCollector("12345", "backyard")
+	s := NewStateStore(filepath.Join(dir, "state.json"), c, nil, time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := s.Save(time.Now()); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("dir has %d entries, want only state.json", len(entries))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat is how often an SSE comment is sent to keep idle
+// connections (and proxies in between) from timing out.
+const streamHeartbeat = 15 * time.Second
+
+// streamBuffer is the number of events queued per SSE client before
+// further events are dropped for that client.
+const streamBuffer = 64
+
+// streamHandler serves Server-Sent Events for every observation, rapid wind
+// sample, lightning strike and rain start published on bus.
+func streamHandler(bus *EventBus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// Long-lived response: lift the server's write timeout for this request.
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		events, unsubscribe := bus.Subscribe(streamBuffer)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, "retry: 5000\n\n")
+		if err := rc.Flush(); err != nil {
+			slog.Warn("SSE stream not supported by response writer", "error", err)
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case e := <-events:
+				data, err := json.Marshal(streamPayload(e))
+				if err != nil {
+					slog.Error("error encoding SSE event", "type", e.Type, "error", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamPayload converts event data to a JSON-safe value; NaN fields become null.
+func streamPayload(e Event) any {
+	switch d := e.Data.(type) {
+	case Observation:
+		return observationToRESTObs(d)
+	case RapidWind:
+		return struct {
+			Timestamp int64    `json:"timestamp"`
+			Speed     *float64 `json:"wind_speed"`
+			Direction *float64 `json:"wind_direction"`
+		}{d.Timestamp, ptr(d.Speed), ptr(d.Direction)}
+	case Strike:
+		return struct {
+			Timestamp int64    `json:"timestamp"`
+			Distance  *float64 `json:"distance"`
+			Energy    *float64 `json:"energy"`
+		}{d.Timestamp, ptr(d.Distance), ptr(d.Energy)}
+	default:
+		return e.Data
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHandler(t *testing.T) {
+	bus := NewEventBus()
+	srv := httptest.NewServer(streamHandler(bus))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// Wait for the handler to subscribe before publishing.
+	for bus.Subscribers() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	obs := testObservation()
+	obs.UV = math.NaN()
+	bus.Publish(Event{Type: EventObservation, Data: obs})
+	bus.Publish(Event{Type: EventStrike, Data: Strike{Timestamp: 1700000600, Distance: 15.5, Energy: 100}})
+
+	r := bufio.NewReader(resp.Body)
+	var frames []string
+	var cur strings.Builder
+	for len(frames) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if line == "\n" {
+			frames = append(frames, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteString(line)
+	}
+
+	if frames[0] != "retry: 5000\n" {
+		t.Errorf("first frame = %q", frames[0])
+	}
+	if !strings.HasPrefix(frames[1], "event: observation\ndata: {") ||
+		!strings.Contains(frames[1], `"air_temperature":22.5`) ||
+		!strings.Contains(frames[1], `"uv":null`) {
+		t.Errorf("observation frame = %q", frames[1])
+	}
+	want := "event: strike\ndata: {\"timestamp\":1700000600,\"distance\":15.5,\"energy\":100}\n"
+	if frames[2] != want {
+		t.Errorf("strike frame = %q, want %q", frames[2], want)
+	}
+}
+
+func TestStreamHandler_Unsubscribes(t *testing.T) {
+	bus := NewEventBus()
+	srv := httptest.NewServer(streamHandler(bus))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	for bus.Subscribers() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	_ = resp.Body.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for bus.Subscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("handler did not unsubscribe after client disconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// terminalSize returns a fixed 80x24; the size isn't queried on this platform.
+func terminalSize() (int, int) {
+	return 80, 24
+}
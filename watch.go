@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// watchLogLines is how many raw messages and log lines the UI keeps.
+	watchLogLines = 200
+	// watchRefresh redraws the screen so ages keep counting between messages.
+	watchRefresh = time.Second
+
+	ansiClearLine  = "\x1b[K"
+	ansiClearBelow = "\x1b[J"
+	ansiHome       = "\x1b[H"
+	ansiAltScreen  = "\x1b[?1049h\x1b[?25l"
+	ansiMainScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// watchUI is the live terminal view used by the watch subcommand. It is fed
+// by the WebSocket client's message, parse error and event hooks, and by
+// slog through Write.
+type watchUI struct {
+	collector *Collector
+	deviceID  string
+
+	mu          sync.Mutex
+	messages    []string // raw upstream frames, oldest first
+	logs        []string // log records, oldest first
+	received    int
+	parseErrors int
+	lastError   string
+	rapidWind   *RapidWind
+	lastStrike  *Strike
+
+	// dirty is signalled when something changed and the screen should redraw.
+	dirty chan struct{}
+}
+
+func newWatchUI(collector *Collector, deviceID string) *watchUI {
+	return &watchUI{
+		collector: collector,
+		deviceID:  deviceID,
+		dirty:     make(chan struct{}, 1),
+	}
+}
+
+func (u *watchUI) changed() {
+	select {
+	case u.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// appendLine adds line to a log, keeping at most watchLogLines.
+func appendLine(lines []string, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > watchLogLines {
+		lines = append(lines[:0], lines[len(lines)-watchLogLines:]...)
+	}
+	return lines
+}
+
+// onMessage records a raw upstream message.
+func (u *watchUI) onMessage(msgType string, data []byte) {
+	line := time.Now().Format(time.TimeOnly) + " " + msgType + " " + string(data)
+	u.mu.Lock()
+	u.received++
+	u.messages = appendLine(u.messages, line)
+	u.mu.Unlock()
+	u.changed()
+}
+
+// onParseError records a message the client could not parse.
+func (u *watchUI) onParseError(msgType string, data []byte, err error) {
+	if msgType == "" {
+		msgType = "(invalid)"
+	}
+	line := time.Now().Format(time.TimeOnly) + " " + msgType + " " + string(data)
+	u.mu.Lock()
+	u.parseErrors++
+	u.lastError = fmt.Sprintf("%s: %v", msgType, err)
+	if msgType == "(invalid)" {
+		// Well-formed messages are already in the log via onMessage.
+		u.received++
+		u.messages = appendLine(u.messages, line)
+	}
+	u.mu.Unlock()
+	u.changed()
+}
+
+// onEvent records typed events that aren't part of the observation.
+func (u *watchUI) onEvent(e Event) {
+	u.mu.Lock()
+	switch d := e.Data.(type) {
+	case RapidWind:
+		u.rapidWind = &d
+	case Strike:
+		u.lastStrike = &d
+	}
+	u.mu.Unlock()
+	u.changed()
+}
+
+// Write receives formatted log records, one per call, from a slog handler.
+func (u *watchUI) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	u.mu.Lock()
+	u.logs = appendLine(u.logs, line)
+	u.mu.Unlock()
+	u.changed()
+	return len(p), nil
+}
+
+// render returns the screen as lines, fitted to width and height.
+func (u *watchUI) render(now time.Time, width, height int) []string {
+	st := u.collector.State()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	conn := "DISCONNECTED"
+	if st.Connected {
+		conn = "CONNECTED"
+	} else if class, _ := u.collector.WebSocketFailure(); class != "" {
+		conn = strings.ToUpper(class) + " ERROR"
+	}
+	lines := []string{
+		fmt.Sprintf("tempest-exporter watch   device %s   %s   reconnects %.0f   messages %d   parse errors %d",
+			u.deviceID, conn, st.Reconnects, u.received, u.parseErrors),
+	}
+	if u.lastError != "" {
+		lines = append(lines, "last parse error: "+u.lastError)
+	}
+	lines = append(lines, "")
+
+	if st.HasObs {
+		o := st.Observation
+		age := now.Sub(time.Unix(o.Timestamp, 0)).Round(time.Second)
+		lines = append(lines,
+			fmt.Sprintf("Observation  %s (%s ago)", time.Unix(o.Timestamp, 0).Format(time.DateTime), age),
+			fmt.Sprintf("Temperature  %s °C   feels like %s °C   dew point %s °C",
+				watchNum(o.AirTemperature, 1), watchNum(FeelsLike(o.AirTemperature, o.RelativeHumidity, o.WindAvg), 1),
+				watchNum(DewPoint(o.AirTemperature, o.RelativeHumidity), 1)),
+			fmt.Sprintf("Humidity     %s %%   pressure %s mb", watchNum(o.RelativeHumidity, 0), watchNum(o.StationPressure, 1)),
+			fmt.Sprintf("Wind         %s m/s   gust %s   lull %s   from %s°",
+				watchNum(o.WindAvg, 1), watchNum(o.WindGust, 1), watchNum(o.WindLull, 1), watchNum(o.WindDirection, 0)),
+			fmt.Sprintf("Rain         %s mm   precip type %s", watchNum(o.RainAccumulated, 2), watchNum(o.PrecipitationType, 0)),
+			fmt.Sprintf("Light        %s lux   UV %s   solar %s W/m²",
+				watchNum(o.Illuminance, 0), watchNum(o.UV, 1), watchNum(o.SolarRadiation, 0)),
+			fmt.Sprintf("Lightning    %s strikes   avg distance %s km",
+				watchNum(o.LightningStrikeCount, 0), watchNum(o.LightningStrikeAvgDist, 0)),
+			fmt.Sprintf("Battery      %s V   report interval %s min", watchNum(o.Battery, 2), watchNum(o.ReportInterval, 0)),
+		)
+	} else {
+		lines = append(lines, "Waiting for the first observation…")
+	}
+	if u.rapidWind != nil {
+		lines = append(lines, fmt.Sprintf("Rapid wind   %s m/s from %s° (%s ago)",
+			watchNum(u.rapidWind.Speed, 1), watchNum(u.rapidWind.Direction, 0),
+			now.Sub(time.Unix(u.rapidWind.Timestamp, 0)).Round(time.Second)))
+	}
+	if u.lastStrike != nil {
+		lines = append(lines, fmt.Sprintf("Last strike  %s km, energy %s (%s ago)",
+			watchNum(u.lastStrike.Distance, 0), watchNum(u.lastStrike.Energy, 0),
+			now.Sub(time.Unix(u.lastStrike.Timestamp, 0)).Round(time.Second)))
+	}
+
+	// Split the rows left after the two headings between raw messages and the log.
+	remaining := height - len(lines) - 2
+	msgRows := max(remaining/2, 1)
+	logRows := max(remaining-msgRows, 1)
+	lines = append(lines, "── messages ──")
+	lines = append(lines, tail(u.messages, msgRows)...)
+	lines = append(lines, "── log ──")
+	lines = append(lines, tail(u.logs, logRows)...)
+
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	for i, l := range lines {
+		lines[i] = truncate(l, width)
+	}
+	return lines
+}
+
+// Run redraws the screen on every change and once per second until the
+// context is cancelled. size returns the terminal width and height.
+func (u *watchUI) Run(ctx context.Context, out io.Writer, size func() (int, int)) {
+	_, _ = io.WriteString(out, ansiAltScreen)
+	defer func() { _, _ = io.WriteString(out, ansiMainScreen) }()
+
+	ticker := time.NewTicker(watchRefresh)
+	defer ticker.Stop()
+	for {
+		width, height := size()
+		var b strings.Builder
+		b.WriteString(ansiHome)
+		for i, l := range u.render(time.Now(), width, height) {
+			if i > 0 {
+				// No newline after the last row, which would scroll the screen.
+				b.WriteString("\r\n")
+			}
+			b.WriteString(l + ansiClearLine)
+		}
+		b.WriteString(ansiClearBelow)
+		_, _ = io.WriteString(out, b.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-u.dirty:
+		}
+	}
+}
+
+func watchNum(v float64, digits int) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	return fmt.Sprintf("%.*f", digits, v)
+}
+
+func tail(lines []string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// truncate shortens s to width runes and strips control characters, so raw
+// frames can't move the cursor.
+func truncate(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	if width <= 1 {
+		return string(r[:width])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// runWatchCommand implements the watch subcommand: it connects to the
+// WebSocket and shows a live terminal UI instead of serving HTTP. It returns
+// the process exit code.
+func runWatchCommand(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tempest-exporter watch [-rapid-wind] [-config FILE]\n\n"+
+			"Shows live observations, raw messages and connection state in the terminal.\n"+
+			"Needs the token and device ID, e.g. TEMPEST_TOKEN and TEMPEST_DEVICE_ID.\n"+
+			"Press Ctrl-C to exit.\n\n")
+		fs.PrintDefaults()
+	}
+	rapidWind := fs.Bool("rapid-wind", false, "also subscribe to 3-second rapid wind samples")
+	loadConfig := configFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err == nil {
+		err = cfg.validate(false)
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		return 1
+	}
+	token, deviceID := cfg.Tempest.Token, cfg.Tempest.DeviceID
+
+	collector := NewCollector(cfg.Tempest.StationID, cfg.Tempest.StationName)
+	ui := newWatchUI(collector, deviceID)
+	// Logs would scribble over the screen; show them in the UI instead.
+	slog.SetDefault(slog.New(slog.NewTextHandler(ui, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.String(slog.TimeKey, a.Value.Time().Format(time.TimeOnly))
+			}
+			return a
+		},
+	})))
+
+	events := NewEventBus()
+	client := newClientFromConfig(cfg, token, deviceID, collector)
+	client.OnMessage(ui.onMessage)
+	client.OnParseError(ui.onParseError)
+	client.SetEventBus(events)
+	if *rapidWind || cfg.Tempest.RapidWind {
+		client.EnableRapidWind()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sub, unsubscribe := events.Subscribe(64)
+	defer unsubscribe()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-sub:
+				ui.onEvent(e)
+			}
+		}
+	}()
+
+	go client.Run(ctx)
+	ui.Run(ctx, os.Stdout, terminalSize)
+	return 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWatchUI_Render(t *testing.T) {
+	c := NewCollector("12345", "backyard")
+	c.SetConnected(true)
+	c.IncrReconnects()
+	c.UpdateObservation(testObservation())
+
+	u := newWatchUI(c, "54321")
+	u.onMessage("obs_st", []byte(`{"type":"obs_st"}`))
+	u.onParseError("", []byte("not json"), errors.New("invalid character"))
+	u.onParseError("obs_st", []byte(`{"type":"obs_st","obs":[]}`), errors.New("empty obs array"))
+	u.onEvent(Event{Type: EventStrike, Data: Strike{Timestamp: 1700000000, Distance: 12, Energy: 50}})
+	_, _ = u.Write([]byte("level=WARN msg=\"websocket disconnected\"\n"))
+
+	lines := u.render(time.Unix(1700000030, 0), 200, 40)
+	screen := strings.Join(lines, "\n")
+
+	for _, want := range []string{
+		"device 54321   CONNECTED   reconnects 1   messages 2   parse errors 2",
+		"last parse error: obs_st: empty obs array",
+		"(30s ago)",
+		"Temperature  22.5 °C",
+		"Last strike  12 km",
+		`obs_st {"type":"obs_st"}`,
+		"(invalid) not json",
+		`msg="websocket disconnected"`,
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen missing %q:\n%s", want, screen)
+		}
+	}
+	if len(lines) > 40 {
+		t.Errorf("rendered %d lines, want at most 40", len(lines))
+	}
+}
+
+func TestWatchUI_RenderFitsScreen(t *testing.T) {
+	u := newWatchUI(NewCollector("12345", "backyard"), "54321")
+	for i := 0; i < watchLogLines+50; i++ {
+		u.onMessage("obs_st", []byte(strings.Repeat("x", 300)))
+	}
+	if len(u.messages) != watchLogLines {
+		t.Errorf("kept %d messages, want %d", len(u.messages), watchLogLines)
+	}
+
+	lines := u.render(time.Now(), 60, 20)
+	if len(lines) > 20 {
+		t.Errorf("rendered %d lines, want at most 20", len(lines))
+	}
+	// 3 header rows and 2 headings leave 15 rows, half of them for messages.
+	msgs := 0
+	for _, l := range lines {
+		if strings.Contains(l, "obs_st") {
+			msgs++
+		}
+	}
+	if msgs != 7 {
+		t.Errorf("showed %d messages, want 7", msgs)
+	}
+	for _, l := range lines {
+		if n := utf8.RuneCountInString(l); n > 60 {
+			t.Errorf("line has %d runes, want at most 60", n)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("a\x1b[2Jb", 10); got != "a [2Jb" {
+		t.Errorf("control characters not stripped: %q", got)
+	}
+	if got := truncate("héllo world", 5); got != "héll…" {
+		t.Errorf("truncate = %q", got)
+	}
+}
+
+func TestWatchUI_Run(t *testing.T) {
+	u := newWatchUI(NewCollector("12345", "backyard"), "54321")
+	var out strings.Builder
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u.Run(ctx, &out, func() (int, int) { return 80, 24 })
+
+	s := out.String()
+	if !strings.HasPrefix(s, ansiAltScreen) || !strings.HasSuffix(s, ansiMainScreen) {
+		t.Error("Run should switch to the alternate screen and back")
+	}
+	if !strings.Contains(s, "Waiting for the first observation") {
+		t.Error("Run should draw a frame before returning")
+	}
+}
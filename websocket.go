@@ -3,224 +3,560 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
 	"github.com/coder/websocket"
 )
 
-const defaultWSURL = "wss://ws.weatherflow.com/swd/data"
+const defaultWSURL = weatherflow.DefaultStreamURL
 
-// readTimeout is the maximum time to wait for a single WebSocket message.
+// defaultReadTimeout is the maximum time to wait for a single WebSocket message.
 // obs_st arrives every ~60s; 5 minutes accommodates network jitter.
-const readTimeout = 5 * time.Minute
+const defaultReadTimeout = 5 * time.Minute
 
-// Client manages the WebSocket connection to the Tempest API.
+const (
+	// defaultMinBackoff is the ceiling of the first reconnect delay.
+	defaultMinBackoff = time.Second
+	// defaultMaxBackoff caps the delay between reconnect attempts.
+	defaultMaxBackoff = 60 * time.Second
+	// defaultBackoffReset is how long a connection must stay up before the
+	// backoff starts over.
+	defaultBackoffReset = 2 * time.Minute
+	// defaultBreakerFailures is how many connections in a row may fail
+	// without an observation before the circuit breaker opens.
+	defaultBreakerFailures = 5
+	// defaultBreakerCooldown is how long an open breaker keeps the client
+	// from reconnecting.
+	defaultBreakerCooldown = 5 * time.Minute
+)
+
+// defaultFatalRetryInterval is the delay between attempts after the token or
+// the configuration was rejected. A reload retries immediately.
+const defaultFatalRetryInterval = 30 * time.Minute
+
+// errorClass says how Run reacts to a connection failure.
+type errorClass int
+
+const (
+	// errNetwork is a network failure or server error; Run reconnects with
+	// the fast exponential backoff.
+	errNetwork errorClass = iota
+	// errRateLimited means the server refused the connection with 429; Run
+	// waits the maximum backoff.
+	errRateLimited
+	// errAuth means the token was rejected.
+	errAuth
+	// errConfig means the settings can never work, e.g. a non-numeric
+	// device ID or a URL the server doesn't know.
+	errConfig
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case errRateLimited:
+		return "rate_limit"
+	case errAuth:
+		return "auth"
+	case errConfig:
+		return "config"
+	}
+	return "network"
+}
+
+// fatal reports whether retrying with the same settings cannot succeed.
+func (c errorClass) fatal() bool {
+	return c == errAuth || c == errConfig
+}
+
+// errorClasses lists every class, for metrics.
+var errorClasses = []errorClass{errNetwork, errRateLimited, errAuth, errConfig}
+
+// disconnectReasons lists the values of the reason label of
+// tempest_websocket_disconnects_total.
+var disconnectReasons = []string{
+	"dial_failed", "auth", "config", "rate_limit",
+	"read_timeout", "stale", "closed", "reconfigure",
+}
+
+// disconnectReason names why a connection ended, for metrics. A
+// reconfiguration is counted by reconnectDelay.
+func disconnectReason(err error) string {
+	switch {
+	case errors.Is(err, errStale):
+		return "stale"
+	case errors.Is(err, weatherflow.ErrReadTimeout):
+		return "read_timeout"
+	}
+	if class := classify(err); class != errNetwork {
+		return class.String()
+	}
+	if errors.Is(err, weatherflow.ErrDial) {
+		return "dial_failed"
+	}
+	return "closed"
+}
+
+// classify returns the class of the error that ended a connection.
+// Unclassified errors are network errors.
+func classify(err error) errorClass {
+	var se *weatherflow.StatusError
+	switch {
+	case errors.Is(err, weatherflow.ErrInvalidDeviceID):
+		return errConfig
+	case errors.As(err, &se):
+		return handshakeClass(se.StatusCode)
+	case websocket.CloseStatus(err) == websocket.StatusPolicyViolation:
+		// The server closes with policy violation when it rejects the
+		// token after the handshake.
+		return errAuth
+	}
+	return errNetwork
+}
+
+// handshakeClass classifies a rejected WebSocket handshake by its HTTP status.
+func handshakeClass(status int) errorClass {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return errAuth
+	case status == http.StatusTooManyRequests:
+		return errRateLimited
+	case status >= 400 && status < 500:
+		return errConfig
+	}
+	return errNetwork
+}
+
+// Client manages the WebSocket connection to the Tempest API. The
+// connection is a weatherflow.Stream; Client adds the reconnect policy,
+// the stream watchdog and the metrics through its hooks, and the collector
+// is the first of its subscribers.
 type Client struct {
-	token    string
-	deviceID string
-	wsURL    string
+	token     string
+	deviceID  string
+	wsURL     string
 	collector *Collector
 
+	readTimeout time.Duration
+	// minBackoff and maxBackoff bound the jittered reconnect delay, which
+	// starts over once a connection has stayed up for backoffReset.
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	backoffReset time.Duration
+	// breakerFailures connections in a row that end without an observation
+	// open the circuit breaker: the collector reports it so the REST
+	// fallback takes over at once, and the client waits breakerCooldown
+	// before trying again. 0 disables the breaker.
+	breakerFailures int
+	breakerCooldown time.Duration
+	// fatalRetry is the delay after an auth or config error; 0 waits for
+	// Reconfigure.
+	fatalRetry time.Duration
+	// ackTimeout, staleIntervals, reportInterval and checkInterval control
+	// the stream watchdog; see wsmonitor.go.
+	ackTimeout     time.Duration
+	staleIntervals int
+	reportInterval time.Duration
+	checkInterval  time.Duration
+	// stream tracks the current connection's subscription; nil between
+	// connections and during replay.
+	stream atomic.Pointer[streamState]
+	// tokenInURL sends the token as the token query parameter, the only
+	// form WeatherFlow documents for the WebSocket; when false it goes in
+	// an Authorization header.
+	tokenInURL bool
+
 	// parseErrors tracks consecutive unparseable messages for rate-limited logging.
 	parseErrors atomic.Int64
+
+	// listeners receive every well-formed message read from the upstream connection.
+	listeners []func(msgType string, data []byte)
+	// errorListeners receive every message that could not be parsed.
+	errorListeners []func(msgType string, data []byte, err error)
+
+	// subscribers receive every typed event, in order.
+	subscribers []func(weatherflow.Event)
+	// rapidWind requests 3-second rapid_wind samples with listen_rapid_start.
+	rapidWind bool
+
+	// upstreamOnce builds upstreamStream from the settings above on first
+	// use, so they can be set between NewClient and Run.
+	upstreamOnce   sync.Once
+	upstreamStream *weatherflow.Stream
+
+	// mu guards token, deviceID and rapidWind once Run has started.
+	mu sync.Mutex
+	// reconfigured is set by Reconfigure so the next reconnect starts the
+	// backoff and the circuit breaker over.
+	reconfigured atomic.Bool
+
+	// backoff, failures and connReceived belong to the stream's goroutine.
+	// failures counts connections in a row that ended without an
+	// observation; connReceived is whether the last one had any.
+	backoff      *weatherflow.Backoff
+	failures     int
+	connReceived bool
 }
 
-// NewClient creates a new WebSocket client.
+// NewClient creates a new WebSocket client. collector receives the
+// connection health metrics and, as the first subscriber, every event.
 func NewClient(token, deviceID string, collector *Collector) *Client {
-	return &Client{
-		token:    token,
-		deviceID: deviceID,
-		wsURL:    defaultWSURL,
+	c := &Client{
+		token:     token,
+		deviceID:  deviceID,
+		wsURL:     defaultWSURL,
 		collector: collector,
+
+		readTimeout:     defaultReadTimeout,
+		minBackoff:      defaultMinBackoff,
+		maxBackoff:      defaultMaxBackoff,
+		backoffReset:    defaultBackoffReset,
+		breakerFailures: defaultBreakerFailures,
+		breakerCooldown: defaultBreakerCooldown,
+		fatalRetry:      defaultFatalRetryInterval,
+		tokenInURL:      true,
+
+		ackTimeout:     defaultAckTimeout,
+		staleIntervals: defaultStaleIntervals,
+		reportInterval: defaultReportInterval,
+		checkInterval:  defaultCheckInterval,
 	}
+	c.Subscribe(collector.HandleEvent)
+	return c
 }
 
-// Run maintains a persistent WebSocket connection with exponential backoff reconnection.
-// It blocks until the context is cancelled.
-func (c *Client) Run(ctx context.Context) {
-	backoff := time.Second
-	const maxBackoff = 60 * time.Second
-
-	for {
-		start := time.Now()
-		err := c.connectAndRead(ctx)
-		if ctx.Err() != nil {
-			return
-		}
+// OnMessage registers fn to be called with the raw bytes of every JSON message
+// received from the upstream WebSocket, before it is dispatched. Listeners must
+// not block or modify data. OnMessage must be called before Run.
+func (c *Client) OnMessage(fn func(msgType string, data []byte)) {
+	c.listeners = append(c.listeners, fn)
+}
 
-		c.collector.SetConnected(false)
-		c.collector.IncrReconnects()
+// OnParseError registers fn to be called for every message that could not be
+// parsed, with its type ("" if the envelope itself was invalid). Listeners must
+// not block or modify data. OnParseError must be called before Run.
+func (c *Client) OnParseError(fn func(msgType string, data []byte, err error)) {
+	c.errorListeners = append(c.errorListeners, fn)
+}
 
-		// Reset backoff if the connection was up for a while
-		if time.Since(start) > 2*time.Minute {
-			backoff = time.Second
-		}
+// Parse failure stages, for metrics; see weatherflow.ParseError.
+const (
+	stageEnvelope = weatherflow.StageEnvelope
+	stageMessage  = weatherflow.StageMessage
+	stageFields   = weatherflow.StageFields
+)
 
-		slog.Warn("websocket disconnected",
-			"error", err,
-			"reconnect_in", backoff,
-		)
+// parseStages lists every stage, for metrics.
+var parseStages = []string{stageEnvelope, stageMessage, stageFields}
 
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(backoff):
-		}
+// messageTypes lists the upstream message types counted by name; others are
+// counted as "unknown".
+var messageTypes = []string{
+	"obs_st", "evt_strike", "evt_precip", "rapid_wind",
+	"evt_device_online", "evt_device_offline", "device_status",
+	"ack", "connection_opened",
+}
 
-		backoff *= 2
-		if backoff > maxBackoff {
-			backoff = maxBackoff
-		}
+// parseError counts a message that failed at stage and notifies the error
+// listeners.
+func (c *Client) parseError(stage, msgType string, data []byte, err error) {
+	c.collector.IncrParseErrors(stage)
+	for _, fn := range c.errorListeners {
+		fn(msgType, data, err)
 	}
 }
 
-// connectAndRead dials the WebSocket, sends listen_start, and reads messages.
-// Returns on error or context cancellation.
-func (c *Client) connectAndRead(ctx context.Context) error {
-	dialOpts := &websocket.DialOptions{
-		HTTPClient: &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					MinVersion: tls.VersionTLS12,
-				},
-			},
-		},
+// Subscribe registers fn to be called with every typed event decoded from
+// the upstream connection or a replay, in order. Subscribers must not block.
+// Subscribe must be called before Run.
+func (c *Client) Subscribe(fn func(weatherflow.Event)) {
+	c.subscribers = append(c.subscribers, fn)
+}
+
+// SetEventBus publishes typed strike, rain start and rapid wind events to bus.
+// It must be called before Run.
+func (c *Client) SetEventBus(bus *EventBus) {
+	c.Subscribe(bus.publishStreamEvent)
+}
+
+// EnableRapidWind subscribes to 3-second rapid_wind samples in addition to
+// obs_st. It must be called before Run.
+func (c *Client) EnableRapidWind() {
+	c.rapidWind = true
+}
+
+// Reconfigure changes the token, device and rapid wind subscription. If
+// anything changed, the current connection is closed and Run reconnects
+// immediately with the new settings. It is safe to call while Run is running.
+func (c *Client) Reconfigure(token, deviceID string, rapidWind bool) {
+	c.mu.Lock()
+	changed := token != c.token || deviceID != c.deviceID || rapidWind != c.rapidWind
+	c.token, c.deviceID, c.rapidWind = token, deviceID, rapidWind
+	c.mu.Unlock()
+	if !changed {
+		return
 	}
 
-	url := fmt.Sprintf("%s?token=%s", c.wsURL, c.token)
-	conn, _, err := websocket.Dial(ctx, url, dialOpts)
+	c.reconfigured.Store(true)
+	c.upstream().Reconfigure(token, parseDeviceID(deviceID), rapidWind)
+}
+
+// subscription returns the current token, device and rapid wind setting.
+func (c *Client) subscription() (token, deviceID string, rapidWind bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.deviceID, c.rapidWind
+}
+
+// parseDeviceID returns deviceID as a number. device_id must be a number
+// per the WeatherFlow API spec; anything else becomes 0, which the stream
+// rejects before using up a connection.
+func parseDeviceID(deviceID string) int {
+	n, err := strconv.Atoi(deviceID)
 	if err != nil {
-		// Do not wrap the dial error directly — it may contain the URL with the token.
-		return fmt.Errorf("websocket dial failed: %v", redactToken(err.Error(), c.token))
+		return 0
 	}
-	defer func() { _ = conn.CloseNow() }()
+	return n
+}
 
-	// Send listen_start to subscribe to device observations.
-	// device_id must be a number per the WeatherFlow API spec.
-	deviceIDNum, err := strconv.Atoi(c.deviceID)
-	if err != nil {
-		return fmt.Errorf("invalid device_id %q: %w", c.deviceID, err)
+// upstream returns the stream, building it from the client's settings on
+// first use.
+func (c *Client) upstream() *weatherflow.Stream {
+	c.upstreamOnce.Do(func() {
+		token, deviceID, rapidWind := c.subscription()
+		opts := []weatherflow.StreamOption{
+			weatherflow.WithStreamURL(c.wsURL),
+			weatherflow.WithStreamHTTPClient(&http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						MinVersion: tls.VersionTLS12,
+					},
+				},
+			}),
+			weatherflow.WithReadTimeout(c.readTimeout),
+			weatherflow.WithSubscriptionID(subscriptionID),
+			weatherflow.WithReconnectPolicy(c.reconnectDelay),
+		}
+		if !c.tokenInURL {
+			opts = append(opts, weatherflow.WithTokenInHeader())
+		}
+		if rapidWind {
+			opts = append(opts, weatherflow.WithRapidWind())
+		}
+		s := weatherflow.NewStream(token, parseDeviceID(deviceID), opts...)
+
+		c.backoff = weatherflow.NewBackoff(c.minBackoff, c.maxBackoff)
+		s.OnConnect(c.connected)
+		s.OnDisconnect(c.disconnected)
+		s.OnMessage(c.message)
+		for _, fn := range c.subscribers {
+			s.Subscribe(fn)
+		}
+		s.Subscribe(c.event)
+		c.upstreamStream = s
+	})
+	return c.upstreamStream
+}
+
+// Run maintains a persistent WebSocket connection, reconnecting after a
+// jittered exponential backoff. Network errors are retried quickly. After an
+// auth or config error the client reports the failure to the collector and
+// retries only every fatalRetry, or as soon as Reconfigure changes the
+// settings. After breakerFailures connections in a row without an
+// observation the circuit breaker opens and the client waits
+// breakerCooldown. It blocks until the context is cancelled.
+func (c *Client) Run(ctx context.Context) {
+	// reconnectDelay never stops the stream, so it only returns with ctx.
+	_ = c.upstream().Run(ctx)
+}
+
+// reconnectDelay is the stream's reconnect policy; see Run.
+func (c *Client) reconnectDelay(d weatherflow.Disconnect) (time.Duration, error) {
+	received := c.connReceived
+	c.connReceived = false
+	c.collector.SetConnected(false)
+	if c.reconfigured.Swap(false) {
+		c.backoff.Reset()
+		c.failures = 0
 	}
-	listenMsg := map[string]any{
-		"type":      "listen_start",
-		"device_id": deviceIDNum,
-		"id":        "tempest-exporter",
+	if errors.Is(d.Err, weatherflow.ErrReconfigured) {
+		slog.Info("websocket reconnecting with new settings")
+		c.collector.IncrDisconnects("reconfigure")
+		return 0, nil
 	}
-	data, err := json.Marshal(listenMsg)
-	if err != nil {
-		return fmt.Errorf("marshal listen_start: %w", err)
+
+	err := d.Err
+	if errors.Is(err, weatherflow.ErrInvalidDeviceID) {
+		_, deviceID, _ := c.subscription()
+		err = fmt.Errorf("invalid device_id %q: %w", deviceID, err)
 	}
-	if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
-		return fmt.Errorf("send listen_start: %v", redactToken(err.Error(), c.token))
+	c.collector.IncrReconnects()
+	class := classify(err)
+	c.collector.IncrWebSocketErrors(class.String())
+	c.collector.IncrDisconnects(disconnectReason(err))
+	if received {
+		c.failures = 0
+	} else {
+		c.failures++
 	}
 
-	c.collector.SetConnected(true)
-	slog.Info("websocket connected", "device_id", c.deviceID)
+	// Start the backoff over if the connection was up for a while
+	if d.Uptime >= c.backoffReset {
+		c.backoff.Reset()
+	}
 
-	c.parseErrors.Store(0)
-	return c.readLoop(ctx, conn)
-}
-
-// readLoop reads and dispatches WebSocket messages until error or context cancellation.
-func (c *Client) readLoop(ctx context.Context, conn *websocket.Conn) error {
-	for {
-		// Apply a per-message read timeout so we don't block forever
-		// if the server stops sending data.
-		readCtx, readCancel := context.WithTimeout(ctx, readTimeout)
-		_, data, err := conn.Read(readCtx)
-		readCancel()
-		if err != nil {
-			return fmt.Errorf("read: %v", redactToken(err.Error(), c.token))
+	switch {
+	case class.fatal():
+		c.collector.SetWebSocketFailure(class.String(), err.Error())
+		slog.Error("websocket connection rejected; fix the configuration and reload",
+			"class", class,
+			"error", err,
+			"retry_in", c.fatalRetry,
+		)
+		if c.fatalRetry <= 0 {
+			// Wait for Reconfigure.
+			return -1, nil
 		}
+		return c.fatalRetry, nil
+	case c.breakerFailures > 0 && c.failures >= c.breakerFailures:
+		c.collector.SetCircuitOpen(true)
+		slog.Warn("websocket circuit breaker open, REST fallback takes over",
+			"failures", c.failures,
+			"error", err,
+			"retry_in", c.breakerCooldown,
+		)
+		return c.breakerCooldown, nil
+	case class == errRateLimited:
+		slog.Warn("websocket connection rate limited",
+			"error", err,
+			"reconnect_in", c.maxBackoff,
+		)
+		return c.maxBackoff, nil
+	}
+	delay := c.backoff.Next()
+	slog.Warn("websocket disconnected",
+		"error", err,
+		"reconnect_in", delay.Round(time.Millisecond),
+	)
+	return delay, nil
+}
 
-		var envelope WSMessage
-		if err := json.Unmarshal(data, &envelope); err != nil {
-			count := c.parseErrors.Add(1)
-			// Rate-limit: log first occurrence, then every 100th
-			if count == 1 || count%100 == 0 {
-				slog.Warn("ignoring unparseable message",
-					"error", err,
-					"total_parse_errors", count,
-				)
-			}
-			continue
-		}
+// connected starts the watchdog for a new connection. The collector is
+// marked connected once observations arrive, not when the socket opens;
+// see wsmonitor.go.
+func (c *Client) connected(conn *weatherflow.Conn) {
+	st := newStreamState(conn.Opened(), c.reportInterval)
+	c.stream.Store(st)
+	c.parseErrors.Store(0)
+	go c.watchStream(conn, st)
+	slog.Info("websocket connected, waiting for observations", "device_id", conn.DeviceID())
+}
 
-		switch envelope.Type {
-		case "obs_st":
-			c.handleObsST(data)
-		case "evt_strike":
-			c.handleStrike(data)
-		case "evt_precip":
-			c.handlePrecip(data)
-		case "ack", "connection_opened":
-			slog.Info("received control message", "type", envelope.Type)
-		default:
-			slog.Warn("ignoring unknown message type", "type", envelope.Type)
-		}
+// disconnected records how a connection went for reconnectDelay, which the
+// stream calls next.
+func (c *Client) disconnected(conn *weatherflow.Conn, _ error) {
+	if st := c.stream.Swap(nil); st != nil {
+		c.connReceived = st.received()
 	}
+	c.collector.ObserveConnectionDuration(time.Since(conn.Opened()))
 }
 
-func (c *Client) handleObsST(data []byte) {
-	var msg ObsSTMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
-		slog.Error("error parsing obs_st", "error", err)
-		return
-	}
-	if len(msg.Obs) == 0 {
-		slog.Warn("obs_st with empty obs array")
-		return
+// dispatch handles one message from a recording as if it had been read from
+// the upstream connection.
+func (c *Client) dispatch(data []byte) {
+	c.upstream().Dispatch(data)
+}
+
+// message counts and logs one upstream message and passes it to the
+// listeners, before the stream delivers its event to the subscribers. conn
+// is nil for a replayed message.
+func (c *Client) message(conn *weatherflow.Conn, data []byte, msg weatherflow.Message, err error) {
+	if conn != nil {
+		c.collector.AddReceivedBytes(len(data))
 	}
-	obs, err := ParseObservation(msg.Obs[0])
-	if err != nil {
-		slog.Error("error parsing observation", "error", err)
+	var pe *weatherflow.ParseError
+	if errors.As(err, &pe) && pe.Stage == stageEnvelope {
+		c.parseError(pe.Stage, "", data, err)
+		count := c.parseErrors.Add(1)
+		// Rate-limit: log first occurrence, then every 100th
+		if count == 1 || count%100 == 0 {
+			slog.Warn("ignoring unparseable message",
+				"error", err,
+				"total_parse_errors", count,
+			)
+		}
 		return
 	}
-	c.collector.UpdateObservation(obs)
-	slog.Info("observation updated",
-		"air_temp_c", obs.AirTemperature,
-		"humidity_pct", obs.RelativeHumidity,
-		"wind_mps", obs.WindAvg,
-		"pressure_mb", obs.StationPressure,
-	)
-}
 
-func (c *Client) handleStrike(data []byte) {
-	var msg StrikeEvent
-	if err := json.Unmarshal(data, &msg); err != nil {
-		slog.Error("error parsing evt_strike", "error", err)
+	for _, fn := range c.listeners {
+		fn(msg.Type, data)
+	}
+	c.collector.IncrMessages(msg.Type)
+	if pe != nil {
+		slog.Error("error parsing message", "type", msg.Type, "error", err)
+		c.parseError(pe.Stage, msg.Type, data, err)
 		return
 	}
-	if len(msg.Evt) >= 3 {
-		dist := toFloat(msg.Evt[1])
-		energy := toFloat(msg.Evt[2])
-		if !math.IsNaN(dist) {
-			slog.Info("lightning strike detected",
-				"distance_km", dist,
-				"energy", energy,
-			)
+
+	switch msg.Type {
+	case "ack":
+		slog.Info("received control message", "type", msg.Type, "id", msg.ID)
+		if st := c.stream.Load(); st != nil {
+			st.ack(msg.ID)
+		}
+	case "connection_opened":
+		slog.Info("received control message", "type", msg.Type)
+	default:
+		if ev, ok := msg.Event.(weatherflow.DeviceStatus); ok {
+			slog.Info("device status", "type", msg.Type, "online", ev.Online)
+		} else if !slices.Contains(messageTypes, msg.Type) {
+			slog.Warn("ignoring unknown message type", "type", msg.Type)
 		}
 	}
 }
 
-func (c *Client) handlePrecip(data []byte) {
-	var msg PrecipEvent
-	if err := json.Unmarshal(data, &msg); err != nil {
-		slog.Error("error parsing evt_precip", "error", err)
-		return
+// event is the last subscriber: it records the stream health of
+// observations and logs the events worth noting.
+func (c *Client) event(ev weatherflow.Event) {
+	switch ev := ev.(type) {
+	case Observation:
+		c.observed(ev)
+	case Strike:
+		slog.Info("lightning strike detected",
+			"distance_km", ev.Distance,
+			"energy", ev.Energy,
+		)
+	case PrecipStart:
+		slog.Info("rain start event", "epoch", ev.Timestamp)
 	}
-	if len(msg.Evt) >= 1 {
-		epoch := toFloat(msg.Evt[0])
-		if !math.IsNaN(epoch) {
-			c.collector.SetRainStart(epoch)
-			slog.Info("rain start event", "epoch", epoch)
+}
+
+// observed records the stream health of an observation the subscribers
+// have received.
+func (c *Client) observed(obs Observation) {
+	// Latency is only meaningful for live messages, not replayed ones.
+	if st := c.stream.Load(); st != nil {
+		now := time.Now()
+		if obs.Timestamp > 0 {
+			c.collector.ObserveDeliveryLatency(now.Sub(time.Unix(obs.Timestamp, 0)))
 		}
+		if st.observation(now, obs.ReportInterval) {
+			c.collector.ObserveFirstObservation(now.Sub(st.opened))
+		}
+		c.collector.SetConnected(true)
 	}
+	slog.Info("observation updated",
+		"air_temp_c", obs.AirTemperature,
+		"humidity_pct", obs.RelativeHumidity,
+		"wind_mps", obs.WindAvg,
+		"pressure_mb", obs.StationPressure,
+	)
 }
@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
 	"github.com/coder/websocket"
 )
 
@@ -19,34 +23,16 @@ func newTestClient() (*Client, *Collector) {
 	return client, c
 }
 
+// connectOnce makes one upstream connection and reads until it ends.
+func connectOnce(ctx context.Context, c *Client) error {
+	return c.upstream().RunOnce(ctx)
+}
+
 func TestHandleObsST_Valid(t *testing.T) {
 	client, collector := newTestClient()
 
-	msg := ObsSTMessage{
-		Type: "obs_st",
-		Obs: [][]any{{
-			float64(1700000000), // timestamp
-			float64(0.5),        // wind lull
-			float64(1.2),        // wind avg
-			float64(2.3),        // wind gust
-			float64(180),        // wind direction
-			float64(3),          // wind sample interval
-			float64(1013.25),    // station pressure
-			float64(22.5),       // air temperature
-			float64(65.0),       // relative humidity
-			float64(50000),      // illuminance
-			float64(3.5),        // UV
-			float64(300),        // solar radiation
-			float64(0.1),        // rain accumulated
-			float64(1),          // precipitation type
-			float64(10),         // lightning strike avg distance
-			float64(2),          // lightning strike count
-			float64(2.65),       // battery
-			float64(60),         // report interval
-		}},
-	}
-	data, _ := json.Marshal(msg)
-	client.handleObsST(data)
+	data := []byte(`{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65.0,50000,3.5,300,0.1,1,10,2,2.65,60]]}`)
+	client.dispatch(data)
 
 	if !collector.HasObservation() {
 		t.Fatal("expected observation to be stored")
@@ -66,7 +52,7 @@ func TestHandleObsST_Valid(t *testing.T) {
 
 func TestHandleObsST_InvalidJSON(t *testing.T) {
 	client, collector := newTestClient()
-	client.handleObsST([]byte(`{invalid json`))
+	client.dispatch([]byte(`{invalid json`))
 
 	if collector.HasObservation() {
 		t.Fatal("should not store observation on invalid JSON")
@@ -76,9 +62,8 @@ func TestHandleObsST_InvalidJSON(t *testing.T) {
 func TestHandleObsST_EmptyObs(t *testing.T) {
 	client, collector := newTestClient()
 
-	msg := ObsSTMessage{Type: "obs_st", Obs: [][]any{}}
-	data, _ := json.Marshal(msg)
-	client.handleObsST(data)
+	data := []byte(`{"type":"obs_st","obs":[]}`)
+	client.dispatch(data)
 
 	if collector.HasObservation() {
 		t.Fatal("should not store observation on empty obs array")
@@ -88,12 +73,8 @@ func TestHandleObsST_EmptyObs(t *testing.T) {
 func TestHandleObsST_ShortArray(t *testing.T) {
 	client, collector := newTestClient()
 
-	msg := ObsSTMessage{
-		Type: "obs_st",
-		Obs:  [][]any{{float64(1700000000), float64(1.0)}},
-	}
-	data, _ := json.Marshal(msg)
-	client.handleObsST(data)
+	data := []byte(`{"type":"obs_st","obs":[[1700000000,1.0]]}`)
+	client.dispatch(data)
 
 	if collector.HasObservation() {
 		t.Fatal("should not store observation on short array")
@@ -103,32 +84,24 @@ func TestHandleObsST_ShortArray(t *testing.T) {
 func TestHandleStrike_Valid(t *testing.T) {
 	client, _ := newTestClient()
 
-	msg := StrikeEvent{
-		Type: "evt_strike",
-		Evt:  []any{float64(1700000000), float64(15.5), float64(100)},
-	}
-	data, _ := json.Marshal(msg)
+	data := []byte(`{"type":"evt_strike","evt":[1700000000,15.5,100]}`)
 
 	// Should not panic; verifies the handler processes correctly
-	client.handleStrike(data)
+	client.dispatch(data)
 }
 
 func TestHandleStrike_InvalidJSON(t *testing.T) {
 	client, _ := newTestClient()
 	// Should not panic
-	client.handleStrike([]byte(`not json`))
+	client.dispatch([]byte(`not json`))
 }
 
 func TestHandleStrike_ShortEvt(t *testing.T) {
 	client, _ := newTestClient()
 
-	msg := StrikeEvent{
-		Type: "evt_strike",
-		Evt:  []any{float64(1700000000)}, // only 1 element, need >= 3
-	}
-	data, _ := json.Marshal(msg)
+	data := []byte(`{"type":"evt_strike","evt":[1700000000]}`) // only 1 element, need >= 3
 	// Should not panic
-	client.handleStrike(data)
+	client.dispatch(data)
 }
 
 func TestHandleStrike_NullDistance(t *testing.T) {
@@ -137,18 +110,14 @@ func TestHandleStrike_NullDistance(t *testing.T) {
 	// Manually build JSON with null distance
 	data := []byte(`{"type":"evt_strike","evt":[1700000000,null,100]}`)
 	// Should not panic — null distance becomes NaN, so the log branch is skipped
-	client.handleStrike(data)
+	client.dispatch(data)
 }
 
 func TestHandlePrecip_Valid(t *testing.T) {
 	client, collector := newTestClient()
 
-	msg := PrecipEvent{
-		Type: "evt_precip",
-		Evt:  []any{float64(1700000000)},
-	}
-	data, _ := json.Marshal(msg)
-	client.handlePrecip(data)
+	data := []byte(`{"type":"evt_precip","evt":[1700000000]}`)
+	client.dispatch(data)
 
 	collector.mu.RLock()
 	rainStart := collector.rainStart
@@ -162,15 +131,14 @@ func TestHandlePrecip_Valid(t *testing.T) {
 func TestHandlePrecip_InvalidJSON(t *testing.T) {
 	client, _ := newTestClient()
 	// Should not panic
-	client.handlePrecip([]byte(`garbage`))
+	client.dispatch([]byte(`garbage`))
 }
 
 func TestHandlePrecip_EmptyEvt(t *testing.T) {
 	client, collector := newTestClient()
 
-	msg := PrecipEvent{Type: "evt_precip", Evt: []any{}}
-	data, _ := json.Marshal(msg)
-	client.handlePrecip(data)
+	data := []byte(`{"type":"evt_precip","evt":[]}`)
+	client.dispatch(data)
 
 	collector.mu.RLock()
 	rainStart := collector.rainStart
@@ -185,7 +153,7 @@ func TestHandlePrecip_NullEpoch(t *testing.T) {
 	client, collector := newTestClient()
 
 	data := []byte(`{"type":"evt_precip","evt":[null]}`)
-	client.handlePrecip(data)
+	client.dispatch(data)
 
 	collector.mu.RLock()
 	rainStart := collector.rainStart
@@ -196,6 +164,36 @@ func TestHandlePrecip_NullEpoch(t *testing.T) {
 	}
 }
 
+func TestClient_Subscribe(t *testing.T) {
+	client, collector := newTestClient()
+	var got []weatherflow.Event
+	client.Subscribe(func(ev weatherflow.Event) {
+		// The collector subscribed first, so it already has the observation.
+		if _, ok := ev.(Observation); ok && !collector.HasObservation() {
+			t.Error("observation delivered before the collector stored it")
+		}
+		got = append(got, ev)
+	})
+
+	client.dispatch([]byte(`{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,60]]}`))
+	client.dispatch([]byte(`{"type":"ack","id":"tempest-exporter"}`))
+	client.dispatch([]byte(`{"type":"evt_device_offline","device_id":12345,"evt":[1700000060]}`))
+	client.dispatch([]byte(`{"type":"evt_precip","evt":[1700000120]}`))
+
+	if len(got) != 3 {
+		t.Fatalf("subscriber got %d events, want 3: %#v", len(got), got)
+	}
+	if obs, ok := got[0].(Observation); !ok || obs.AirTemperature != 22.5 {
+		t.Errorf("event 0 = %#v, want the observation", got[0])
+	}
+	if got[1] != (weatherflow.DeviceStatus{Timestamp: 1700000060}) {
+		t.Errorf("event 1 = %#v, want device offline", got[1])
+	}
+	if got[2] != (PrecipStart{Timestamp: 1700000120}) {
+		t.Errorf("event 2 = %#v, want rain start", got[2])
+	}
+}
+
 func TestNewClient(t *testing.T) {
 	c := NewCollector("12345", "backyard")
 	client := NewClient("token", "device", c)
@@ -211,17 +209,6 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
-func TestRedactToken_InError(t *testing.T) {
-	// Simulate what happens when a dial error contains the token
-	token := "abc123secret"
-	errMsg := "dial wss://ws.weatherflow.com/swd/data?token=" + token + ": connection refused"
-	redacted := redactToken(errMsg, token)
-
-	if redacted != "dial wss://ws.weatherflow.com/swd/data?token=[REDACTED]: connection refused" {
-		t.Errorf("token not redacted: %s", redacted)
-	}
-}
-
 func TestParseErrors_RateLimiting(t *testing.T) {
 	client, _ := newTestClient()
 
@@ -242,7 +229,7 @@ func TestHandleObsST_NullFields(t *testing.T) {
 
 	// Build JSON with null fields in the obs array
 	data := []byte(`{"type":"obs_st","obs":[[1700000000,null,1.2,null,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,null,null,2.65,60]]}`)
-	client.handleObsST(data)
+	client.dispatch(data)
 
 	if !collector.HasObservation() {
 		t.Fatal("expected observation to be stored even with null fields")
@@ -316,11 +303,11 @@ func TestConnectAndRead_ObsST(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	// connectAndRead dials, sends listen_start, and reads until server closes
-	err := client.connectAndRead(ctx)
+	// connectOnce dials, sends listen_start, and reads until server closes
+	err := connectOnce(ctx, client)
 	// Server closes the connection after sending messages, so we expect an error
 	if err == nil {
-		t.Log("connectAndRead exited without error")
+		t.Log("connectOnce exited without error")
 	}
 
 	if !collector.HasObservation() {
@@ -354,7 +341,7 @@ func TestConnectAndRead_MultipleMessageTypes(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	_ = client.connectAndRead(ctx)
+	_ = connectOnce(ctx, client)
 
 	if !collector.HasObservation() {
 		t.Error("expected observation from obs_st message")
@@ -380,12 +367,12 @@ func TestConnectAndRead_InvalidDeviceID(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	err := client.connectAndRead(ctx)
+	err := connectOnce(ctx, client)
 	if err == nil {
 		t.Fatal("expected error for invalid device_id")
 	}
-	if !strings.Contains(err.Error(), "invalid device_id") {
-		t.Errorf("expected 'invalid device_id' in error, got: %v", err)
+	if !errors.Is(err, weatherflow.ErrInvalidDeviceID) || classify(err) != errConfig {
+		t.Errorf("expected a config error for the invalid device_id, got: %v", err)
 	}
 }
 
@@ -397,7 +384,7 @@ func TestConnectAndRead_DialFailure(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	err := client.connectAndRead(ctx)
+	err := connectOnce(ctx, client)
 	if err == nil {
 		t.Fatal("expected error for unreachable server")
 	}
@@ -459,9 +446,13 @@ func TestRun_BackoffIncreases(t *testing.T) {
 	collector := NewCollector("12345", "backyard")
 	client := NewClient("test-token", "12345", collector)
 	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	client.minBackoff = 100 * time.Millisecond
+	client.maxBackoff = 400 * time.Millisecond
+	client.breakerFailures = 0
 
-	// Run for 3.5s — should hit: connect, 1s wait, connect, 2s wait, then cancel
-	ctx, cancel := context.WithTimeout(context.Background(), 3500*time.Millisecond)
+	// Jittered delays stay below 100ms, 200ms and 400ms, so 1s allows at
+	// least three reconnects.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
 	done := make(chan struct{})
@@ -476,9 +467,81 @@ func TestRun_BackoffIncreases(t *testing.T) {
 	reconnects := collector.reconnects
 	collector.mu.RUnlock()
 
-	// With 1s + 2s backoff = 3s of waiting, should get at least 2 reconnects
-	if reconnects < 2 {
-		t.Errorf("expected >= 2 reconnects, got %v", reconnects)
+	if reconnects < 3 {
+		t.Errorf("expected >= 3 reconnects, got %v", reconnects)
+	}
+	collector.mu.RLock()
+	closed := collector.wsDisconnects["closed"]
+	collector.mu.RUnlock()
+	if closed != reconnects {
+		t.Errorf("disconnects{reason=closed} = %v, want %v", closed, reconnects)
+	}
+}
+
+func TestRun_CircuitBreakerOpens(t *testing.T) {
+	var attempts atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+		if err != nil {
+			return
+		}
+		_, _, _ = conn.Read(r.Context())
+		_ = conn.Close(websocket.StatusNormalClosure, "bye")
+	}))
+	defer srv.Close()
+
+	collector := NewCollector("12345", "backyard")
+	client := NewClient("test-token", "12345", collector)
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	client.minBackoff = 10 * time.Millisecond
+	client.maxBackoff = 10 * time.Millisecond
+	client.breakerFailures = 3
+	client.breakerCooldown = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !collector.CircuitOpen() {
+		if time.Now().After(deadline) {
+			t.Fatal("circuit breaker did not open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The open breaker stops reconnecting for the cooldown.
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestDisconnectReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: refused", weatherflow.ErrDial), "dial_failed"},
+		{fmt.Errorf("%w: %w", weatherflow.ErrDial, &weatherflow.StatusError{StatusCode: 401}), "auth"},
+		{fmt.Errorf("%w: %w", weatherflow.ErrDial, &weatherflow.StatusError{StatusCode: 429}), "rate_limit"},
+		{fmt.Errorf("%w: %w", weatherflow.ErrDial, &weatherflow.StatusError{StatusCode: 503}), "dial_failed"},
+		{fmt.Errorf("%w 0", weatherflow.ErrInvalidDeviceID), "config"},
+		{fmt.Errorf("reading: %w", websocket.CloseError{Code: websocket.StatusPolicyViolation}), "auth"},
+		{fmt.Errorf("%w after 5m0s: %w", weatherflow.ErrReadTimeout, context.DeadlineExceeded), "read_timeout"},
+		{fmt.Errorf("%w: no obs_st for 3m0s", errStale), "stale"},
+		{errors.New("read: EOF"), "closed"},
+	}
+	for _, tt := range tests {
+		if got := disconnectReason(tt.err); got != tt.want {
+			t.Errorf("disconnectReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
 	}
 }
 
@@ -502,7 +565,7 @@ func TestConnectAndRead_WriteError(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	err := client.connectAndRead(ctx)
+	err := connectOnce(ctx, client)
 	if err == nil {
 		t.Fatal("expected error when server closes before write")
 	}
@@ -511,7 +574,7 @@ func TestConnectAndRead_WriteError(t *testing.T) {
 	}
 }
 
-func TestReadLoop_UnparseableMessages(t *testing.T) {
+func TestConnectAndRead_UnparseableMessages(t *testing.T) {
 	messages := []string{
 		`not json at all`,
 		`also {{{ invalid`,
@@ -523,21 +586,11 @@ func TestReadLoop_UnparseableMessages(t *testing.T) {
 	collector := NewCollector("12345", "backyard")
 	client := NewClient("test-token", "12345", collector)
 
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-
-	wsTestURL := "ws" + strings.TrimPrefix(srv.URL, "http")
-	wsConn, _, err := websocket.Dial(ctx, wsTestURL+"?token=test-token", nil)
-	if err != nil {
-		t.Fatalf("dial error: %v", err)
-	}
-	defer func() { _ = wsConn.CloseNow() }()
-
-	listenMsg := map[string]any{"type": "listen_start", "device_id": 12345, "id": "tempest-exporter"}
-	data, _ := json.Marshal(listenMsg)
-	_ = wsConn.Write(ctx, websocket.MessageText, data)
-
-	_ = client.readLoop(ctx, wsConn)
+	_ = connectOnce(ctx, client)
 
 	// Despite unparseable messages, the valid obs_st should still be processed
 	if !collector.HasObservation() {
@@ -549,3 +602,356 @@ func TestReadLoop_UnparseableMessages(t *testing.T) {
 		t.Errorf("parseErrors = %d, want >= 2", client.parseErrors.Load())
 	}
 }
+
+func TestConnectAndRead_PublishesEvents(t *testing.T) {
+	messages := []string{
+		`{"type":"rapid_wind","device_id":12345,"ob":[1700000003,2.5,270]}`,
+		`{"type":"evt_strike","evt":[1700000600,15.5,100]}`,
+		`{"type":"evt_precip","evt":[1700000500]}`,
+	}
+	srv := mockWSServer(t, messages)
+	defer srv.Close()
+
+	client, _ := newTestClient()
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	bus := NewEventBus()
+	client.SetEventBus(bus)
+	events, unsubscribe := bus.Subscribe(8)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = connectOnce(ctx, client)
+
+	want := []Event{
+		{Type: EventRapidWind, Data: RapidWind{Timestamp: 1700000003, Speed: 2.5, Direction: 270}},
+		{Type: EventStrike, Data: Strike{Timestamp: 1700000600, Distance: 15.5, Energy: 100}},
+		{Type: EventPrecipStart, Data: PrecipStart{Timestamp: 1700000500}},
+	}
+	for i, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Errorf("event %d = %+v, want %+v", i, got, w)
+			}
+		default:
+			t.Fatalf("missing event %d (%s)", i, w.Type)
+		}
+	}
+}
+
+func TestConnectAndRead_RapidWindSubscription(t *testing.T) {
+	received := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.CloseNow() }()
+		for i := 0; i < 2; i++ {
+			_, data, err := conn.Read(r.Context())
+			if err != nil {
+				return
+			}
+			var msg map[string]any
+			_ = json.Unmarshal(data, &msg)
+			received <- msg["type"].(string)
+		}
+	}))
+	defer srv.Close()
+
+	client, _ := newTestClient()
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	client.EnableRapidWind()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = connectOnce(ctx, client)
+
+	if got := <-received; got != "listen_start" {
+		t.Errorf("first message = %q, want listen_start", got)
+	}
+	if got := <-received; got != "listen_rapid_start" {
+		t.Errorf("second message = %q, want listen_rapid_start", got)
+	}
+}
+
+func TestHandleRapidWind_Invalid(t *testing.T) {
+	client, _ := newTestClient()
+	bus := NewEventBus()
+	client.SetEventBus(bus)
+	events, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	client.dispatch([]byte(`not json`))
+	client.dispatch([]byte(`{"type":"rapid_wind","ob":[1700000000,1]}`))
+	client.dispatch([]byte(`{"type":"rapid_wind","ob":[null,1,2]}`))
+
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event: %+v", e)
+	default:
+	}
+}
+
+func TestConnectAndRead_ParseErrorListeners(t *testing.T) {
+	messages := []string{
+		`not json`,
+		`{"type":"obs_st","obs":[]}`,
+		`{"type":"obs_st","obs":[[1700000000,0.5]]}`,
+		`{"type":"evt_strike","evt":[1700000000]}`,
+		`{"type":"hub_status"}`,
+		`{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,60]]}`,
+	}
+	srv := mockWSServer(t, messages)
+	defer srv.Close()
+
+	collector := NewCollector("12345", "backyard")
+	client := NewClient("test-token", "12345", collector)
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	var types []string
+	client.OnParseError(func(msgType string, _ []byte, err error) {
+		if err == nil {
+			t.Error("parse error listener called with nil error")
+		}
+		types = append(types, msgType)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = connectOnce(ctx, client)
+
+	if strings.Join(types, ",") != ",obs_st,obs_st,evt_strike" {
+		t.Errorf("parse errors = %q, want invalid envelope, two obs_st and evt_strike", types)
+	}
+	if !collector.HasObservation() {
+		t.Error("valid observation after errors should be stored")
+	}
+
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+	wantMessages := map[string]float64{"obs_st": 3, "evt_strike": 1, "ack": 1, "unknown": 1}
+	for typ, want := range wantMessages {
+		if got := collector.messages[typ]; got != want {
+			t.Errorf("messages{type=%s} = %v, want %v", typ, got, want)
+		}
+	}
+	wantErrors := map[string]float64{stageEnvelope: 1, stageMessage: 0, stageFields: 3}
+	for stage, want := range wantErrors {
+		if got := collector.parseErrors[stage]; got != want {
+			t.Errorf("parse_errors{stage=%s} = %v, want %v", stage, got, want)
+		}
+	}
+	// mockWSServer sends an ack first.
+	bytes := len(`{"type":"ack","id":"tempest-exporter"}`)
+	for _, m := range messages {
+		bytes += len(m)
+	}
+	if collector.receivedBytes != float64(bytes) {
+		t.Errorf("received bytes = %v, want %d", collector.receivedBytes, bytes)
+	}
+	// The observation is from 2023, so its latency lands in +Inf.
+	if h := collector.deliveryLatency; h.count != 1 || h.counts[len(h.counts)-1] != 0 {
+		t.Errorf("delivery latency: count %d, last bucket %d; want 1 observation above all buckets", h.count, h.counts[len(h.counts)-1])
+	}
+}
+
+func TestRun_ReconfigureReconnects(t *testing.T) {
+	type received struct {
+		token, msgType string
+		deviceID       float64
+	}
+	msgs := make(chan received, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.CloseNow() }()
+		for {
+			_, data, err := ws.Read(r.Context())
+			if err != nil {
+				return
+			}
+			var msg map[string]any
+			_ = json.Unmarshal(data, &msg)
+			deviceID, _ := msg["device_id"].(float64)
+			msgType, _ := msg["type"].(string)
+			msgs <- received{r.URL.Query().Get("token"), msgType, deviceID}
+		}
+	}))
+	defer srv.Close()
+
+	collector := NewCollector("12345", "backyard")
+	client := NewClient("old-token", "12345", collector)
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	next := func() received {
+		t.Helper()
+		select {
+		case m := <-msgs:
+			return m
+		case <-time.After(3 * time.Second):
+			t.Fatal("no message")
+			return received{}
+		}
+	}
+	if m := next(); m != (received{"old-token", "listen_start", 12345}) {
+		t.Fatalf("first message = %+v", m)
+	}
+
+	// Unchanged settings don't reconnect.
+	client.Reconfigure("old-token", "12345", false)
+	client.Reconfigure("new-token", "67890", true)
+	if m := next(); m != (received{"new-token", "listen_start", 67890}) {
+		t.Errorf("after reconfigure = %+v", m)
+	}
+	if m := next(); m != (received{"new-token", "listen_rapid_start", 67890}) {
+		t.Errorf("after reconfigure = %+v", m)
+	}
+	select {
+	case m := <-msgs:
+		t.Errorf("unexpected message %+v", m)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	collector.mu.RLock()
+	reconnects := collector.reconnects
+	collector.mu.RUnlock()
+	if reconnects != 0 {
+		t.Errorf("reconnects = %v, want 0 for a reconfiguration", reconnects)
+	}
+}
+
+func TestConnectAndRead_TokenPlacement(t *testing.T) {
+	for _, inURL := range []bool{false, true} {
+		type auth struct{ header, query string }
+		got := make(chan auth, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got <- auth{r.Header.Get("Authorization"), r.URL.Query().Get("token")}
+			http.Error(w, "no", http.StatusForbidden)
+		}))
+
+		client := NewClient("s3cret+/", "12345", NewCollector("1", "test"))
+		if !client.tokenInURL {
+			t.Fatal("the token should default to the documented query parameter")
+		}
+		client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+		client.tokenInURL = inURL
+		err := connectOnce(context.Background(), client)
+		srv.Close()
+		if err == nil || strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("tokenInURL=%v: error = %v, want a dial error without the token", inURL, err)
+		}
+
+		a := <-got
+		want := auth{header: "Bearer s3cret+/"}
+		if inURL {
+			want = auth{query: "s3cret+/"}
+		}
+		if a != want {
+			t.Errorf("tokenInURL=%v: header %q, query %q; want %+v", inURL, a.header, a.query, want)
+		}
+	}
+}
+
+func TestHandshakeClass(t *testing.T) {
+	tests := []struct {
+		status int
+		want   errorClass
+	}{
+		{http.StatusUnauthorized, errAuth},
+		{http.StatusForbidden, errAuth},
+		{http.StatusTooManyRequests, errRateLimited},
+		{http.StatusNotFound, errConfig},
+		{http.StatusBadRequest, errConfig},
+		{http.StatusBadGateway, errNetwork},
+		{http.StatusServiceUnavailable, errNetwork},
+	}
+	for _, tt := range tests {
+		if got := handshakeClass(tt.status); got != tt.want {
+			t.Errorf("handshakeClass(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestConnectAndRead_InvalidDeviceIDIsConfigError(t *testing.T) {
+	dials := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { dials++ }))
+	defer srv.Close()
+
+	client := NewClient("token", "abc", NewCollector("1", "test"))
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	err := connectOnce(context.Background(), client)
+	if classify(err) != errConfig {
+		t.Errorf("error %v classified as %v, want config", err, classify(err))
+	}
+	if dials != 0 {
+		t.Errorf("dialed %d times with an invalid device ID", dials)
+	}
+}
+
+func TestRun_AuthErrorStopsRetrying(t *testing.T) {
+	var attempts atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if r.URL.Query().Get("token") != "good" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.CloseNow() }()
+		obs := `{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,1]]}`
+		_ = ws.Write(r.Context(), websocket.MessageText, []byte(obs))
+		for {
+			if _, _, err := ws.Read(r.Context()); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	collector := NewCollector("1", "test")
+	client := NewClient("revoked", "12345", collector)
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	client.fatalRetry = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("auth failure", func() bool {
+		class, _ := collector.WebSocketFailure()
+		return class == "auth"
+	})
+
+	// No further attempts while the token is unchanged.
+	time.Sleep(1500 * time.Millisecond)
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("%d attempts with a rejected token, want 1", n)
+	}
+
+	// A new token is tried at once and clears the failure.
+	client.Reconfigure("good", "12345", false)
+	waitFor("reconnect", collector.isConnected)
+	if class, _ := collector.WebSocketFailure(); class != "" {
+		t.Errorf("failure %q still set after connecting", class)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chadmayfield/tempest-exporter/pkg/weatherflow"
+)
+
+const (
+	// subscriptionID identifies our listen_start in the server's ack; the
+	// stream sends listen_rapid_start, whose ack is not required, as
+	// subscriptionID + "-rapid".
+	subscriptionID = "tempest-exporter"
+
+	// defaultAckTimeout is how long to wait for the ack of listen_start
+	// before subscribing again, and then before reconnecting.
+	defaultAckTimeout = 30 * time.Second
+	// defaultStaleIntervals is how many report intervals may pass without
+	// an obs_st before the client resubscribes; after twice as many it
+	// reconnects.
+	defaultStaleIntervals = 3
+	// defaultReportInterval is assumed until an obs_st reports the device's
+	// interval.
+	defaultReportInterval = time.Minute
+	// defaultCheckInterval is how often the watchdog checks the stream.
+	defaultCheckInterval = 5 * time.Second
+)
+
+// errStale ends a connection whose subscription was never acknowledged or
+// whose observations stopped.
+var errStale = errors.New("websocket stream stale")
+
+// streamAction is what the watchdog does after a check.
+type streamAction int
+
+const (
+	streamOK streamAction = iota
+	streamResubscribe
+	streamReconnect
+)
+
+// streamState tracks whether a connection's subscription was acknowledged
+// and whether observations are arriving.
+type streamState struct {
+	mu sync.Mutex
+	// opened is when the connection opened.
+	opened time.Time
+	// subscribed is when listen_start was last sent for a missing ack.
+	subscribed time.Time
+	acked      bool
+	ackRetried bool
+	// lastObs is the last obs_st, or when the connection opened.
+	lastObs      time.Time
+	observed     bool
+	interval     time.Duration
+	staleRetried bool
+}
+
+func newStreamState(now time.Time, interval time.Duration) *streamState {
+	return &streamState{opened: now, subscribed: now, lastObs: now, interval: interval}
+}
+
+// ack records an ack; only the one for listen_start counts.
+func (s *streamState) ack(id string) {
+	if id != subscriptionID {
+		return
+	}
+	s.mu.Lock()
+	s.acked = true
+	s.mu.Unlock()
+}
+
+// observation records an obs_st at now and reports whether it is the
+// connection's first. reportInterval is the device's interval in minutes;
+// zero keeps the current interval. An observation also proves the
+// subscription, acknowledged or not.
+func (s *streamState) observation(now time.Time, reportInterval float64) (first bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first = !s.observed
+	s.observed = true
+	s.acked = true
+	s.lastObs = now
+	s.staleRetried = false
+	if reportInterval > 0 {
+		s.interval = time.Duration(reportInterval * float64(time.Minute))
+	}
+	return first
+}
+
+// received reports whether any obs_st arrived on the connection.
+func (s *streamState) received() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.observed
+}
+
+// check decides what to do at now. A missing ack or observation is first
+// answered by subscribing again, then by reconnecting; reason explains why.
+func (s *streamState) check(now time.Time, ackTimeout time.Duration, staleIntervals int) (action streamAction, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.acked {
+		if now.Sub(s.subscribed) < ackTimeout {
+			return streamOK, ""
+		}
+		if !s.ackRetried {
+			s.ackRetried = true
+			s.subscribed = now
+			return streamResubscribe, "listen_start not acknowledged"
+		}
+		return streamReconnect, fmt.Sprintf("listen_start not acknowledged after %s", 2*ackTimeout)
+	}
+
+	limit := time.Duration(staleIntervals) * s.interval
+	since := now.Sub(s.lastObs)
+	switch {
+	case since >= 2*limit:
+		return streamReconnect, fmt.Sprintf("no obs_st for %s", since.Round(time.Second))
+	case since >= limit && !s.staleRetried:
+		s.staleRetried = true
+		return streamResubscribe, fmt.Sprintf("no obs_st for %s", since.Round(time.Second))
+	}
+	return streamOK, ""
+}
+
+// watchStream checks st every checkInterval until conn ends. When the
+// stream is stale it resubscribes and marks the collector disconnected, and
+// if that doesn't help it closes the connection.
+func (c *Client) watchStream(conn *weatherflow.Conn, st *streamState) {
+	ticker := time.NewTicker(c.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.Done():
+			return
+		case now := <-ticker.C:
+			action, reason := st.check(now, c.ackTimeout, c.staleIntervals)
+			switch action {
+			case streamResubscribe:
+				c.collector.SetConnected(false)
+				slog.Warn("websocket stream stale, subscribing again", "reason", reason)
+				if err := conn.Subscribe(); err != nil {
+					conn.Close(fmt.Errorf("%w: resubscribe: %v", errStale, err))
+					return
+				}
+			case streamReconnect:
+				c.collector.SetConnected(false)
+				conn.Close(fmt.Errorf("%w: %s", errStale, reason))
+				return
+			}
+		}
+	}
+}
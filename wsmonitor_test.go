@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestStreamState_Check(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	const ackTimeout = 30 * time.Second
+
+	st := newStreamState(start, time.Minute)
+	steps := []struct {
+		now  time.Time
+		want streamAction
+	}{
+		{at(10 * time.Second), streamOK},
+		{at(30 * time.Second), streamResubscribe},
+		{at(50 * time.Second), streamOK},
+		{at(60 * time.Second), streamReconnect},
+	}
+	for i, s := range steps {
+		if got, reason := st.check(s.now, ackTimeout, 3); got != s.want {
+			t.Errorf("no ack, step %d: action %v (%s), want %v", i, got, reason, s.want)
+		}
+	}
+
+	// Acknowledged: stale after 3 report intervals, reconnect after 6. An
+	// observation resets both and sets the interval.
+	st = newStreamState(start, time.Minute)
+	st.ack("someone-else")
+	if got, _ := st.check(at(30*time.Second), ackTimeout, 3); got != streamResubscribe {
+		t.Errorf("ack for another id counted: %v", got)
+	}
+	st.ack(subscriptionID)
+	steps = []struct {
+		now  time.Time
+		want streamAction
+	}{
+		{at(2 * time.Minute), streamOK},
+		{at(3 * time.Minute), streamResubscribe},
+		{at(4 * time.Minute), streamOK},
+		{at(6 * time.Minute), streamReconnect},
+	}
+	for i, s := range steps {
+		if got, reason := st.check(s.now, ackTimeout, 3); got != s.want {
+			t.Errorf("acked, step %d: action %v (%s), want %v", i, got, reason, s.want)
+		}
+	}
+
+	st.observation(at(6*time.Minute), 5)
+	if got, _ := st.check(at(20*time.Minute), ackTimeout, 3); got != streamOK {
+		t.Errorf("within 3 intervals of 5m: %v, want OK", got)
+	}
+	if got, _ := st.check(at(21*time.Minute), ackTimeout, 3); got != streamResubscribe {
+		t.Errorf("after 3 intervals of 5m: %v, want resubscribe", got)
+	}
+}
+
+func TestRun_StaleStream(t *testing.T) {
+	type conn struct {
+		id         int
+		listenType string
+	}
+	listens := make(chan conn, 16)
+	conns := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conns++
+		id := conns
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.CloseNow() }()
+		sentObs := false
+		for {
+			_, data, err := ws.Read(r.Context())
+			if err != nil {
+				return
+			}
+			var msg struct{ Type, ID string }
+			_ = json.Unmarshal(data, &msg)
+			listens <- conn{id, msg.Type}
+			// The first connection never acks; the second acks and
+			// sends a single observation with a 6 ms report interval.
+			if id == 2 {
+				_ = ws.Write(r.Context(), websocket.MessageText, []byte(`{"type":"ack","id":"`+msg.ID+`"}`))
+				if !sentObs {
+					obs := `{"type":"obs_st","obs":[[1700000000,0.5,1.2,2.3,180,3,1013.25,22.5,65,50000,3.5,300,0.1,1,10,2,2.65,0.0001]]}`
+					_ = ws.Write(r.Context(), websocket.MessageText, []byte(obs))
+					sentObs = true
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+
+	collector := NewCollector("1", "test")
+	client := NewClient("token", "12345", collector)
+	client.wsURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	client.ackTimeout = 100 * time.Millisecond
+	client.checkInterval = 10 * time.Millisecond
+	client.staleIntervals = 20 // 120 ms
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	next := func() conn {
+		t.Helper()
+		select {
+		case c := <-listens:
+			return c
+		case <-time.After(3 * time.Second):
+			t.Fatal("no listen_start")
+			return conn{}
+		}
+	}
+
+	// Without an ack: subscribe, subscribe again, then reconnect.
+	for _, wantConn := range []int{1, 1, 2} {
+		if c := next(); c.id != wantConn || c.listenType != "listen_start" {
+			t.Fatalf("got %+v, want listen_start on connection %d", c, wantConn)
+		}
+	}
+
+	// Acked with one observation: connected until it goes stale, then
+	// resubscribed and finally reconnected.
+	deadline := time.Now().Add(time.Second)
+	for !collector.isConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("not connected after the observation")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c := next(); c.id != 2 {
+		t.Fatalf("got %+v, want a resubscription on connection 2", c)
+	}
+	if collector.isConnected() {
+		t.Error("still connected after the stream went stale")
+	}
+	if c := next(); c.id != 3 {
+		t.Fatalf("got %+v, want a new connection", c)
+	}
+
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+	if n := collector.wsDisconnects["stale"]; n != 2 {
+		t.Errorf("disconnects{reason=stale} = %v, want 2", n)
+	}
+	if n := collector.connDuration.count; n != 2 {
+		t.Errorf("connection durations observed = %d, want 2", n)
+	}
+	if n := collector.firstObs.count; n != 1 {
+		t.Errorf("first observations observed = %d, want 1", n)
+	}
+}
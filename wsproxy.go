@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// wsProxyPath mirrors the upstream URL path so consumers only change the host.
+const wsProxyPath = "/swd/data"
+
+// proxySendBuffer is the number of messages queued per downstream client.
+// A client that falls this far behind is disconnected rather than allowed to
+// stall the upstream read loop.
+const proxySendBuffer = 32
+
+// proxyWriteTimeout bounds a single write to a downstream client.
+const proxyWriteTimeout = 10 * time.Second
+
+// WSProxy serves a local WebSocket endpoint that speaks the WeatherFlow
+// listen_start/obs_st/evt_* protocol and re-broadcasts the messages received on
+// the exporter's single upstream connection, so other consumers can share it.
+type WSProxy struct {
+	maxClients int
+
+	mu      sync.Mutex
+	clients map[*proxyClient]struct{}
+	// lastObs holds the most recent obs_st per device, sent to new subscribers.
+	lastObs map[int][]byte
+}
+
+// proxyClient is one downstream WebSocket connection.
+type proxyClient struct {
+	send chan []byte
+	// dropErr is why send was closed; errSlowConsumer unless set. Guarded by WSProxy.mu.
+	dropErr error
+
+	mu      sync.Mutex
+	devices map[int]bool // device IDs subscribed via listen_start
+	rapid   map[int]bool // device IDs subscribed via listen_rapid_start
+}
+
+// proxyEnvelope holds the fields needed to route a message.
+type proxyEnvelope struct {
+	Type     string `json:"type"`
+	DeviceID int    `json:"device_id"`
+	ID       string `json:"id"`
+}
+
+// NewWSProxy creates a fan-out proxy accepting at most maxClients connections.
+func NewWSProxy(maxClients int) *WSProxy {
+	return &WSProxy{
+		maxClients: maxClients,
+		clients:    make(map[*proxyClient]struct{}),
+		lastObs:    make(map[int][]byte),
+	}
+}
+
+// Publish re-broadcasts an upstream message to subscribed clients. It is
+// intended to be registered with Client.OnMessage and never blocks.
+func (p *WSProxy) Publish(msgType string, data []byte) {
+	// Control messages are generated per downstream connection, not forwarded.
+	if msgType == "ack" || msgType == "connection_opened" {
+		return
+	}
+
+	var env proxyEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if msgType == "obs_st" {
+		p.lastObs[env.DeviceID] = data
+	}
+
+	for pc := range p.clients {
+		if !pc.wants(msgType, env.DeviceID) {
+			continue
+		}
+		select {
+		case pc.send <- data:
+		default:
+			// Slow consumer: drop it so one client can't hold up the others.
+			delete(p.clients, pc)
+			close(pc.send)
+		}
+	}
+}
+
+// DisconnectAll drops every downstream client without a close handshake, as
+// a network failure would.
+func (p *WSProxy) DisconnectAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for pc := range p.clients {
+		pc.dropErr = errDisconnected
+		delete(p.clients, pc)
+		close(pc.send)
+	}
+}
+
+// ClientCount returns the number of connected downstream clients.
+func (p *WSProxy) ClientCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
+
+// wants reports whether the client subscribed to this message's device.
+func (pc *proxyClient) wants(msgType string, deviceID int) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if msgType == "rapid_wind" {
+		return pc.rapid[deviceID]
+	}
+	return pc.devices[deviceID]
+}
+
+// ServeHTTP upgrades the request to a WebSocket and serves one downstream client.
+func (p *WSProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pc := &proxyClient{
+		send:    make(chan []byte, proxySendBuffer),
+		devices: make(map[int]bool),
+		rapid:   make(map[int]bool),
+	}
+
+	p.mu.Lock()
+	if len(p.clients) >= p.maxClients {
+		p.mu.Unlock()
+		http.Error(w, "too many proxy clients", http.StatusServiceUnavailable)
+		return
+	}
+	p.clients[pc] = struct{}{}
+	p.mu.Unlock()
+
+	// The HTTP server's read/write timeouts would otherwise cut off the
+	// long-lived connection after the hijack.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		p.remove(pc)
+		slog.Warn("websocket proxy accept failed", "error", err)
+		return
+	}
+	defer func() { _ = conn.CloseNow() }()
+
+	slog.Info("websocket proxy client connected", "remote_addr", r.RemoteAddr)
+	defer slog.Info("websocket proxy client disconnected", "remote_addr", r.RemoteAddr)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go func() {
+		defer cancel()
+		p.readRequests(ctx, conn, pc)
+	}()
+
+	p.enqueue(pc, []byte(`{"type":"connection_opened"}`))
+	err = p.writeLoop(ctx, conn, pc)
+	p.remove(pc)
+
+	switch {
+	case errors.Is(err, errDisconnected):
+		// Leave the deferred CloseNow to drop the connection abruptly.
+	case errors.Is(err, errSlowConsumer):
+		_ = conn.Close(websocket.StatusPolicyViolation, "slow consumer")
+	default:
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}
+}
+
+var (
+	errSlowConsumer = errors.New("slow consumer")
+	errDisconnected = errors.New("disconnected")
+)
+
+// writeLoop sends queued messages until the context ends or the client is dropped.
+func (p *WSProxy) writeLoop(ctx context.Context, conn *websocket.Conn, pc *proxyClient) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data, ok := <-pc.send:
+			if !ok {
+				p.mu.Lock()
+				err := pc.dropErr
+				p.mu.Unlock()
+				if err == nil {
+					err = errSlowConsumer
+				}
+				return err
+			}
+			writeCtx, writeCancel := context.WithTimeout(ctx, proxyWriteTimeout)
+			err := conn.Write(writeCtx, websocket.MessageText, data)
+			writeCancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readRequests handles listen_start/listen_stop and their rapid_wind variants.
+func (p *WSProxy) readRequests(ctx context.Context, conn *websocket.Conn, pc *proxyClient) {
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		var req proxyEnvelope
+		if err := json.Unmarshal(data, &req); err != nil {
+			continue
+		}
+
+		pc.mu.Lock()
+		switch req.Type {
+		case "listen_start":
+			pc.devices[req.DeviceID] = true
+		case "listen_stop":
+			delete(pc.devices, req.DeviceID)
+		case "listen_rapid_start":
+			pc.rapid[req.DeviceID] = true
+		case "listen_rapid_stop":
+			delete(pc.rapid, req.DeviceID)
+		default:
+			pc.mu.Unlock()
+			continue
+		}
+		pc.mu.Unlock()
+
+		ack, _ := json.Marshal(map[string]string{"type": "ack", "id": req.ID})
+		if !p.enqueue(pc, ack) {
+			return
+		}
+
+		// Like the upstream API, send the latest observation right away.
+		if req.Type == "listen_start" {
+			p.mu.Lock()
+			last := p.lastObs[req.DeviceID]
+			p.mu.Unlock()
+			if last != nil && !p.enqueue(pc, last) {
+				return
+			}
+		}
+	}
+}
+
+// enqueue queues a message for one client, reporting false if it was dropped.
+func (p *WSProxy) enqueue(pc *proxyClient, data []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.clients[pc]; !ok {
+		return false
+	}
+	select {
+	case pc.send <- data:
+		return true
+	default:
+		delete(p.clients, pc)
+		close(pc.send)
+		return false
+	}
+}
+
+// remove unregisters a client if it is still registered.
+func (p *WSProxy) remove(pc *proxyClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.clients[pc]; ok {
+		delete(p.clients, pc)
+		close(pc.send)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// dialProxy connects to a test proxy server and consumes the connection_opened greeting.
+func dialProxy(t *testing.T, ctx context.Context, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + wsProxyPath
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.CloseNow() })
+
+	if got := readType(t, ctx, conn); got != "connection_opened" {
+		t.Fatalf("first message type = %q, want connection_opened", got)
+	}
+	return conn
+}
+
+func readType(t *testing.T, ctx context.Context, conn *websocket.Conn) string {
+	t.Helper()
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var env struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	return env.Type
+}
+
+func newProxyServer(p *WSProxy) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle(wsProxyPath, p)
+	return httptest.NewServer(mux)
+}
+
+func waitForClients(t *testing.T, p *WSProxy, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.ClientCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("client count = %d, want %d", p.ClientCount(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWSProxy_SubscribeAndBroadcast(t *testing.T) {
+	p := NewWSProxy(4)
+	srv := newProxyServer(p)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An observation published before anyone subscribes is replayed on listen_start.
+	p.Publish("obs_st", []byte(`{"type":"obs_st","device_id":12345,"obs":[[1700000000]]}`))
+
+	conn := dialProxy(t, ctx, srv)
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"type":"listen_start","device_id":12345,"id":"ha"}`)); err != nil {
+		t.Fatalf("write listen_start: %v", err)
+	}
+
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+	if string(data) != `{"id":"ha","type":"ack"}` {
+		t.Errorf("ack = %s", data)
+	}
+	if got := readType(t, ctx, conn); got != "obs_st" {
+		t.Errorf("replayed type = %q, want obs_st", got)
+	}
+
+	// Upstream control messages and other devices are not forwarded.
+	p.Publish("ack", []byte(`{"type":"ack","id":"tempest-exporter"}`))
+	p.Publish("evt_strike", []byte(`{"type":"evt_strike","device_id":99999,"evt":[1,2,3]}`))
+	p.Publish("rapid_wind", []byte(`{"type":"rapid_wind","device_id":12345,"ob":[1,2,3]}`))
+	p.Publish("evt_precip", []byte(`{"type":"evt_precip","device_id":12345,"evt":[1700000000]}`))
+
+	if got := readType(t, ctx, conn); got != "evt_precip" {
+		t.Errorf("forwarded type = %q, want evt_precip", got)
+	}
+}
+
+func TestWSProxy_ListenStop(t *testing.T) {
+	p := NewWSProxy(4)
+	srv := newProxyServer(p)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := dialProxy(t, ctx, srv)
+	for _, msg := range []string{
+		`{"type":"listen_start","device_id":12345,"id":"a"}`,
+		`{"type":"listen_rapid_start","device_id":12345,"id":"b"}`,
+		`{"type":"listen_stop","device_id":12345,"id":"c"}`,
+	} {
+		if err := conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if got := readType(t, ctx, conn); got != "ack" {
+			t.Fatalf("reply type = %q, want ack", got)
+		}
+	}
+
+	p.Publish("obs_st", []byte(`{"type":"obs_st","device_id":12345,"obs":[[1700000000]]}`))
+	p.Publish("rapid_wind", []byte(`{"type":"rapid_wind","device_id":12345,"ob":[1,2,3]}`))
+
+	if got := readType(t, ctx, conn); got != "rapid_wind" {
+		t.Errorf("type = %q, want rapid_wind (obs_st was unsubscribed)", got)
+	}
+}
+
+func TestWSProxy_MaxClients(t *testing.T) {
+	p := NewWSProxy(1)
+	srv := newProxyServer(p)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dialProxy(t, ctx, srv)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + wsProxyPath
+	_, resp, err := websocket.Dial(ctx, url, nil)
+	if err == nil {
+		t.Fatal("expected second client to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for second client, got %v", resp)
+	}
+}
+
+func TestWSProxy_DropsSlowConsumer(t *testing.T) {
+	p := NewWSProxy(4)
+	srv := newProxyServer(p)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := dialProxy(t, ctx, srv)
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"type":"listen_start","device_id":1,"id":"x"}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = readType(t, ctx, conn) // ack
+	waitForClients(t, p, 1)
+
+	// Never read again; flood well past the per-client buffer.
+	payload := []byte(`{"type":"evt_strike","device_id":1,"evt":[1,2,3],"pad":"` + strings.Repeat("x", 64<<10) + `"}`)
+	for i := 0; i < 1000 && p.ClientCount() > 0; i++ {
+		p.Publish("evt_strike", payload)
+	}
+	waitForClients(t, p, 0)
+}
+
+func TestClient_OnMessageFeedsProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.CloseNow() }()
+		_, _, _ = conn.Read(r.Context()) // listen_start
+		_ = conn.Write(r.Context(), websocket.MessageText, []byte(`{"type":"ack","id":"tempest-exporter"}`))
+		_ = conn.Write(r.Context(), websocket.MessageText, []byte(`{"type":"evt_precip","device_id":12345,"evt":[1700000000]}`))
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	client, _ := newTestClient()
+	client.wsURL = "ws" + strings.TrimPrefix(upstream.URL, "http")
+
+	var got []string
+	done := make(chan struct{})
+	client.OnMessage(func(msgType string, _ []byte) {
+		got = append(got, msgType)
+		if len(got) == 2 {
+			close(done)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = connectOnce(ctx, client) }()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener not called")
+	}
+	if got[0] != "ack" || got[1] != "evt_precip" {
+		t.Errorf("listener types = %v, want [ack evt_precip]", got)
+	}
+}